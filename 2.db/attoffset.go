@@ -0,0 +1,114 @@
+package main
+
+// Which attribute does a byte belong to (-attname)? The inverse of
+// -trace-offsets: given an offset into the tuple, walk the schema and name
+// the header field, padding or attribute that covers it.
+
+import (
+	"fmt"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// HeapTupleHeaderData fields by starting offset (htup_details.h)
+var tupleHeaderFields = []struct {
+	off  int
+	name string
+}{
+	{0, "t_xmin"}, {4, "t_xmax"}, {8, "t_cid"}, {12, "t_ctid"},
+	{18, "t_infomask2"}, {20, "t_infomask"}, {22, "t_hoff"},
+}
+
+// describeTupleOffset says what byte off of tuple (counted from t_xmin, like
+// the offsets of -trace-offsets) is part of when decoded with cols.
+func describeTupleOffset(tuple []byte, rh *heappage.RowHeader, cols []heappage.ColumnDef, off int) string {
+	if off < 0 || off >= len(tuple) {
+		return fmt.Sprintf("outside the tuple (%d bytes)", len(tuple))
+	}
+	if off < heappage.RowHeaderByteLen {
+		f := tupleHeaderFields[0]
+		for _, h := range tupleHeaderFields {
+			if h.off <= off {
+				f = h
+			}
+		}
+		return fmt.Sprintf("header field %s", f.name)
+	}
+	if off < int(rh.Hoff) {
+		bitmapEnd := heappage.RowHeaderByteLen
+		if rh.HasNull() {
+			bitmapEnd += (rh.Natts() + 7) / 8
+		}
+		switch {
+		case off < bitmapEnd:
+			first := (off-heappage.RowHeaderByteLen)*8 + 1
+			return fmt.Sprintf("null bitmap, attributes %d-%d", first, min(first+7, rh.Natts()))
+		case rh.InfoMask&heappage.HEAP_HASOID_OLD != 0 && off >= int(rh.Hoff)-4:
+			return "oid (pre-PG12 WITH OIDS)"
+		default:
+			return "header padding before t_hoff"
+		}
+	}
+
+	_, trace, err := heappage.TraceRow(tuple, rh, cols, decodeOptions)
+	end := int(rh.Hoff)
+	for _, a := range trace {
+		if a.Null {
+			continue
+		}
+		switch {
+		case off < a.Off-a.Pad:
+		case off < a.Off:
+			return fmt.Sprintf("alignment padding before attr %d %q", a.Attr, a.Name)
+		case off < a.Off+a.Len:
+			return fmt.Sprintf("attr %d %q, byte %d of %d", a.Attr, a.Name, off-a.Off, a.Len)
+		}
+		end = a.Off + a.Len
+	}
+	if err != nil {
+		return fmt.Sprintf("not reached, the walk stopped at byte %d: %v", end, err)
+	}
+	return fmt.Sprintf("after the last attribute, which ends at byte %d", end)
+}
+
+// attnameAtOffset answers -attname for every NORMAL tuple on the page.
+func attnameAtOffset(filePath string, pageNo, off int, cols []heappage.ColumnDef) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	page, _, items, err := heappage.LoadPage(f, pageNo)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("== Page %d, tuple byte %d ==\n", pageNo, off)
+	for _, it := range items {
+		if it.Flags != heappage.LP_NORMAL {
+			continue
+		}
+		start, end := int(it.LpOff), int(it.LpOff)+int(it.LpLen)
+		if start >= end || end > len(page) {
+			continue
+		}
+		tuple := page[start:end]
+		rh, err := heappage.ParseRowHeader(tuple)
+		if err != nil {
+			fmt.Printf(" [%2d] %v\n", it.Index, err)
+			continue
+		}
+		fmt.Printf(" [%2d] %s\n", it.Index, describeTupleOffset(tuple, rh, cols, off))
+	}
+	return nil
+}
+
+// attnameInTuple answers -attname for a lone tuple (-tuple-hex).
+func attnameInTuple(tuple []byte, off int, cols []heappage.ColumnDef) error {
+	rh, err := heappage.ParseRowHeader(tuple)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("byte %d: %s\n", off, describeTupleOffset(tuple, rh, cols, off))
+	return nil
+}
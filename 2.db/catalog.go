@@ -0,0 +1,50 @@
+package main
+
+// Catalog schemas from package catalog for the flags that use them:
+// -catalog dumps a catalog like a user table, -attribute-file with -relid
+// reads a table's columns from a dumped pg_attribute, and -datadir finds
+// both the table and its columns. -pgversion picks the layouts
+// (UseCatalogVersion); without it they are 14/15's.
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ptflp/techinterview/2.db/catalog"
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// catalogMajor is the major given with -pgversion, 0 if none.
+var catalogMajor int
+
+// UseCatalogVersion selects the catalog schemas for PostgreSQL major v
+// (-pgversion). Majors before 16 also get the 12-byte aclitem.
+func UseCatalogVersion(v int) error {
+	if err := catalog.CheckMajor(v); err != nil {
+		return err
+	}
+	if v < 16 {
+		decodeOptions.LegacyAclItem = true
+	}
+	catalogMajor = v
+	return nil
+}
+
+// catalogSchema returns the built-in schema of a catalog for -catalog.
+func catalogSchema(name string) ([]heappage.ColumnDef, error) {
+	return catalog.Schema(name, catalogMajor)
+}
+
+// loadTableColumns reads the columns of table relid from a pg_attribute
+// file for -attribute-file.
+func loadTableColumns(ctx context.Context, attrPath string, relid heappage.Oid) ([]heappage.ColumnDef, error) {
+	if relid == 0 {
+		return nil, errors.New("-attribute-file needs -relid")
+	}
+	f, err := openRelation(attrPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return catalog.TableColumns(ctx, f, relid, catalogMajor, decodeOptions)
+}
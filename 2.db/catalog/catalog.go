@@ -0,0 +1,401 @@
+// Package catalog reads the PostgreSQL system catalogs a table's layout is
+// recorded in, so heap files can be decoded without a hand-written schema:
+// LoadSchema finds a table in a data directory by database and table name
+// and returns its columns, ready for heappage.DecodeRow.
+package catalog
+
+// Built-in catalog schemas. pg_attribute (oid 1249) gives the column layout
+// of every table (TableColumns). pg_class (oid 1259) names each relation and
+// gives its relfilenode and relkind. pg_type (oid 1247) gives each type's
+// typlen, typbyval, typalign and typstorage. pg_proc (oid 1255) is here for
+// reading functions: its rows end in a long run of varlenas that are mostly
+// NULL. Schema returns any of them for dumping like a user table.
+//
+// The fixed part of pg_attribute, pg_type and pg_proc changes between
+// majors, so each is chosen by major version (Schema, TableColumns):
+//
+//	12, 13  pgAttributeSchema12, pgTypeSchema12, pgProcSchema12
+//	14, 15  pgAttributeSchema14: attcompression added after attstorage;
+//	        pgTypeSchema14: typsubscript added after typrelid;
+//	        pgProcSchema14: prosqlbody added after probin
+//	16      pgAttributeSchema16: attndims and attinhcount shrink to int2,
+//	        attstattarget too and moves after attinhcount;
+//	        pg_type and pg_proc as in 14
+//
+// pgClassSchema is the same from 12 to 16; 12 dropped relhasoids, and with
+// it the WITH OIDS oid in the tuple header. What does change is aclitem,
+// 12 bytes aligned 'i' before 16, so in the 12 to 15 layouts the aclitem[]
+// columns (relacl, attacl, typacl, proacl) are 'i'-aligned too, and their
+// elements need heappage.Options.LegacyAclItem.
+//
+// Major 0, for an unknown version, takes the 14 layouts. 17 makes
+// attstattarget nullable and moves it into the variable part, and is not
+// built in; reading its pg_attribute with these lists would misplace every
+// column after attinhcount.
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+const (
+	TypeRelationID      heappage.Oid = 1247
+	AttributeRelationID heappage.Oid = 1249
+	ProcedureRelationID heappage.Oid = 1255
+)
+
+var pgAttributeSchema14 = []heappage.ColumnDef{
+	heappage.Column("attrelid", heappage.OIDOID),
+	heappage.Column("attname", heappage.NAMEOID),
+	heappage.Column("atttypid", heappage.OIDOID),
+	heappage.Column("attstattarget", heappage.INT4OID),
+	heappage.Column("attlen", heappage.INT2OID),
+	heappage.Column("attnum", heappage.INT2OID),
+	heappage.Column("attndims", heappage.INT4OID),
+	heappage.Column("attcacheoff", heappage.INT4OID),
+	heappage.Column("atttypmod", heappage.INT4OID),
+	heappage.Column("attbyval", heappage.BOOLOID),
+	heappage.Column("attalign", heappage.CHAROID),
+	heappage.Column("attstorage", heappage.CHAROID),
+	heappage.Column("attcompression", heappage.CHAROID),
+	heappage.Column("attnotnull", heappage.BOOLOID),
+	heappage.Column("atthasdef", heappage.BOOLOID),
+	heappage.Column("atthasmissing", heappage.BOOLOID),
+	heappage.Column("attidentity", heappage.CHAROID),
+	heappage.Column("attgenerated", heappage.CHAROID),
+	heappage.Column("attisdropped", heappage.BOOLOID),
+	heappage.Column("attislocal", heappage.BOOLOID),
+	heappage.Column("attinhcount", heappage.INT4OID),
+	heappage.Column("attcollation", heappage.OIDOID),
+	heappage.Column("attacl", 1034),                          // aclitem[]
+	heappage.Column("attoptions", 1009),                      // text[]
+	heappage.Column("attfdwoptions", 1009),                   // text[]
+	{Name: "attmissingval", Type: 2277, Len: -1, Align: 'd'}, // anyarray
+}
+
+// pgAttributeSchema16 is the 14 layout with attstattarget, attndims and
+// attinhcount as int2, attstattarget after attinhcount.
+var pgAttributeSchema16 = []heappage.ColumnDef{
+	heappage.Column("attrelid", heappage.OIDOID),
+	heappage.Column("attname", heappage.NAMEOID),
+	heappage.Column("atttypid", heappage.OIDOID),
+	heappage.Column("attlen", heappage.INT2OID),
+	heappage.Column("attnum", heappage.INT2OID),
+	heappage.Column("attcacheoff", heappage.INT4OID),
+	heappage.Column("atttypmod", heappage.INT4OID),
+	heappage.Column("attndims", heappage.INT2OID),
+	heappage.Column("attbyval", heappage.BOOLOID),
+	heappage.Column("attalign", heappage.CHAROID),
+	heappage.Column("attstorage", heappage.CHAROID),
+	heappage.Column("attcompression", heappage.CHAROID),
+	heappage.Column("attnotnull", heappage.BOOLOID),
+	heappage.Column("atthasdef", heappage.BOOLOID),
+	heappage.Column("atthasmissing", heappage.BOOLOID),
+	heappage.Column("attidentity", heappage.CHAROID),
+	heappage.Column("attgenerated", heappage.CHAROID),
+	heappage.Column("attisdropped", heappage.BOOLOID),
+	heappage.Column("attislocal", heappage.BOOLOID),
+	heappage.Column("attinhcount", heappage.INT2OID),
+	heappage.Column("attstattarget", heappage.INT2OID),
+	heappage.Column("attcollation", heappage.OIDOID),
+	heappage.Column("attacl", 1034),                          // aclitem[]
+	heappage.Column("attoptions", 1009),                      // text[]
+	heappage.Column("attfdwoptions", 1009),                   // text[]
+	{Name: "attmissingval", Type: 2277, Len: -1, Align: 'd'}, // anyarray
+}
+
+// pgAttributeSchema12 is the 14 layout without attcompression.
+var pgAttributeSchema12 = append(append([]heappage.ColumnDef{}, pgAttributeSchema14[:12]...), pgAttributeSchema14[13:]...)
+
+var pgTypeSchema14 = []heappage.ColumnDef{
+	heappage.Column("oid", heappage.OIDOID),
+	heappage.Column("typname", heappage.NAMEOID),
+	heappage.Column("typnamespace", heappage.OIDOID),
+	heappage.Column("typowner", heappage.OIDOID),
+	heappage.Column("typlen", heappage.INT2OID),
+	heappage.Column("typbyval", heappage.BOOLOID),
+	heappage.Column("typtype", heappage.CHAROID),
+	heappage.Column("typcategory", heappage.CHAROID),
+	heappage.Column("typispreferred", heappage.BOOLOID),
+	heappage.Column("typisdefined", heappage.BOOLOID),
+	heappage.Column("typdelim", heappage.CHAROID),
+	heappage.Column("typrelid", heappage.OIDOID),
+	regprocColumn("typsubscript"),
+	heappage.Column("typelem", heappage.OIDOID),
+	heappage.Column("typarray", heappage.OIDOID),
+	regprocColumn("typinput"),
+	regprocColumn("typoutput"),
+	regprocColumn("typreceive"),
+	regprocColumn("typsend"),
+	regprocColumn("typmodin"),
+	regprocColumn("typmodout"),
+	regprocColumn("typanalyze"),
+	heappage.Column("typalign", heappage.CHAROID),
+	heappage.Column("typstorage", heappage.CHAROID),
+	heappage.Column("typnotnull", heappage.BOOLOID),
+	heappage.Column("typbasetype", heappage.OIDOID),
+	heappage.Column("typtypmod", heappage.INT4OID),
+	heappage.Column("typndims", heappage.INT4OID),
+	heappage.Column("typcollation", heappage.OIDOID),
+	heappage.Column("typdefaultbin", heappage.PGNODETREEOID),
+	heappage.Column("typdefault", heappage.TEXTOID),
+	heappage.Column("typacl", 1034), // aclitem[]
+}
+
+var pgClassSchema = []heappage.ColumnDef{
+	heappage.Column("oid", heappage.OIDOID),
+	heappage.Column("relname", heappage.NAMEOID),
+	heappage.Column("relnamespace", heappage.OIDOID),
+	heappage.Column("reltype", heappage.OIDOID),
+	heappage.Column("reloftype", heappage.OIDOID),
+	heappage.Column("relowner", heappage.OIDOID),
+	heappage.Column("relam", heappage.OIDOID),
+	heappage.Column("relfilenode", heappage.OIDOID),
+	heappage.Column("reltablespace", heappage.OIDOID),
+	heappage.Column("relpages", heappage.INT4OID),
+	heappage.Column("reltuples", heappage.FLOAT4OID),
+	heappage.Column("relallvisible", heappage.INT4OID),
+	heappage.Column("reltoastrelid", heappage.OIDOID),
+	heappage.Column("relhasindex", heappage.BOOLOID),
+	heappage.Column("relisshared", heappage.BOOLOID),
+	heappage.Column("relpersistence", heappage.CHAROID),
+	heappage.Column("relkind", heappage.CHAROID),
+	heappage.Column("relnatts", heappage.INT2OID),
+	heappage.Column("relchecks", heappage.INT2OID),
+	heappage.Column("relhasrules", heappage.BOOLOID),
+	heappage.Column("relhastriggers", heappage.BOOLOID),
+	heappage.Column("relhassubclass", heappage.BOOLOID),
+	heappage.Column("relrowsecurity", heappage.BOOLOID),
+	heappage.Column("relforcerowsecurity", heappage.BOOLOID),
+	heappage.Column("relispopulated", heappage.BOOLOID),
+	heappage.Column("relreplident", heappage.CHAROID),
+	heappage.Column("relispartition", heappage.BOOLOID),
+	heappage.Column("relrewrite", heappage.OIDOID),
+	heappage.Column("relfrozenxid", heappage.XIDOID),
+	heappage.Column("relminmxid", heappage.XIDOID),
+	heappage.Column("relacl", 1034),     // aclitem[]
+	heappage.Column("reloptions", 1009), // text[]
+	heappage.Column("relpartbound", heappage.PGNODETREEOID),
+}
+
+// pgTypeSchema12 is the 14 layout without typsubscript.
+var pgTypeSchema12 = append(append([]heappage.ColumnDef{}, pgTypeSchema14[:12]...), pgTypeSchema14[13:]...)
+
+var pgProcSchema14 = []heappage.ColumnDef{
+	heappage.Column("oid", heappage.OIDOID),
+	heappage.Column("proname", heappage.NAMEOID),
+	heappage.Column("pronamespace", heappage.OIDOID),
+	heappage.Column("proowner", heappage.OIDOID),
+	heappage.Column("prolang", heappage.OIDOID),
+	heappage.Column("procost", heappage.FLOAT4OID),
+	heappage.Column("prorows", heappage.FLOAT4OID),
+	heappage.Column("provariadic", heappage.OIDOID),
+	regprocColumn("prosupport"),
+	heappage.Column("prokind", heappage.CHAROID),
+	heappage.Column("prosecdef", heappage.BOOLOID),
+	heappage.Column("proleakproof", heappage.BOOLOID),
+	heappage.Column("proisstrict", heappage.BOOLOID),
+	heappage.Column("proretset", heappage.BOOLOID),
+	heappage.Column("provolatile", heappage.CHAROID),
+	heappage.Column("proparallel", heappage.CHAROID),
+	heappage.Column("pronargs", heappage.INT2OID),
+	heappage.Column("pronargdefaults", heappage.INT2OID),
+	heappage.Column("prorettype", heappage.OIDOID),
+	heappage.Column("proargtypes", heappage.OIDVECTOROID),
+	heappage.Column("proallargtypes", 1028), // oid[]
+	heappage.Column("proargmodes", 1002),    // "char"[]
+	heappage.Column("proargnames", 1009),    // text[]
+	heappage.Column("proargdefaults", heappage.PGNODETREEOID),
+	heappage.Column("protrftypes", 1028), // oid[]
+	heappage.Column("prosrc", heappage.TEXTOID),
+	heappage.Column("probin", heappage.TEXTOID),
+	heappage.Column("prosqlbody", heappage.PGNODETREEOID),
+	heappage.Column("proconfig", 1009), // text[]
+	heappage.Column("proacl", 1034),    // aclitem[]
+}
+
+// pgProcSchema12 is the 14 layout without prosqlbody.
+var pgProcSchema12 = append(append([]heappage.ColumnDef{}, pgProcSchema14[:27]...), pgProcSchema14[28:]...)
+
+// regprocColumn is a regproc column. regproc is registered in an init
+// function, after the schemas above are built, so Column can't size it.
+func regprocColumn(name string) heappage.ColumnDef {
+	return heappage.ColumnDef{Name: name, Type: 24, Len: 4, Align: 'i'}
+}
+
+// layout is the set of catalog schemas of one major.
+type layout struct {
+	attribute, class, typ, proc []heappage.ColumnDef
+}
+
+// layoutFor returns the catalog schemas of PostgreSQL major v. Callers
+// taking 0 for unknown pass cmp.Or(v, 14).
+func layoutFor(v int) (layout, error) {
+	switch v {
+	case 12, 13:
+		return layout{pgAttributeSchema12, pgClassSchema, pgTypeSchema12, pgProcSchema12}.legacyAcl(), nil
+	case 14, 15:
+		return layout{pgAttributeSchema14, pgClassSchema, pgTypeSchema14, pgProcSchema14}.legacyAcl(), nil
+	case 16:
+		return layout{pgAttributeSchema16, pgClassSchema, pgTypeSchema14, pgProcSchema14}, nil
+	}
+	return layout{}, fmt.Errorf("no built-in catalog schemas for PostgreSQL %d (have 12 to 16)", v)
+}
+
+// legacyAcl aligns the aclitem[] columns of l 'i', as they are before 16.
+func (l layout) legacyAcl() layout {
+	realign := func(schema []heappage.ColumnDef) []heappage.ColumnDef {
+		out := append([]heappage.ColumnDef(nil), schema...)
+		for i := range out {
+			if out[i].Type == 1034 {
+				out[i].Align = 'i'
+			}
+		}
+		return out
+	}
+	return layout{realign(l.attribute), realign(l.class), realign(l.typ), realign(l.proc)}
+}
+
+// CheckMajor reports whether the catalogs of PostgreSQL major v are built
+// in.
+func CheckMajor(v int) error {
+	_, err := layoutFor(v)
+	return err
+}
+
+// Schema returns the built-in schema of a catalog in the layout of major,
+// 14's if 0.
+func Schema(name string, major int) ([]heappage.ColumnDef, error) {
+	l, err := layoutFor(cmp.Or(major, 14))
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "pg_attribute":
+		return l.attribute, nil
+	case "pg_class":
+		return l.class, nil
+	case "pg_type":
+		return l.typ, nil
+	case "pg_proc":
+		return l.proc, nil
+	default:
+		return nil, fmt.Errorf("no built-in schema for catalog %q (have pg_attribute, pg_class, pg_type, pg_proc)", name)
+	}
+}
+
+// tableColumnAttrs returns the 1-based numbers of the pg_attribute columns
+// TableColumns reads in schema: attrelid, attname, atttypid, attlen, attnum
+// and attalign.
+func tableColumnAttrs(schema []heappage.ColumnDef) []int {
+	want := []string{"attrelid", "attname", "atttypid", "attlen", "attnum", "attalign"}
+	attrs := make([]int, len(want))
+	for i, name := range want {
+		for j, c := range schema {
+			if c.Name == name {
+				attrs[i] = j + 1
+			}
+		}
+	}
+	return attrs
+}
+
+// TableColumns builds the schema of table relid (its pg_class oid, which is
+// also its relfilenode until the first rewrite) from a pg_attribute heap
+// file in the layout of major (14's if 0). Only live-looking rows with
+// attnum > 0 count; dropped columns are kept under their
+// "........pg.dropped.N........" names because they still take up space in
+// old tuples. attlen and attalign come from the catalog, so columns of
+// unknown types are still walked correctly. attname is decoded with opt,
+// whose Encoding should be the database's.
+func TableColumns(ctx context.Context, r io.ReaderAt, relid heappage.Oid, major int, opt *heappage.Options) ([]heappage.ColumnDef, error) {
+	l, err := layoutFor(cmp.Or(major, 14))
+	if err != nil {
+		return nil, err
+	}
+	byNum := map[int16]heappage.ColumnDef{}
+	err = scanLiveRows(ctx, r, l.attribute, tableColumnAttrs(l.attribute), opt, func(vals []any) error {
+		if vals[0] != relid {
+			return nil
+		}
+		num := vals[4].(int16)
+		if num <= 0 {
+			return nil // system columns
+		}
+		if prev, dup := byNum[num]; dup {
+			return fmt.Errorf("attnum %d appears twice (%q and %q); old row versions without hint bits?",
+				num, prev.Name, vals[1])
+		}
+		align := vals[5].(string)
+		byNum[num] = heappage.ColumnDef{
+			Name:  vals[1].(string),
+			Type:  vals[2].(heappage.Oid),
+			Len:   int(vals[3].(int16)),
+			Align: align[0],
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(byNum) == 0 {
+		return nil, fmt.Errorf("no pg_attribute rows for relation %d", relid)
+	}
+
+	nums := make([]int, 0, len(byNum))
+	for n := range byNum {
+		nums = append(nums, int(n))
+	}
+	sort.Ints(nums)
+	cols := make([]heappage.ColumnDef, len(nums))
+	for i, n := range nums {
+		if n != i+1 {
+			return nil, fmt.Errorf("relation %d: attnum %d missing", relid, i+1)
+		}
+		cols[i] = byNum[int16(n)]
+	}
+	return cols, nil
+}
+
+// scanLiveRows decodes the given attributes of every live-looking tuple of a
+// catalog and hands them to fn. A page that does not parse ends the scan
+// with its *PageError.
+func scanLiveRows(ctx context.Context, r io.ReaderAt, cols []heappage.ColumnDef, attrs []int, opt *heappage.Options, fn func(vals []any) error) error {
+	return heappage.WalkPages(r, heappage.PageSize, func(pageNo int, page []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, items, err := heappage.ParsePage(page)
+		if err != nil {
+			var pe *heappage.PageError
+			if errors.As(err, &pe) {
+				pe.PageNo = pageNo
+			}
+			return err
+		}
+		for _, it := range items {
+			if it.Flags != heappage.LP_NORMAL || int(it.LpOff)+int(it.LpLen) > len(page) {
+				continue
+			}
+			tuple := page[it.LpOff : int(it.LpOff)+int(it.LpLen)]
+			rh, err := heappage.ParseRowHeader(tuple)
+			if err != nil || !rh.LooksLive() {
+				continue
+			}
+			vals, err := heappage.DecodeRowAttrs(tuple, rh, cols, attrs, opt)
+			if err != nil {
+				return fmt.Errorf("page %d lp %d: %w", pageNo, it.Index, err)
+			}
+			if err := fn(vals); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,104 @@
+package catalog
+
+// Relation mapper file (relmapper.c).
+//
+// Shared catalogs (pg_database, pg_authid, ...) and "nailed" per-database
+// catalogs (pg_class, pg_attribute, pg_type, pg_proc) have relfilenode = 0 in
+// pg_class. Their real file number lives in global/pg_filenode.map or
+// base/DBOID/pg_filenode.map.
+//
+// On-disk layout (little-endian):
+//
+//	int32      magic         0x592717
+//	int32      num_mappings
+//	RelMapping mappings[MAX_MAPPINGS]   {Oid mapoid; Oid mapfilenumber}
+//	uint32     crc           CRC-32C over everything before it
+//	int32      pad           (PG <= 15 only)
+//
+// MAX_MAPPINGS is 62 up to PG15 (512-byte file) and 64 since PG16 (524 bytes).
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+const (
+	RelMapperFileMagic = 0x592717
+
+	relMapFileSizeOld = 512 // PG12..PG15
+	relMapFileSizeNew = 524 // PG16+
+)
+
+type RelMapping struct {
+	OID      uint32
+	Filenode uint32
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// parseRelMap decodes the raw contents of a pg_filenode.map file and
+// verifies its magic, mapping count and CRC.
+func parseRelMap(buf []byte) ([]RelMapping, error) {
+	var maxMappings int
+	switch len(buf) {
+	case relMapFileSizeOld:
+		maxMappings = 62
+	case relMapFileSizeNew:
+		maxMappings = 64
+	default:
+		return nil, fmt.Errorf("unexpected relmap file size %d (want %d or %d)",
+			len(buf), relMapFileSizeOld, relMapFileSizeNew)
+	}
+
+	magic := binary.LittleEndian.Uint32(buf[0:4])
+	if magic != RelMapperFileMagic {
+		return nil, fmt.Errorf("bad relmap magic 0x%x", magic)
+	}
+	n := int(int32(binary.LittleEndian.Uint32(buf[4:8])))
+	if n < 0 || n > maxMappings {
+		return nil, fmt.Errorf("bad relmap num_mappings=%d (max %d)", n, maxMappings)
+	}
+
+	crcOff := 8 + maxMappings*8
+	stored := binary.LittleEndian.Uint32(buf[crcOff : crcOff+4])
+	if got := crc32.Checksum(buf[:crcOff], crc32cTable); got != stored {
+		return nil, fmt.Errorf("relmap CRC mismatch: stored=0x%08x computed=0x%08x", stored, got)
+	}
+
+	out := make([]RelMapping, 0, n)
+	for i := 0; i < n; i++ {
+		off := 8 + i*8
+		out = append(out, RelMapping{
+			OID:      binary.LittleEndian.Uint32(buf[off : off+4]),
+			Filenode: binary.LittleEndian.Uint32(buf[off+4 : off+8]),
+		})
+	}
+	return out, nil
+}
+
+func readRelMap(mapFile string) ([]RelMapping, error) {
+	buf, err := os.ReadFile(mapFile)
+	if err != nil {
+		return nil, err
+	}
+	return parseRelMap(buf)
+}
+
+var ErrNotMapped = errors.New("relation is not in the relmap file")
+
+// MapLookup returns the filenode of a mapped relation from pg_filenode.map.
+func MapLookup(mapFile string, relOid uint32) (filenode uint32, err error) {
+	maps, err := readRelMap(mapFile)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", mapFile, err)
+	}
+	for _, m := range maps {
+		if m.OID == relOid {
+			return m.Filenode, nil
+		}
+	}
+	return 0, fmt.Errorf("oid %d: %w", relOid, ErrNotMapped)
+}
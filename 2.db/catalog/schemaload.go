@@ -0,0 +1,216 @@
+package catalog
+
+// Finding a table in a data directory by database and table name, and its
+// schema with it: pg_database gives the database oid, that database's
+// pg_class the relfilenode, and its pg_attribute the columns (see
+// TableColumns). Tables in other tablespaces are found under pg_tblspc (see
+// DatabaseDir).
+//
+// Only the leading columns of pg_database and pg_class are read. They have
+// been the same since PostgreSQL 12, when oid became an ordinary column, so
+// unlike pg_attribute they do not depend on the major version.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+const (
+	RelationRelationID heappage.Oid = 1259 // pg_class
+	DatabaseRelationID heappage.Oid = 1262 // pg_database
+)
+
+var pgDatabasePrefix = []heappage.ColumnDef{
+	heappage.Column("oid", heappage.OIDOID),
+	heappage.Column("datname", heappage.NAMEOID),
+	heappage.Column("datdba", heappage.OIDOID),
+	heappage.Column("encoding", heappage.INT4OID),
+}
+
+// pgClassPrefix is the part of pg_class LocateTable reads, up to
+// reltablespace.
+var pgClassPrefix = pgClassSchema[:9]
+
+// catalogFile returns the main fork of catalog relOid in dir (global or
+// base/<dboid>). Mapped catalogs are looked up in dir/pg_filenode.map;
+// anything else, like pg_database since PG15, uses its oid as filenode, as
+// do all catalogs when the map file is missing.
+func catalogFile(dir string, relOid heappage.Oid) (string, error) {
+	filenode, err := MapLookup(filepath.Join(dir, "pg_filenode.map"), uint32(relOid))
+	if errors.Is(err, ErrNotMapped) || errors.Is(err, fs.ErrNotExist) {
+		filenode = uint32(relOid)
+	} else if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprint(filenode)), nil
+}
+
+// Cluster is a data directory to find tables in.
+type Cluster struct {
+	DataDir string
+	// Major is the PostgreSQL major version, which selects the
+	// pg_attribute layout and the PG_<major>_<catversion> directory of
+	// tablespaces. 0 takes the 14 layout and whichever directory there is
+	// (see ReadMajor).
+	Major int
+	// Tablespaces maps tablespace oids to locations used instead of
+	// following pg_tblspc/<oid>.
+	Tablespaces map[heappage.Oid]string
+	// Options decode the catalog rows; see TableSchema.
+	Options *heappage.Options
+}
+
+// ReadMajor returns the major version in the PG_VERSION file of datadir.
+func ReadMajor(datadir string) (int, error) {
+	b, err := os.ReadFile(filepath.Join(datadir, "PG_VERSION"))
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("PG_VERSION: %w", err)
+	}
+	return v, nil
+}
+
+// LoadSchema returns the columns of table tablename in database dbname of
+// the cluster in datadir, ready for heappage.DecodeRow: ordered by attnum,
+// without system columns, and with dropped columns kept, since their data
+// is still in old tuples. The major version is read from PG_VERSION, and
+// column names are converted from the database encoding if heappage knows
+// it. A table outside pg_default needs its tablespace link to resolve; use
+// a Cluster with Tablespaces otherwise.
+func LoadSchema(datadir, dbname, tablename string) ([]heappage.ColumnDef, error) {
+	major, err := ReadMajor(datadir)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckMajor(major); err != nil {
+		return nil, err
+	}
+	c := &Cluster{DataDir: datadir, Major: major, Options: heappage.DefaultOptions()}
+	ctx := context.Background()
+	loc, err := c.LocateTable(ctx, dbname, tablename)
+	if err != nil {
+		return nil, err
+	}
+	if enc, err := heappage.EncodingByID(loc.Encoding); err == nil {
+		c.Options.Encoding = enc
+	}
+	return c.TableSchema(ctx, loc)
+}
+
+// TableLocation is what LocateTable finds out about a table.
+type TableLocation struct {
+	DatabaseOid heappage.Oid
+	Encoding    int32 // pg_database.encoding, see heappage.EncodingByID
+	RelOid      heappage.Oid
+	Path        string // main fork, first segment
+}
+
+// LocateTable finds table tablename in database dbname. tablename may be
+// qualified with a namespace oid as "2200.t" when the bare name is
+// ambiguous.
+func (c *Cluster) LocateTable(ctx context.Context, dbname, tablename string) (*TableLocation, error) {
+	dbFile, err := catalogFile(filepath.Join(c.DataDir, "global"), DatabaseRelationID)
+	if err != nil {
+		return nil, err
+	}
+	var dbOid heappage.Oid
+	var encoding int32
+	err = c.scanCatalog(ctx, dbFile, pgDatabasePrefix, []int{1, 2, 4}, func(vals []any) error {
+		if vals[1] == dbname {
+			dbOid, encoding = vals[0].(heappage.Oid), vals[2].(int32)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pg_database: %w", err)
+	}
+	if dbOid == 0 {
+		return nil, fmt.Errorf("database %q not found", dbname)
+	}
+
+	var nsp string
+	if i := strings.IndexByte(tablename, '.'); i > 0 {
+		nsp, tablename = tablename[:i], tablename[i+1:]
+	}
+	dbDir := filepath.Join(c.DataDir, "base", fmt.Sprint(dbOid))
+	classFile, err := catalogFile(dbDir, RelationRelationID)
+	if err != nil {
+		return nil, err
+	}
+	var found []TableLocation
+	var namespaces []string
+	err = c.scanCatalog(ctx, classFile, pgClassPrefix, []int{1, 2, 3, 8, 9}, func(vals []any) error {
+		if vals[1] != tablename || (nsp != "" && fmt.Sprint(vals[2]) != nsp) {
+			return nil
+		}
+		if vals[3].(heappage.Oid) == 0 {
+			return fmt.Errorf("%s is a mapped catalog (relfilenode 0); its file is in pg_filenode.map", tablename)
+		}
+		// reltablespace 0 is the database's default tablespace, taken to
+		// be pg_default: dattablespace is not read
+		dir, err := c.DatabaseDir(vals[4].(heappage.Oid), dbOid)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tablename, err)
+		}
+		found = append(found, TableLocation{
+			DatabaseOid: dbOid,
+			Encoding:    encoding,
+			RelOid:      vals[0].(heappage.Oid),
+			Path:        filepath.Join(dir, fmt.Sprint(vals[3])),
+		})
+		namespaces = append(namespaces, fmt.Sprint(vals[2]))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pg_class: %w", err)
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("relation %q not found in database %q", tablename, dbname)
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, fmt.Errorf("relation %q exists in namespaces %s; qualify it as <namespace oid>.%s",
+			tablename, strings.Join(namespaces, ", "), tablename)
+	}
+}
+
+// TableSchema reads the columns of a table LocateTable found, ready for
+// heappage.DecodeRow. attname is stored in the database encoding, so
+// Options.Encoding should be set from loc.Encoding first.
+func (c *Cluster) TableSchema(ctx context.Context, loc *TableLocation) ([]heappage.ColumnDef, error) {
+	attrFile, err := catalogFile(filepath.Join(c.DataDir, "base", fmt.Sprint(loc.DatabaseOid)), AttributeRelationID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(attrFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cols, err := TableColumns(ctx, f, loc.RelOid, c.Major, c.Options)
+	if err != nil {
+		return nil, fmt.Errorf("pg_attribute: %w", err)
+	}
+	return cols, nil
+}
+
+func (c *Cluster) scanCatalog(ctx context.Context, path string, cols []heappage.ColumnDef, attrs []int, fn func(vals []any) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return scanLiveRows(ctx, f, cols, attrs, c.Options, fn)
+}
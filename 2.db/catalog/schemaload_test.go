@@ -0,0 +1,125 @@
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage/heaptest"
+)
+
+// pgClassRow is the leading pg_class columns of an ordinary table in
+// namespace nsp owned by role 10.
+func pgClassRow(oid uint32, name string, nsp, filenode uint32) []any {
+	return []any{oid, name, nsp, oid + 2, uint32(0), uint32(10), uint32(2), filenode, uint32(0)}
+}
+
+// testCluster writes a data directory of major v: database "app" (oid
+// 16400) whose pg_class and pg_attribute are mapped to other filenodes, and
+// in which table "accounts" is relation 16384 of the pg_attribute fixture
+// with relfilenode 16500, and "nocols" has no pg_attribute rows.
+// pg_database has no map file and is found by oid.
+func testCluster(t *testing.T, v int) string {
+	t.Helper()
+	dir := t.TempDir()
+	dbDir := filepath.Join(dir, "base", "16400")
+	if err := os.MkdirAll(dbDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "global"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dbs := heaptest.Page(t, 0,
+		heaptest.Tuple(t, pgDatabasePrefix, []any{uint32(1), "template1", uint32(10), int32(6)}),
+		heaptest.Tuple(t, pgDatabasePrefix, []any{uint32(16400), "app", uint32(10), int32(6)}),
+	)
+	classes := heaptest.Page(t, 0,
+		heaptest.Tuple(t, pgClassPrefix, pgClassRow(16384, "accounts", 2200, 16500)),
+		heaptest.Tuple(t, pgClassPrefix, pgClassRow(16385, "other", 2200, 16385)),
+		heaptest.Tuple(t, pgClassPrefix, pgClassRow(16390, "nocols", 2200, 16390)),
+	)
+	files := map[string][]byte{
+		"PG_VERSION": []byte(fmt.Sprintf("%d\n", v)),
+		filepath.Join("global", fmt.Sprint(DatabaseRelationID)): dbs,
+		filepath.Join(dbDir, "pg_filenode.map"): relMapFile(v,
+			RelMapping{OID: uint32(RelationRelationID), Filenode: 16010},
+			RelMapping{OID: uint32(AttributeRelationID), Filenode: 16011}),
+		filepath.Join(dbDir, "16010"): classes,
+		filepath.Join(dbDir, "16011"): readFixture(t, v),
+	}
+	for name, data := range files {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadSchema(t *testing.T) {
+	for _, v := range catalogVersions {
+		t.Run(fmt.Sprintf("pg%d", v), func(t *testing.T) {
+			dir := testCluster(t, v)
+			cols, err := LoadSchema(dir, "app", "accounts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cols, table16384) {
+				t.Errorf("LoadSchema = %+v, want %+v", cols, table16384)
+			}
+
+			c := &Cluster{DataDir: dir, Major: v}
+			loc, err := c.LocateTable(t.Context(), "app", "2200.accounts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := TableLocation{DatabaseOid: 16400, Encoding: 6, RelOid: 16384,
+				Path: filepath.Join(dir, "base", "16400", "16500")}
+			if *loc != want {
+				t.Errorf("LocateTable = %+v, want %+v", *loc, want)
+			}
+		})
+	}
+}
+
+func TestLoadSchemaErrors(t *testing.T) {
+	dir := testCluster(t, 16)
+	for _, tt := range []struct{ db, table, want string }{
+		{"nope", "accounts", `database "nope" not found`},
+		{"app", "nope", `relation "nope" not found in database "app"`},
+		{"app", "11.accounts", `relation "accounts" not found`},
+		{"app", "nocols", "no pg_attribute rows for relation 16390"},
+	} {
+		if _, err := LoadSchema(dir, tt.db, tt.table); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadSchema(%q, %q) = %v, want %q", tt.db, tt.table, err, tt.want)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "PG_VERSION"), []byte("17\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSchema(dir, "app", "accounts"); err == nil {
+		t.Error("PG_VERSION 17: no error")
+	}
+	if _, err := LoadSchema(t.TempDir(), "app", "accounts"); err == nil {
+		t.Error("no PG_VERSION: no error")
+	}
+}
+
+// The mapped pg_class must be read through the map file: with the map gone
+// LocateTable looks for base/16400/1259.
+func TestLocateTableUsesRelMap(t *testing.T) {
+	dir := testCluster(t, 16)
+	if err := os.Remove(filepath.Join(dir, "base", "16400", "pg_filenode.map")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := (&Cluster{DataDir: dir}).LocateTable(t.Context(), "app", "accounts")
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprint(RelationRelationID)) {
+		t.Errorf("LocateTable without the map file = %v", err)
+	}
+}
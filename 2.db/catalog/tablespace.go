@@ -0,0 +1,100 @@
+package catalog
+
+// Relations outside the default tablespace (catalog/catalog.h,
+// common/relpath.c). A tablespace is a directory created by CREATE
+// TABLESPACE and linked from pg_tblspc/<spcoid>; each major version keeps its
+// files in a PG_<major>_<catversion> subdirectory of it, so after pg_upgrade
+// there can be two:
+//
+//	pg_tblspc/<spcoid>/PG_15_202209061/<dboid>/<relfilenode>
+//
+// When the link does not resolve on this machine (a data directory copied
+// without its tablespaces), Cluster.Tablespaces gives the location
+// explicitly.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+const (
+	DefaultTablespaceOid heappage.Oid = 1663 // pg_default: base/
+	GlobalTablespaceOid  heappage.Oid = 1664 // pg_global: global/
+)
+
+// ParseTablespaceDirs parses tablespace locations for Cluster.Tablespaces
+// given as oid=dir,oid=dir.
+func ParseTablespaceDirs(spec string) (map[heappage.Oid]string, error) {
+	dirs := map[heappage.Oid]string{}
+	for _, part := range strings.Split(spec, ",") {
+		oid, dir, ok := strings.Cut(strings.TrimSpace(part), "=")
+		n, err := strconv.ParseUint(oid, 10, 32)
+		if !ok || err != nil || n == 0 || dir == "" {
+			return nil, fmt.Errorf("bad tablespace %q, want <oid>=<directory>", part)
+		}
+		dirs[heappage.Oid(n)] = dir
+	}
+	return dirs, nil
+}
+
+var tablespaceVersionDir = regexp.MustCompile(`^PG_(\d+)_(\d+)$`)
+
+// DatabaseDir returns the directory holding database dbOid's files in
+// tablespace spcOid (0 meaning the default).
+func (c *Cluster) DatabaseDir(spcOid, dbOid heappage.Oid) (string, error) {
+	switch spcOid {
+	case 0, DefaultTablespaceOid:
+		return filepath.Join(c.DataDir, "base", fmt.Sprint(dbOid)), nil
+	case GlobalTablespaceOid:
+		return filepath.Join(c.DataDir, "global"), nil
+	}
+	loc, ok := c.Tablespaces[spcOid]
+	if !ok {
+		loc = filepath.Join(c.DataDir, "pg_tblspc", fmt.Sprint(spcOid))
+	}
+	verDir, err := tablespaceVersion(loc, c.Major)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("tablespace %d: %w (its location can be given explicitly)", spcOid, err)
+	} else if err != nil {
+		return "", fmt.Errorf("tablespace %d: %w", spcOid, err)
+	}
+	return filepath.Join(loc, verDir, fmt.Sprint(dbOid)), nil
+}
+
+// tablespaceVersion picks the PG_<major>_<catversion> directory of a
+// tablespace location: the only one, or the one for major if not 0.
+func tablespaceVersion(loc string, major int) (string, error) {
+	entries, err := os.ReadDir(loc)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, e := range entries {
+		m := tablespaceVersionDir.FindStringSubmatch(e.Name())
+		if m == nil || !e.IsDir() {
+			continue
+		}
+		if v, _ := strconv.Atoi(m[1]); major != 0 && v != major {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("no PG_<major>_<catversion> directory in %s", loc)
+	case 1:
+		return names[0], nil
+	default:
+		return "", fmt.Errorf("%s has %s; pick one by major version", loc, strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,120 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// tablespaceCluster lays out a data directory whose tablespace 16500 lives
+// outside it, linked from pg_tblspc, with a version directory for each of
+// majors, as pg_upgrade leaves them. It returns the data directory and the
+// tablespace's location.
+func tablespaceCluster(t *testing.T, majors ...string) (string, string) {
+	datadir, loc := t.TempDir(), t.TempDir()
+	for _, ver := range majors {
+		rel := filepath.Join(loc, ver, "16384", "16390")
+		if err := os.MkdirAll(filepath.Dir(rel), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(rel, make([]byte, heappage.PageSize), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(datadir, "pg_tblspc"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(loc, filepath.Join(datadir, "pg_tblspc", "16500")); err != nil {
+		t.Skip(err)
+	}
+	return datadir, loc
+}
+
+// A relation in a tablespace is found through the pg_tblspc link as
+// PG_<major>_<catversion>/<dboid>/<relfilenode>.
+func TestDatabaseDirTablespace(t *testing.T) {
+	datadir, loc := tablespaceCluster(t, "PG_15_202209061")
+	for _, major := range []int{0, 15} {
+		dir, err := (&Cluster{DataDir: datadir, Major: major}).DatabaseDir(16500, 16384)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := filepath.Join(datadir, "pg_tblspc", "16500", "PG_15_202209061", "16384")
+		if dir != want {
+			t.Errorf("major %d: got %s, want %s", major, dir, want)
+		}
+		got, err := filepath.EvalSymlinks(filepath.Join(dir, "16390"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if real, _ := filepath.EvalSymlinks(filepath.Join(loc, "PG_15_202209061", "16384", "16390")); got != real {
+			t.Errorf("major %d: relation file resolves to %s, want %s", major, got, real)
+		}
+	}
+
+	c := &Cluster{DataDir: datadir, Major: 14}
+	if _, err := c.DatabaseDir(16500, 16384); err == nil || !strings.Contains(err.Error(), "no PG_<major>_<catversion> directory") {
+		t.Errorf("major 14: %v", err)
+	}
+	for spc, want := range map[heappage.Oid]string{
+		0:                    filepath.Join(datadir, "base", "16384"),
+		DefaultTablespaceOid: filepath.Join(datadir, "base", "16384"),
+		GlobalTablespaceOid:  filepath.Join(datadir, "global"),
+	} {
+		if dir, err := c.DatabaseDir(spc, 16384); dir != want || err != nil {
+			t.Errorf("tablespace %d: got %s, %v; want %s", spc, dir, err, want)
+		}
+	}
+}
+
+// After pg_upgrade a tablespace holds the old and the new version's
+// directories; the major picks one.
+func TestDatabaseDirUpgradedTablespace(t *testing.T) {
+	datadir, _ := tablespaceCluster(t, "PG_14_202107181", "PG_15_202209061")
+	for major, want := range map[int]string{14: "PG_14_202107181", 15: "PG_15_202209061"} {
+		dir, err := (&Cluster{DataDir: datadir, Major: major}).DatabaseDir(16500, 16384)
+		if err != nil || filepath.Base(filepath.Dir(dir)) != want {
+			t.Errorf("major %d: got %s, %v; want %s", major, dir, err, want)
+		}
+	}
+	_, err := (&Cluster{DataDir: datadir}).DatabaseDir(16500, 16384)
+	if err == nil || !strings.Contains(err.Error(), "has PG_14_202107181, PG_15_202209061; pick one by major version") {
+		t.Errorf("no major: %v", err)
+	}
+}
+
+// A data directory copied without its tablespaces has a dangling link;
+// Tablespaces gives the location instead.
+func TestDatabaseDirMovedTablespace(t *testing.T) {
+	datadir, loc := tablespaceCluster(t, "PG_16_202307071")
+	moved := filepath.Join(t.TempDir(), "moved")
+	if err := os.Rename(loc, moved); err != nil {
+		t.Fatal(err)
+	}
+	c := &Cluster{DataDir: datadir, Major: 16}
+	if _, err := c.DatabaseDir(16500, 16384); err == nil || !strings.Contains(err.Error(), "its location can be given explicitly") {
+		t.Errorf("dangling link: %v", err)
+	}
+	c.Tablespaces = map[heappage.Oid]string{16500: moved}
+	dir, err := c.DatabaseDir(16500, 16384)
+	if want := filepath.Join(moved, "PG_16_202307071", "16384"); dir != want || err != nil {
+		t.Errorf("got %s, %v; want %s", dir, err, want)
+	}
+}
+
+func TestParseTablespaceDirs(t *testing.T) {
+	got, err := ParseTablespaceDirs("16500=/mnt/ts1, 16501=/mnt/ts2")
+	want := map[heappage.Oid]string{16500: "/mnt/ts1", 16501: "/mnt/ts2"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, %v; want %v", got, err, want)
+	}
+	for _, bad := range []string{"", "16500", "16500=", "0=/mnt", "ts=/mnt"} {
+		if _, err := ParseTablespaceDirs(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
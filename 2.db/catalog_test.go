@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// useCatalogVersion is UseCatalogVersion for one test, undone after it.
+func useCatalogVersion(t *testing.T, v int) {
+	t.Helper()
+	major, legacy := catalogMajor, decodeOptions.LegacyAclItem
+	t.Cleanup(func() {
+		catalogMajor, decodeOptions.LegacyAclItem = major, legacy
+	})
+	if err := UseCatalogVersion(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUseCatalogVersion(t *testing.T) {
+	for _, v := range []int{11, 17} {
+		if err := UseCatalogVersion(v); err == nil {
+			t.Errorf("UseCatalogVersion(%d): no error", v)
+		}
+	}
+	for _, tt := range []struct {
+		v       int
+		aclitem int
+	}{{12, 12}, {15, 12}, {16, 16}} {
+		t.Run(fmt.Sprint(tt.v), func(t *testing.T) {
+			useCatalogVersion(t, tt.v)
+			if typ, _ := decodeOptions.LookupType(heappage.ACLITEMOID); typ.Len != tt.aclitem {
+				t.Errorf("aclitem is %d bytes, want %d", typ.Len, tt.aclitem)
+			}
+		})
+	}
+}
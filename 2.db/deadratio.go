@@ -0,0 +1,150 @@
+package main
+
+// Dead-tuple report (-dead-ratio): a rough, offline pgstattuple for deciding
+// whether a table needs VACUUM. Only line pointers and tuple header hint
+// bits are read, so a deleter whose commit was never hinted counts as live,
+// and the figures are a lower bound of what VACUUM would find.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// DeadCounts is the dead-tuple tally of one page or of the whole relation.
+// Dead covers LP_DEAD pointers and LP_NORMAL tuples whose inserter aborted
+// or whose deleter committed; Reclaimable is the tuple storage VACUUM would
+// free, MAXALIGNed like PageAddItem lays it out.
+type DeadCounts struct {
+	Tuples      int `json:"tuples"`
+	Dead        int `json:"dead"`
+	Reclaimable int `json:"reclaimable_bytes"`
+}
+
+func (c *DeadCounts) add(o DeadCounts) {
+	c.Tuples += o.Tuples
+	c.Dead += o.Dead
+	c.Reclaimable += o.Reclaimable
+}
+
+// Ratio is Dead/Tuples in percent, 0 for no tuples.
+func (c DeadCounts) Ratio() float64 {
+	if c.Tuples == 0 {
+		return 0
+	}
+	return 100 * float64(c.Dead) / float64(c.Tuples)
+}
+
+// tupleIsDead reports a tuple that no snapshot can see any more, as far as
+// the hint bits tell.
+func tupleIsDead(rh *heappage.RowHeader) bool {
+	if rh.XminInvalid() {
+		return true
+	}
+	return rh.Xmax != 0 && rh.XmaxCommitted() && !rh.XmaxIsLockedOnly()
+}
+
+func pageDeadCounts(page []byte, items []heappage.ItemID) DeadCounts {
+	var c DeadCounts
+	for _, it := range items {
+		switch it.Flags {
+		case heappage.LP_DEAD:
+			c.Tuples++
+			c.Dead++
+			c.Reclaimable += maxAlign(int(it.LpLen)) // lp_len is 0 once pruning freed it
+		case heappage.LP_NORMAL:
+			c.Tuples++
+			start, end := int(it.LpOff), int(it.LpOff)+int(it.LpLen)
+			if start >= end || end > len(page) {
+				continue
+			}
+			rh, err := heappage.ParseRowHeader(page[start:end])
+			if err == nil && tupleIsDead(rh) {
+				c.Dead++
+				c.Reclaimable += maxAlign(int(it.LpLen))
+			}
+		}
+	}
+	return c
+}
+
+type PageDeadCounts struct {
+	Page int `json:"page"`
+	DeadCounts
+}
+
+type DeadReport struct {
+	Pages     []PageDeadCounts `json:"pages"`
+	Total     DeadCounts       `json:"total"`
+	Threshold float64          `json:"threshold_percent"`
+}
+
+func collectDeadCounts(ctx context.Context, rel Relation, opts DumpOptions) (*DeadReport, error) {
+	nPages, err := relationPages(rel)
+	if err != nil {
+		return nil, err
+	}
+	rep := &DeadReport{Pages: []PageDeadCounts{}}
+	prog := newScanProgress(nPages, opts)
+	err = heappage.ScanRange(ctx, rel, 0, nPages, withProgress(prog, func(p *heappage.Page, err error) error {
+		if err != nil {
+			var pe *heappage.PageError
+			if !opts.SkipErrors || !errors.As(err, &pe) {
+				return err
+			}
+			logSkippedPage(pe)
+			return nil
+		}
+		c := pageDeadCounts(p.Raw, p.Items)
+		rep.Pages = append(rep.Pages, PageDeadCounts{p.No, c})
+		rep.Total.add(c)
+		return nil
+	}))
+	if prog != nil {
+		prog.Done()
+	}
+	return rep, err
+}
+
+// deadRatioReport prints the report; threshold is the dead percentage from
+// which VACUUM is suggested.
+func deadRatioReport(ctx context.Context, filePath string, threshold float64, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rep, err := collectDeadCounts(ctx, f, opts)
+	if err != nil {
+		return err
+	}
+	rep.Threshold = threshold
+	if opts.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	return writeDeadReportText(os.Stdout, rep)
+}
+
+func writeDeadReportText(w io.Writer, rep *DeadReport) error {
+	fmt.Fprintf(w, "%6s  %6s  %6s  %6s  %11s\n", "page", "tuples", "dead", "ratio", "reclaimable")
+	for _, p := range rep.Pages {
+		fmt.Fprintf(w, "%6d  %6d  %6d  %5.1f%%  %11d\n", p.Page, p.Tuples, p.Dead, p.Ratio(), p.Reclaimable)
+	}
+	t := rep.Total
+	fmt.Fprintf(w, "total: %d tuples, %d dead (%.1f%%), ~%d bytes reclaimable\n",
+		t.Tuples, t.Dead, t.Ratio(), t.Reclaimable)
+	hint := "VACUUM not needed yet"
+	if t.Tuples > 0 && t.Ratio() >= rep.Threshold {
+		hint = "VACUUM likely beneficial"
+	}
+	_, err := fmt.Fprintf(w, "dead ratio %.0f%% (threshold %.0f%%): %s\n", t.Ratio(), rep.Threshold, hint)
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+// Line-pointer density map: one row of glyphs per page, for eyeballing bloat
+// and fragmentation across a whole relation.
+//
+//	#  LP_NORMAL (live)
+//	.  LP_UNUSED
+//	x  LP_DEAD
+//	>  LP_REDIRECT
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+const densityMapWidth = 64 // max glyphs per row
+
+var lpGlyphs = [4]byte{
+	heappage.LP_UNUSED:   '.',
+	heappage.LP_NORMAL:   '#',
+	heappage.LP_REDIRECT: '>',
+	heappage.LP_DEAD:     'x',
+}
+
+// LPCounts tallies line pointers by flag.
+type LPCounts struct {
+	Unused, Normal, Redirect, Dead int
+}
+
+func countItemIDs(items []heappage.ItemID) LPCounts {
+	var c LPCounts
+	for _, it := range items {
+		switch it.Flags {
+		case heappage.LP_UNUSED:
+			c.Unused++
+		case heappage.LP_NORMAL:
+			c.Normal++
+		case heappage.LP_REDIRECT:
+			c.Redirect++
+		case heappage.LP_DEAD:
+			c.Dead++
+		}
+	}
+	return c
+}
+
+func densityRow(items []heappage.ItemID) string {
+	var sb strings.Builder
+	for i, it := range items {
+		if i == densityMapWidth {
+			fmt.Fprintf(&sb, "+%d", len(items)-i)
+			break
+		}
+		sb.WriteByte(lpGlyphs[it.Flags&0x03])
+	}
+	return sb.String()
+}
+
+// densityMap prints one glyph row per page of the relation file.
+func densityMap(ctx context.Context, filePath string) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	nPages, err := relationPages(f)
+	if err != nil {
+		return err
+	}
+
+	var total LPCounts
+	err = heappage.ScanRange(ctx, f, 0, nPages, func(p *heappage.Page, err error) error {
+		if err != nil {
+			return err
+		}
+		c := countItemIDs(p.Items)
+		total.Normal += c.Normal
+		total.Dead += c.Dead
+		fmt.Printf("%6d  %-*s  live=%d dead=%d\n",
+			p.No, densityMapWidth, densityRow(p.Items), c.Normal, c.Dead)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("pages=%d live=%d dead=%d\n", nPages, total.Normal, total.Dead)
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+// -format dot: the page layout as a Graphviz diagram, for teaching. Each
+// page is a cluster with the header, the line pointer array, the free space
+// gap and one box per tuple; line pointers point at their tuples, REDIRECT
+// pointers at the line pointer they forward to, and a t_ctid that names
+// another tuple on the same page (an update or HOT chain) at that tuple.
+//
+//	pgheap -file ... -format dot | dot -Tsvg > page.svg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+type DotWriter struct {
+	w       io.Writer
+	started bool
+	page    *PageDump
+	tuples  []TupleDump
+}
+
+func NewDotWriter(w io.Writer) *DotWriter { return &DotWriter{w: w} }
+
+func (d *DotWriter) WritePage(pd PageDump) error {
+	if err := d.flushPage(); err != nil {
+		return err
+	}
+	d.page, d.tuples = &pd, nil
+	return nil
+}
+
+func (d *DotWriter) WriteTuple(td TupleDump) error {
+	if d.page == nil {
+		return fmt.Errorf("tuple before page")
+	}
+	d.tuples = append(d.tuples, td)
+	return nil
+}
+
+func (d *DotWriter) Finish() error {
+	if err := d.flushPage(); err != nil {
+		return err
+	}
+	if !d.started {
+		d.start()
+	}
+	_, err := fmt.Fprintln(d.w, "}")
+	return err
+}
+
+func (d *DotWriter) start() {
+	d.started = true
+	fmt.Fprintln(d.w, "digraph heap {")
+	fmt.Fprintln(d.w, "  rankdir=LR;")
+	fmt.Fprintln(d.w, "  node [shape=record, fontname=\"monospace\", fontsize=10];")
+}
+
+// flushPage writes the page collected so far as one cluster.
+func (d *DotWriter) flushPage() error {
+	if d.page == nil {
+		return nil
+	}
+	if !d.started {
+		d.start()
+	}
+	pd := d.page
+	id := func(name string) string { return fmt.Sprintf("p%d_%s", pd.Page, name) }
+	w := d.w
+
+	fmt.Fprintf(w, "  subgraph cluster_p%d {\n", pd.Page)
+	fmt.Fprintf(w, "    label=\"page %d\";\n", pd.Page)
+	fmt.Fprintf(w, "    %s [label=\"{PageHeaderData|lsn=%s|pd_lower=%d|pd_upper=%d|pd_special=%d}\"];\n",
+		id("hdr"), pd.LSN, pd.Lower, pd.Upper, pd.Special)
+	if pd.New {
+		fmt.Fprintf(w, "    %s [label=\"new page (all zero)\", shape=box, style=dashed];\n", id("free"))
+		fmt.Fprintln(w, "  }")
+		d.page = nil
+		return nil
+	}
+
+	ports := make([]string, len(d.tuples))
+	for i, td := range d.tuples {
+		ports[i] = fmt.Sprintf("<lp%d> %d: %s off=%d len=%d", td.Offset, td.Offset, td.State, td.LpOff, td.LpLen)
+	}
+	lps := "{line pointers (none)}"
+	if len(ports) > 0 {
+		lps = "{line pointers|" + strings.Join(ports, "|") + "}"
+	}
+	fmt.Fprintf(w, "    %s [label=%q];\n", id("lps"), lps)
+	fmt.Fprintf(w, "    %s [label=\"free space\\n%d bytes\\n(pd_lower..pd_upper)\", shape=box, style=dashed];\n",
+		id("free"), pd.Free)
+	fmt.Fprintf(w, "    %s -> %s -> %s [style=invis];\n", id("hdr"), id("lps"), id("free"))
+
+	// tuples, and which line pointer each one sits at
+	tupleAt := map[heappage.OffsetNumber]bool{}
+	for _, td := range d.tuples {
+		if td.Header == nil {
+			continue
+		}
+		tupleAt[td.Offset] = true
+		h := td.Header
+		fmt.Fprintf(w, "    %s [label=%q];\n", id(fmt.Sprintf("t%d", td.Offset)),
+			fmt.Sprintf("{tuple @%d, %d bytes|xmin=%d xmax=%d|t_ctid=%s}", td.LpOff, td.LpLen, h.Xmin, h.Xmax, h.CTID))
+		fmt.Fprintf(w, "    %s -> %s [style=invis];\n", id("free"), id(fmt.Sprintf("t%d", td.Offset)))
+	}
+	if pd.Special < heappage.PageSize {
+		fmt.Fprintf(w, "    %s [label=\"special space\\n%d bytes\", shape=box];\n", id("special"), heappage.PageSize-int(pd.Special))
+	}
+	fmt.Fprintln(w, "  }")
+
+	for _, td := range d.tuples {
+		lp := fmt.Sprintf("%s:lp%d", id("lps"), td.Offset)
+		switch {
+		case tupleAt[td.Offset]:
+			fmt.Fprintf(w, "  %s -> %s;\n", lp, id(fmt.Sprintf("t%d", td.Offset)))
+		case td.Flags == heappage.LP_REDIRECT && int(td.Redirect) >= 1 && int(td.Redirect) <= len(d.tuples):
+			fmt.Fprintf(w, "  %s -> %s:lp%d [style=dashed, label=\"redirect\"];\n", lp, id("lps"), td.Redirect)
+		}
+		if td.Header == nil {
+			continue
+		}
+		var blk heappage.BlockNumber
+		var off heappage.OffsetNumber
+		if _, err := fmt.Sscanf(td.Header.CTID, "(%d,%d)", &blk, &off); err != nil {
+			continue // speculative token or moved-partitions marker
+		}
+		if int(blk) == pd.Page && off != td.Offset && tupleAt[off] {
+			fmt.Fprintf(w, "  %s -> %s [color=blue, label=\"t_ctid\"];\n",
+				id(fmt.Sprintf("t%d", td.Offset)), id(fmt.Sprintf("t%d", off)))
+		}
+	}
+	d.page = nil
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+// Capacity math: how many tuples fit on a heap page.
+//
+// Each tuple costs MAXALIGN(tuple size) bytes in the tuple area plus a 4-byte
+// line pointer; the page header is taken off the top.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// MaxTuplesPerPage is MaxHeapTuplesPerPage for the given block size: the
+// limit reached with header-only (zero-column) tuples.
+func MaxTuplesPerPage(blocksize int) int {
+	return (blocksize - heappage.PageHeaderByteLen) / (maxAlign(heappage.RowHeaderByteLen) + heappage.ItemIDByteLen)
+}
+
+// EstimateTuplesPerPage returns how many tuples of tupleSize bytes (header
+// included) fit on one page.
+func EstimateTuplesPerPage(blocksize, tupleSize int) int {
+	if tupleSize < heappage.RowHeaderByteLen {
+		tupleSize = heappage.RowHeaderByteLen
+	}
+	n := (blocksize - heappage.PageHeaderByteLen) / (maxAlign(tupleSize) + heappage.ItemIDByteLen)
+	if m := MaxTuplesPerPage(blocksize); n > m {
+		n = m
+	}
+	return n
+}
+
+// runEstimate parses a "tuplesize=N" spec and prints the estimate.
+func runEstimate(spec string) error {
+	key, val, ok := strings.Cut(spec, "=")
+	if !ok || key != "tuplesize" {
+		return fmt.Errorf("bad -estimate %q, want tuplesize=N", spec)
+	}
+	size, err := strconv.Atoi(val)
+	if err != nil || size <= 0 {
+		return fmt.Errorf("bad tuple size %q", val)
+	}
+
+	fmt.Printf("blocksize=%d tuplesize=%d aligned=%d per-tuple=%d (+%d line pointer)\n",
+		heappage.PageSize, size, maxAlign(size), maxAlign(size)+heappage.ItemIDByteLen, heappage.ItemIDByteLen)
+	fmt.Printf("tuples per page: %d (max %d)\n",
+		EstimateTuplesPerPage(heappage.PageSize, size), MaxTuplesPerPage(heappage.PageSize))
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// MaxTuplesPerPage is MaxHeapTuplesPerPage (htup_details.h), which also
+// bounds the ctid offsets -salvage accepts.
+func TestMaxTuplesPerPage(t *testing.T) {
+	for blocksize, want := range map[int]int{8192: 291, 16384: 584, 32768: 1169} {
+		if got := MaxTuplesPerPage(blocksize); got != want {
+			t.Errorf("MaxTuplesPerPage(%d) = %d, want %d", blocksize, got, want)
+		}
+	}
+	for _, tt := range []struct{ size, want int }{{1, 291}, {24, 291}, {25, 226}, {64, 120}, {2032, 4}} {
+		if got := EstimateTuplesPerPage(heappage.PageSize, tt.size); got != tt.want {
+			t.Errorf("EstimateTuplesPerPage(8192, %d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+
+	rh := &heappage.RowHeader{Xmin: 100, InfoMask2: 2, InfoMask: heappage.HEAP_XMAX_INVALID, Hoff: 24}
+	for offset, ok := range map[heappage.OffsetNumber]bool{1: true, 291: true, 292: false, 0: false} {
+		rh.CTIDOffset = offset
+		if err := plausibleRowHeader(rh); (err == nil) != ok {
+			t.Errorf("ctid offset %d: %v", offset, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+// -explain: plain-English notes printed under the text dump, for people
+// learning the on-disk format. Nothing here changes what is decoded.
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+type flagNote struct {
+	mask uint16
+	note string
+}
+
+var pageFlagNotes = []flagNote{
+	{heappage.PD_HAS_FREE_LINES, "PD_HAS_FREE_LINES: some line pointers are LP_UNUSED and can be reused before the array grows"},
+	{heappage.PD_PAGE_FULL, "PD_PAGE_FULL: a recent UPDATE found no room here; a hint that pruning may help"},
+	{heappage.PD_ALL_VISIBLE, "PD_ALL_VISIBLE: every tuple is visible to every transaction (mirrored in the visibility map)"},
+}
+
+var infomaskNotes = []flagNote{
+	{heappage.HEAP_HASNULL, "HEAP_HASNULL: a NULL bitmap follows the fixed header; a 0 bit marks a NULL column"},
+	{heappage.HEAP_HASVARWIDTH, "HEAP_HASVARWIDTH: the row has variable-width (varlena) columns"},
+	{heappage.HEAP_HASEXTERNAL, "HEAP_HASEXTERNAL: some column is a TOAST pointer; the value lives in the TOAST table"},
+	{heappage.HEAP_HASOID_OLD, "HEAP_HASOID_OLD: pre-PG12 WITH OIDS row; the oid sits just before t_hoff"},
+	{heappage.HEAP_XMAX_KEYSHR_LOCK, "HEAP_XMAX_KEYSHR_LOCK: xmax holds a FOR KEY SHARE lock"},
+	{heappage.HEAP_COMBOCID, "HEAP_COMBOCID: t_cid is a combo cid standing for both cmin and cmax"},
+	{heappage.HEAP_XMAX_EXCL_LOCK, "HEAP_XMAX_EXCL_LOCK: xmax holds an exclusive (FOR UPDATE / NO KEY UPDATE) lock"},
+	{heappage.HEAP_XMAX_LOCK_ONLY, "HEAP_XMAX_LOCK_ONLY: xmax only locked the row, it did not delete or update it"},
+	{heappage.HEAP_XMIN_COMMITTED, "HEAP_XMIN_COMMITTED: hint bit, the inserting transaction is known committed"},
+	{heappage.HEAP_XMIN_INVALID, "HEAP_XMIN_INVALID: hint bit, the inserting transaction is known aborted"},
+	{heappage.HEAP_XMAX_COMMITTED, "HEAP_XMAX_COMMITTED: hint bit, the deleting/updating transaction is known committed"},
+	{heappage.HEAP_XMAX_INVALID, "HEAP_XMAX_INVALID: hint bit, xmax is unset or aborted, so the row was not deleted"},
+	{heappage.HEAP_XMAX_IS_MULTI, "HEAP_XMAX_IS_MULTI: xmax is a MultiXactId (several lockers), not a plain xid"},
+	{heappage.HEAP_UPDATED, "HEAP_UPDATED: this row is the new version produced by an UPDATE"},
+	{heappage.HEAP_MOVED_OFF, "HEAP_MOVED_OFF: moved away by pre-9.0 VACUUM FULL"},
+	{heappage.HEAP_MOVED_IN, "HEAP_MOVED_IN: moved here by pre-9.0 VACUUM FULL"},
+}
+
+var infomask2Notes = []flagNote{
+	{heappage.HEAP_KEYS_UPDATED, "HEAP_KEYS_UPDATED: deleted, or updated with a change to key columns"},
+	{heappage.HEAP_HOT_UPDATED, "HEAP_HOT_UPDATED: updated in place (HOT); t_ctid points to the newer version on this page"},
+	{heappage.HEAP_ONLY_TUPLE, "HEAP_ONLY_TUPLE: a HOT version, reachable only through the chain, not from indexes"},
+}
+
+var lpStateNotes = [4]string{
+	heappage.LP_UNUSED:   "LP_UNUSED: free slot, no storage; may be reused by the next insert",
+	heappage.LP_NORMAL:   "LP_NORMAL: lp_off/lp_len locate a tuple in the page body",
+	heappage.LP_REDIRECT: "LP_REDIRECT: HOT chain head after pruning; lp_off is the offset number to follow",
+	heappage.LP_DEAD:     "LP_DEAD: the tuple is dead; its storage may already be reclaimed",
+}
+
+func writeNotes(w io.Writer, indent string, notes ...string) {
+	for _, n := range notes {
+		fmt.Fprintf(w, "%s# %s\n", indent, n)
+	}
+}
+
+func setFlagNotes(mask uint16, table []flagNote) []string {
+	var out []string
+	for _, f := range table {
+		if mask&f.mask == f.mask {
+			out = append(out, f.note)
+		}
+	}
+	return out
+}
+
+func explainPage(w io.Writer, pd PageDump) {
+	if pd.New {
+		writeNotes(w, "", "an all-zero page was extended but never initialized; PostgreSQL treats it as empty")
+		return
+	}
+	writeNotes(w, "",
+		fmt.Sprintf("the 24-byte header is followed by %d line pointers of 4 bytes each, ending at pd_lower=%d", pd.LinePointers, pd.Lower),
+		"pd_lower grows up as line pointers are added; pd_upper moves down as tuples are inserted from the end",
+		fmt.Sprintf("the gap between them (%d bytes) is the free space; pd_special=%d is where the special space starts (none for heap pages)", pd.Free, pd.Special),
+		"pd_lsn is the WAL position of the last change; the page may not be written out before WAL up to it is flushed",
+	)
+	if pd.Checksum == 0 {
+		writeNotes(w, "", "pd_checksum=0: data checksums are probably disabled for this cluster")
+	}
+	writeNotes(w, "", setFlagNotes(pd.Flags, pageFlagNotes)...)
+}
+
+func explainTuple(w io.Writer, td TupleDump) {
+	const indent = "      "
+	writeNotes(w, indent, lpStateNotes[td.Flags&0x03])
+	h := td.Header
+	if h == nil {
+		return
+	}
+	ctidNote := fmt.Sprintf("t_ctid %s points to this version itself unless it was updated", h.CTID)
+	switch {
+	case h.SpecToken != 0:
+		ctidNote = fmt.Sprintf("t_ctid holds speculative insertion token %d: INSERT ... ON CONFLICT has not confirmed this row yet", h.SpecToken)
+	case h.CTID == "(moved to another partition)":
+		ctidNote = "t_ctid is the marker left when UPDATE moved the row to another partition"
+	}
+	writeNotes(w, indent,
+		"xmin inserted this version; xmax deleted, updated or locked it (0 = never)",
+		ctidNote,
+		fmt.Sprintf("hoff=%d: the column data starts %d bytes into the tuple", h.Hoff, h.Hoff),
+	)
+	mask := h.InfoMask
+	if mask&heappage.HEAP_XMIN_FROZEN == heappage.HEAP_XMIN_FROZEN {
+		// both hint bits together don't mean "committed and aborted"
+		mask &^= heappage.HEAP_XMIN_FROZEN
+		writeNotes(w, indent, "HEAP_XMIN_FROZEN (COMMITTED|INVALID): frozen, visible to everyone regardless of xmin")
+	}
+	writeNotes(w, indent, setFlagNotes(mask, infomaskNotes)...)
+	writeNotes(w, indent, setFlagNotes(h.InfoMask2, infomask2Notes)...)
+	if h.Live {
+		writeNotes(w, indent, "judging by the hint bits alone this version looks live")
+	} else {
+		writeNotes(w, indent, "judging by the hint bits alone this version looks dead or deleted")
+	}
+}
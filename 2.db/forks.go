@@ -0,0 +1,149 @@
+package main
+
+// Relation forks (common/relpath.h). Besides the main fork a relation has
+// <relfilenode>_fsm and _vm, and unlogged relations an _init fork that
+// replaces the main fork during crash recovery. Only the init fork is
+// dumped here: for a heap it is empty, for an index it holds the empty
+// index (e.g. a btree metapage). -forks lists every fork and segment file
+// of a relation.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+var forkNames = []string{"main", "fsm", "vm", "init"}
+
+// relationFork returns "main", "fsm", "vm" or "init" from a relation file
+// name such as 16384_vm or 16384_init.1.
+func relationFork(path string) string {
+	base := filepath.Base(path)
+	base, _, _ = strings.Cut(base, ".")
+	if _, fork, ok := strings.Cut(base, "_"); ok {
+		switch fork {
+		case "fsm", "vm", "init":
+			return fork
+		}
+	}
+	return "main"
+}
+
+// dumpInitFork dumps an init fork (-kind init). A zero-length file is the
+// normal init fork of an unlogged table and is reported, not an error.
+func dumpInitFork(ctx context.Context, filePath string, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	size, err := f.Size()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if size%heappage.PageSize != 0 {
+		return fmt.Errorf("%s: size %d is not a multiple of %d", filePath, size, heappage.PageSize)
+	}
+	if size == 0 {
+		fmt.Println("init fork: empty (0 pages), as for an unlogged table; the main fork is reset to empty after a crash")
+		return nil
+	}
+	logger.Info("init fork", "pages", size/heappage.PageSize)
+	return dumpRelation(ctx, filePath, opts)
+}
+
+// ForkInfo is one segment file of a relation fork.
+type ForkInfo struct {
+	Fork    string `json:"fork"`
+	Segment int    `json:"segment"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Pages   int64  `json:"pages"`
+}
+
+// RelationForks finds the files of the relation whose main fork is
+// baseFilePath: each fork's segments 16384, 16384.1, ... in order, then
+// 16384_fsm, 16384_vm and 16384_init likewise. Forks that do not exist are
+// left out; the main fork must exist.
+func RelationForks(baseFilePath string) ([]ForkInfo, error) {
+	var out []ForkInfo
+	for _, fork := range forkNames {
+		name := baseFilePath
+		if fork != "main" {
+			name += "_" + fork
+		}
+		for seg := 0; ; seg++ {
+			path := name
+			if seg > 0 {
+				path = fmt.Sprintf("%s.%d", name, seg)
+			}
+			st, err := os.Stat(path)
+			if errors.Is(err, fs.ErrNotExist) && (seg > 0 || fork != "main") {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ForkInfo{fork, seg, path, st.Size(), st.Size() / heappage.PageSize})
+		}
+	}
+	return out, nil
+}
+
+// mainForkPath strips a fork suffix and segment number: 16384_vm.1 becomes
+// 16384.
+func mainForkPath(path string) string {
+	dir, base := filepath.Split(path)
+	base, _, _ = strings.Cut(base, ".")
+	if name, fork, ok := strings.Cut(base, "_"); ok && relationFork(base) == fork {
+		base = name
+	}
+	return dir + base
+}
+
+// forksSummary prints the forks of the relation filePath belongs to (-forks).
+func forksSummary(filePath string, opts DumpOptions) error {
+	if strings.Contains(filePath, "://") {
+		return fmt.Errorf("-forks lists local files, not %s", filePath)
+	}
+	files, err := RelationForks(mainForkPath(filePath))
+	if err != nil {
+		return err
+	}
+	if opts.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(files)
+	}
+	return writeForksText(os.Stdout, files)
+}
+
+func writeForksText(w io.Writer, files []ForkInfo) error {
+	fmt.Fprintf(w, "%-5s  %8s  %8s  %12s\n", "fork", "segments", "pages", "bytes")
+	var total int64
+	for _, fork := range forkNames {
+		segs, pages, size := 0, int64(0), int64(0)
+		for _, f := range files {
+			if f.Fork == fork {
+				segs++
+				pages += f.Pages
+				size += f.Size
+			}
+		}
+		if segs == 0 {
+			continue
+		}
+		total += size
+		fmt.Fprintf(w, "%-5s  %8d  %8d  %12d\n", fork, segs, pages, size)
+	}
+	_, err := fmt.Fprintf(w, "total: %d files, %d bytes\n", len(files), total)
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+// -dump-free-space: the bytes between pd_lower and pd_upper. PostgreSQL
+// does not zero space it frees (compacting a page after pruning moves the
+// tuples up and leaves the old copies behind), so a nonzero gap can hold
+// fragments of deleted rows: useful to recover, and a leak when a deleted
+// row was supposed to be gone.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+const freeSpaceRowLen = 16
+
+// freeSpaceMergeGap is the longest zero run kept inside one nonzero range;
+// a tuple is full of zero bytes (null xmax, padding, small integers), and
+// without this every one of them would split its range.
+const freeSpaceMergeGap = 16
+
+// ByteRange is the half-open page byte range [Start, End).
+type ByteRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type FreeSpaceReport struct {
+	Page    int         `json:"page"`
+	PdLower uint16      `json:"pd_lower"`
+	PdUpper uint16      `json:"pd_upper"`
+	Size    int         `json:"size"`
+	Nonzero int         `json:"nonzero_bytes"`
+	Ranges  []ByteRange `json:"nonzero_ranges"`
+	Headers []int       `json:"tuple_headers"` // offsets of plausible tuple headers in the gap
+}
+
+// freeSpace looks at page[pd_lower:pd_upper]: its nonzero runs and the
+// MAXALIGNed offsets that hold a plausible tuple header, the way -salvage
+// looks for them.
+func freeSpace(pageNo int, page []byte, hdr *heappage.PageHeader) (*FreeSpaceReport, error) {
+	lo, hi := int(hdr.PdLower), int(hdr.PdUpper)
+	if lo > hi || hi > len(page) {
+		return nil, fmt.Errorf("page %d: no free space gap: pd_lower=%d pd_upper=%d", pageNo, lo, hi)
+	}
+	rep := &FreeSpaceReport{Page: pageNo, PdLower: hdr.PdLower, PdUpper: hdr.PdUpper, Size: hi - lo,
+		Ranges: []ByteRange{}, Headers: []int{}}
+	for i := lo; i < hi; i++ {
+		if page[i] == 0 {
+			continue
+		}
+		rep.Nonzero++
+		if n := len(rep.Ranges); n > 0 && i-rep.Ranges[n-1].End <= freeSpaceMergeGap {
+			rep.Ranges[n-1].End = i + 1
+		} else {
+			rep.Ranges = append(rep.Ranges, ByteRange{i, i + 1})
+		}
+	}
+	for off := maxAlign(lo); off+heappage.RowHeaderByteLen <= hi; off += MaxAlign {
+		rh, err := heappage.ParseRowHeader(page[off:hi])
+		if err == nil && plausibleRowHeader(rh) == nil {
+			rep.Headers = append(rep.Headers, off)
+		}
+	}
+	return rep, nil
+}
+
+func dumpFreeSpace(filePath string, pageNo int, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	page, hdr, _, err := heappage.LoadPage(f, pageNo)
+	if err != nil {
+		return err
+	}
+	rep, err := freeSpace(pageNo, page, hdr)
+	if err != nil {
+		return err
+	}
+	if opts.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	return writeFreeSpaceText(os.Stdout, page, rep)
+}
+
+func writeFreeSpaceText(w io.Writer, page []byte, rep *FreeSpaceReport) error {
+	fmt.Fprintf(w, "== Page %d free space: pd_lower=%d pd_upper=%d, %d bytes ==\n",
+		rep.Page, rep.PdLower, rep.PdUpper, rep.Size)
+	if rep.Nonzero == 0 {
+		_, err := fmt.Fprintf(w, "all zero\n")
+		return err
+	}
+	fmt.Fprintf(w, "%d nonzero bytes in %d ranges: leftover data\n", rep.Nonzero, len(rep.Ranges))
+	for _, r := range rep.Ranges {
+		fmt.Fprintf(w, "  [%d, %d) %d bytes\n", r.Start, r.End, r.End-r.Start)
+	}
+	for _, off := range rep.Headers {
+		rh, _ := heappage.ParseRowHeader(page[off:rep.PdUpper])
+		fmt.Fprintf(w, "  tuple header @%d: xmin=%d xmax=%d ctid=%s natts=%d\n",
+			off, rh.Xmin, rh.Xmax, rh.CTIDLabel(), rh.Natts())
+	}
+	hexDumpRange(w, page, int(rep.PdLower), int(rep.PdUpper))
+	return nil
+}
+
+// hexDumpRange prints page[start:end] as offset, hex and ASCII columns,
+// with decimal page offsets like lp_off, folding runs of all-zero rows into
+// "*" like hexdump.
+func hexDumpRange(w io.Writer, page []byte, start, end int) {
+	folded := false
+	for off := start; off < end; off += freeSpaceRowLen {
+		row := page[off:min(off+freeSpaceRowLen, end)]
+		if allZero(row) {
+			if !folded {
+				fmt.Fprintln(w, "*")
+				folded = true
+			}
+			continue
+		}
+		folded = false
+		fmt.Fprintf(w, "%5d ", off)
+		for i := 0; i < freeSpaceRowLen; i++ {
+			if i < len(row) {
+				fmt.Fprintf(w, " %02x", row[i])
+			} else {
+				fmt.Fprint(w, "   ")
+			}
+		}
+		fmt.Fprint(w, "  |")
+		for _, c := range row {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			fmt.Fprintf(w, "%c", c)
+		}
+		fmt.Fprintln(w, "|")
+	}
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
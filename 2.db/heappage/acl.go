@@ -0,0 +1,78 @@
+package heappage
+
+// aclitem (utils/acl.h), the element type of pg_class.relacl and the other
+// catalog ACL columns:
+//
+//	Oid     ai_grantee   0 = PUBLIC
+//	Oid     ai_grantor
+//	AclMode ai_privs     privileges in the low half, grant options in the
+//	                     high half
+//
+// AclMode is uint64 since PostgreSQL 16 (16 bytes, align 'd'); before that it
+// was uint32 (12 bytes, align 'i'), see Options.LegacyAclItem.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const ACLITEMOID Oid = 1033
+
+// aclRightsStr is ACL_ALL_RIGHTS_STR: letter i stands for privilege bit i
+// (INSERT, SELECT, UPDATE, DELETE, TRUNCATE, REFERENCES, TRIGGER, EXECUTE,
+// USAGE, CREATE, TEMPORARY, CONNECT, SET, ALTER SYSTEM, MAINTAIN).
+const aclRightsStr = "arwdDxtXUCTcsAm"
+
+var (
+	aclItem   = TypeInfo{"aclitem", 16, 'd', fixedStringDecoder(16, decodeAclItem)}
+	aclItem12 = TypeInfo{"aclitem", 12, 'i', fixedStringDecoder(12, decodeAclItem12)}
+)
+
+func init() {
+	RegisterType(ACLITEMOID, aclItem)
+}
+
+func decodeAclItem(buf []byte, off int) (string, int) {
+	privs := binary.LittleEndian.Uint64(buf[off+8:])
+	return formatAclItem(buf, off, privs&0xFFFFFFFF, privs>>32), off + 16
+}
+
+func decodeAclItem12(buf []byte, off int) (string, int) {
+	privs := uint64(binary.LittleEndian.Uint32(buf[off+8:]))
+	return formatAclItem(buf, off, privs&0xFFFF, privs>>16), off + 12
+}
+
+// formatAclItem renders grantee=privs/grantor like aclitemout: PUBLIC is an
+// empty grantee, and a privilege held WITH GRANT OPTION is followed by '*'.
+// Role names come from the pg_authid entries of -oid-names.
+func formatAclItem(buf []byte, off int, privs, goptions uint64) string {
+	grantee := Oid(binary.LittleEndian.Uint32(buf[off:]))
+	grantor := Oid(binary.LittleEndian.Uint32(buf[off+4:]))
+
+	var sb strings.Builder
+	if grantee != 0 {
+		sb.WriteString(RoleName(grantee))
+	}
+	sb.WriteByte('=')
+	for i := range len(aclRightsStr) {
+		if privs&(1<<i) != 0 {
+			sb.WriteByte(aclRightsStr[i])
+			if goptions&(1<<i) != 0 {
+				sb.WriteByte('*')
+			}
+		}
+	}
+	sb.WriteByte('/')
+	sb.WriteString(RoleName(grantor))
+	return sb.String()
+}
+
+// RoleName is the name of role oid from the pg_authid names loaded with
+// LoadOidNames, or the oid itself if there is none.
+func RoleName(oid Oid) string {
+	if name, ok := LookupOidName("pg_authid", oid); ok {
+		return name
+	}
+	return fmt.Sprint(uint32(oid))
+}
@@ -0,0 +1,102 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// Privilege bits of AclMode, bit i being letter i of aclRightsStr.
+const (
+	aclInsert = 1 << iota
+	aclSelect
+	aclUpdate
+	aclDelete
+	aclTruncate
+	aclReferences
+	aclTrigger
+	aclExecute
+	aclUsage
+	aclCreate
+	aclTemporary
+	aclConnect
+)
+
+// aclItemDatum is an aclitem with privileges privs and grant options
+// goptions in the PG16 16-byte layout or, with legacy, the pre-16 12-byte
+// one.
+func aclItemDatum(grantee, grantor Oid, privs, goptions uint32, legacy bool) []byte {
+	b := int32s(int32(grantee), int32(grantor))
+	if legacy {
+		return binary.LittleEndian.AppendUint32(b, privs&0xFFFF|goptions<<16)
+	}
+	return binary.LittleEndian.AppendUint64(b, uint64(privs)|uint64(goptions)<<32)
+}
+
+var aclLayouts = []struct {
+	name   string
+	opt    *Options
+	legacy bool
+}{
+	{"pg16", nil, false},
+	{"pre-16", &Options{TimePrecision: -1, LegacyAclItem: true}, true},
+}
+
+func TestDecodeAclItem(t *testing.T) {
+	RegisterOidName("pg_authid", 16390, "alice")
+	owner := uint32(aclInsert | aclSelect | aclUpdate | aclDelete | aclTruncate | aclReferences | aclTrigger)
+	tests := []struct {
+		name             string
+		grantee, grantor Oid
+		privs, goptions  uint32
+		want             string
+	}{
+		{"owner", 10, 10, owner, 0, "10=arwdDxt/10"},
+		{"public", 0, 10, aclSelect, 0, "=r/10"},
+		{"public database", 0, 10, aclTemporary | aclConnect, 0, "=Tc/10"},
+		{"named grantee", 16390, 10, aclUsage | aclCreate, 0, "alice=UC/10"},
+		{"named grantor", 10, 16390, aclExecute, 0, "10=X/alice"},
+		{"grant option", 16390, 10, aclSelect | aclUpdate, aclSelect, "alice=r*w/10"},
+		{"public grant options", 0, 10, aclInsert | aclDelete, aclInsert | aclDelete, "=a*d*/10"},
+		{"owner grant options", 10, 10, owner, owner, "10=a*r*w*d*D*x*t*/10"},
+		{"no privileges", 16390, 10, 0, 0, "alice=/10"},
+	}
+	for _, layout := range aclLayouts {
+		typ, _ := layout.opt.LookupType(ACLITEMOID)
+		for _, tt := range tests {
+			t.Run(layout.name+"/"+tt.name, func(t *testing.T) {
+				datum := aclItemDatum(tt.grantee, tt.grantor, tt.privs, tt.goptions, layout.legacy)
+				v, next, err := typ.Decode(datum, 0, layout.opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if v != tt.want || next != len(datum) {
+					t.Errorf("got %q, next %d; want %q, next %d", v, next, tt.want, len(datum))
+				}
+			})
+		}
+	}
+}
+
+// relacl in a tuple: the pre-16 aclitem[] packs 12-byte elements and is
+// 'i'-aligned, the PG16 one packs 16-byte elements and is 'd'-aligned.
+func TestDecodeAclItemArray(t *testing.T) {
+	RegisterOidName("pg_authid", 16390, "alice")
+	for _, layout := range aclLayouts {
+		t.Run(layout.name, func(t *testing.T) {
+			data := arrayHeader(ACLITEMOID, 3)
+			data = append(data, aclItemDatum(10, 10, aclInsert|aclSelect, aclSelect, layout.legacy)...)
+			data = append(data, aclItemDatum(0, 10, aclSelect, 0, layout.legacy)...)
+			data = append(data, aclItemDatum(16390, 10, aclUpdate, 0, layout.legacy)...)
+
+			cols := []ColumnDef{Column("relkind", CHAROID), columnWith("relacl", 1034, layout.opt)}
+			tup := heapTuple(t, cols, []any{uint8('r'), varlena4(data)})
+			row, err := DecodeRow(tup, mustRowHeader(t, tup), cols, layout.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "{10=ar*/10,=r/10,alice=w/10}"; row[1] != want {
+				t.Errorf("got %q, want %q", row[1], want)
+			}
+		})
+	}
+}
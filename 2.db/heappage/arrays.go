@@ -0,0 +1,183 @@
+package heappage
+
+// Arrays (utils/array.h). After the varlena header:
+//
+//	int32 ndim
+//	int32 dataoffset   0 if there is no NULL bitmap, else offset of the data
+//	Oid   elemtype
+//	int32 dims[ndim]
+//	int32 lbound[ndim]
+//	bits8 nullbitmap[(nitems+7)/8]   only if dataoffset != 0
+//	...   element data, each element aligned to the element type's typalign
+//
+// dataoffset and element alignment are relative to the start of the 4-byte
+// varlena header, so the header is put back in front before walking, like
+// decodeComposite does.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const MaxDim = 6 // MAXDIM
+
+// array type oid -> element type oid
+var arrayTypes = map[Oid]Oid{
+	199:  JSONOID,
+	791:  CASHOID,
+	1000: BOOLOID,
+	1001: BYTEAOID,
+	1002: CHAROID,
+	1003: NAMEOID,
+	1005: INT2OID,
+	1006: INT2VECTOROID,
+	1007: INT4OID,
+	1009: TEXTOID,
+	1013: OIDVECTOROID,
+	1014: BPCHAROID,
+	1015: VARCHAROID,
+	1016: INT8OID,
+	1021: FLOAT4OID,
+	1022: FLOAT8OID,
+	1028: OIDOID,
+	1034: ACLITEMOID,
+	1115: TIMESTAMPOID,
+	1182: DATEOID,
+	1185: TIMESTAMPTZOID,
+	1231: NUMERICOID,
+	3643: TSVECTOROID,
+	3645: TSQUERYOID,
+	3807: JSONBOID,
+}
+
+func decodeArrayAny(payload []byte, opt *Options) (any, error) { return decodeArray(payload, opt) }
+
+// decodeArray renders an array datum in PostgreSQL's text form, e.g.
+// {1,2,3}, {{1,2},{3,4}}, or [0:1]={a,b} for non-default lower bounds.
+func decodeArray(payload []byte, opt *Options) (string, error) {
+	buf := make([]byte, 4+len(payload))
+	copy(buf[4:], payload)
+	if len(buf) < 16 {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	ndim := int(int32(binary.LittleEndian.Uint32(buf[4:8])))
+	dataOffset := int(int32(binary.LittleEndian.Uint32(buf[8:12])))
+	elemType := Oid(binary.LittleEndian.Uint32(buf[12:16]))
+	if ndim == 0 {
+		return "{}", nil
+	}
+	if ndim < 0 || ndim > MaxDim {
+		return "", fmt.Errorf("bad array ndim=%d", ndim)
+	}
+	if 16+8*ndim > len(buf) {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	dims := make([]int, ndim)
+	lbounds := make([]int, ndim)
+	nitems := 1
+	for i := 0; i < ndim; i++ {
+		dims[i] = int(int32(binary.LittleEndian.Uint32(buf[16+4*i:])))
+		lbounds[i] = int(int32(binary.LittleEndian.Uint32(buf[16+4*ndim+4*i:])))
+		if dims[i] < 0 || dims[i] > len(buf) {
+			return "", fmt.Errorf("bad array dim[%d]=%d", i, dims[i])
+		}
+		nitems *= dims[i]
+		if nitems > len(buf)*8 {
+			return "", fmt.Errorf("array claims %d items in %d bytes", nitems, len(buf))
+		}
+	}
+
+	var nullmap []byte
+	off := Align(16+8*ndim, 'd') // ARR_OVERHEAD_NONULLS
+	if dataOffset != 0 {
+		bitmapStart := 16 + 8*ndim
+		nb := (nitems + 7) / 8
+		if bitmapStart+nb > len(buf) {
+			return "", io.ErrUnexpectedEOF
+		}
+		if dataOffset < bitmapStart+nb || dataOffset > len(buf) {
+			return "", fmt.Errorf("bad array dataoffset=%d", dataOffset)
+		}
+		nullmap = buf[bitmapStart : bitmapStart+nb]
+		off = dataOffset
+	}
+
+	elem, ok := opt.LookupType(elemType)
+	if !ok {
+		return "", fmt.Errorf("unsupported array element type %d", elemType)
+	}
+
+	items := make([]string, nitems)
+	for i := 0; i < nitems; i++ {
+		if nullmap != nil && nullmap[i/8]&(1<<(i%8)) == 0 {
+			items[i] = "NULL"
+			continue
+		}
+		// Elements go through construct_md_array, which detoasts them, so
+		// varlenas always carry a 4-byte header and are padded to typalign
+		// (att_align_nominal); unlike heap attributes, no short headers.
+		off = Align(off, elem.Align)
+		v, next, err := elem.Decode(buf, off, opt)
+		if err != nil {
+			return "", fmt.Errorf("array element %d: %w", i+1, err)
+		}
+		items[i] = formatArrayElem(v, opt)
+		off = next
+	}
+
+	var sb strings.Builder
+	for i := 0; i < ndim; i++ {
+		if lbounds[i] != 1 {
+			for j := 0; j < ndim; j++ {
+				fmt.Fprintf(&sb, "[%d:%d]", lbounds[j], lbounds[j]+dims[j]-1)
+			}
+			sb.WriteByte('=')
+			break
+		}
+	}
+	writeArrayDim(&sb, items, dims)
+	return sb.String(), nil
+}
+
+// writeArrayDim writes items (row-major) as nested braces over dims.
+func writeArrayDim(sb *strings.Builder, items []string, dims []int) {
+	sb.WriteByte('{')
+	if len(dims) == 1 {
+		sb.WriteString(strings.Join(items, ","))
+	} else {
+		stride := len(items) / max(dims[0], 1)
+		for i := 0; i < dims[0]; i++ {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			writeArrayDim(sb, items[i*stride:(i+1)*stride], dims[1:])
+		}
+	}
+	sb.WriteByte('}')
+}
+
+// formatArrayElem renders one element the way array_out does: strings are
+// double-quoted when they are empty, spell NULL, or contain special chars.
+func formatArrayElem(v any, opt *Options) string {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return "t"
+		}
+		return "f"
+	case []byte:
+		return fmt.Sprintf(`"\\x%x"`, x)
+	case string:
+		if x == "" || strings.EqualFold(x, "NULL") || strings.ContainsAny(x, "{},\"\\ \t\n\r\v\f") {
+			r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+			return `"` + r.Replace(x) + `"`
+		}
+		return x
+	default:
+		return FormatValue(x, opt)
+	}
+}
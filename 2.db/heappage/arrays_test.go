@@ -0,0 +1,77 @@
+package heappage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeArray(t *testing.T) {
+	// offsets in the comments count from the 4-byte varlena header, as
+	// dataoffset and element alignment do
+	tests := []struct {
+		name  string
+		typ   Oid
+		datum []byte
+		want  string
+	}{
+		{"text with a NULL", 1009, varlena4(
+			int32s(1, 32, int32(TEXTOID), 4, 1),   // ndim, dataoffset, elemtype, dims, lbound
+			[]byte{0x0b, 0, 0, 0, 0, 0, 0, 0},     // bitmap 1011 at 24, padded to MAXALIGN
+			[]byte{0x14, 0, 0, 0, 'a', 0, 0, 0},   // at 32: "a", padded to 4
+			[]byte{0x18, 0, 0, 0, 'b', 'c', 0, 0}, // at 40
+			[]byte{0x1c, 0, 0, 0, 'd', ' ', 'e'},  // at 48
+		), `{a,bc,NULL,"d e"}`},
+		{"text quoting", 1009, varlena4(
+			int32s(1, 0, int32(TEXTOID), 3, 1),
+			[]byte{0x10, 0, 0, 0},                     // at 24: ""
+			[]byte{0x20, 0, 0, 0, 'N', 'U', 'L', 'L'}, // at 28
+			[]byte{0x1c, 0, 0, 0, 'a', '"', '\\'},     // at 36
+		), `{"","NULL","a\"\\"}`},
+		{"varchar, no padding needed", 1015, varlena4(
+			int32s(1, 0, int32(VARCHAROID), 2, 1),
+			[]byte{0x20, 0, 0, 0, 'w', 'x', 'y', 'z'},
+			[]byte{0x14, 0, 0, 0, 'q'},
+		), "{wxyz,q}"},
+		{"int8 2-D", 1016, varlena4(
+			int32s(2, 0, int32(INT8OID), 2, 2, 1, 1),
+			[]byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0},
+			[]byte{3, 0, 0, 0, 0, 0, 0, 0, 0xfc, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		), "{{1,2},{3,-4}}"},
+		{"lower bound 0", 1007, varlena4(int32s(1, 0, int32(INT4OID), 2, 0, 7, 8)), "[0:1]={7,8}"},
+		{"empty", 1009, varlena4(int32s(0, 0, int32(TEXTOID))), "{}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, next, err := mustType(t, tt.typ).Decode(tt.datum, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != len(tt.datum) {
+				t.Errorf("got %v, next %d; want %s, next %d", v, next, tt.want, len(tt.datum))
+			}
+		})
+	}
+}
+
+func TestDecodeArrayErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"header truncated", int32s(1, 0), "unexpected EOF"},
+		{"ndim", int32s(7, 0, int32(INT4OID)), "ndim=7"},
+		{"negative dim", int32s(1, 0, int32(INT4OID), -1, 1), "dim[0]=-1"},
+		{"dataoffset inside the bitmap", int32s(1, 20, int32(INT4OID), 1, 1, 0), "dataoffset=20"},
+		{"element past the end", int32s(1, 0, int32(TEXTOID), 1, 1, 0x40), "array element 1"},
+		{"unknown element type", int32s(1, 0, 99999, 1, 1, 0), "element type 99999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeArray(tt.payload, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
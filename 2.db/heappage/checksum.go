@@ -0,0 +1,132 @@
+package heappage
+
+// Data page checksums (checksum_impl.h).
+//
+// The page is viewed as a [BLCKSZ/128][32]uint32 array and fed column-wise
+// into 32 parallel FNV-1a-like sums seeded with fixed offsets. Two extra
+// rounds of zeros mix the last values, the sums are XORed together, the block
+// number is XORed in, and the result is folded into 1..65535 so that 0 can
+// mean "no checksum".
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	checksumNSums   = 32
+	checksumFNVPrim = 16777619
+)
+
+var checksumBaseOffsets = [checksumNSums]uint32{
+	0x5B1F36E9, 0xB8525960, 0x02AB50AA, 0x1DE66D2A,
+	0x79FF467A, 0x9BB9F8A3, 0x217E7CD2, 0x83E13D2C,
+	0xF8D4474F, 0xE39EB970, 0x42C6AE16, 0x993216FA,
+	0x7B093B5D, 0x98DAFF3C, 0xF718902A, 0x0B1C9CDB,
+	0xE58F764B, 0x187636BC, 0x5D7B3BB1, 0xE73DE7DE,
+	0x92BEC979, 0xCCA6C0B2, 0x304A0979, 0x85AA43D4,
+	0x783125BB, 0x6CA8EAA2, 0xE407EAC6, 0x4B5CFC3E,
+	0x9FBF8C76, 0x15CA20BE, 0xF2CA9FFF, 0x3ED3D396,
+}
+
+func checksumComp(sum, value uint32) uint32 {
+	tmp := sum ^ value
+	return tmp*checksumFNVPrim ^ (tmp >> 17)
+}
+
+// ChecksumSteps holds the intermediate values of pg_checksum_page, for
+// -explain-checksum and for checking another implementation against ours.
+type ChecksumSteps struct {
+	Fed      [checksumNSums]uint32 // the sums after every page word was fed in
+	Mixed    [checksumNSums]uint32 // after the two rounds of zeros
+	Block    uint32                // the Mixed sums XORed: pg_checksum_block
+	WithBlk  uint32                // Block ^ block number
+	Folded   uint32                // WithBlk % 65535
+	Checksum uint16                // Folded + 1
+}
+
+// checksumSteps computes the checksum of page as block blkno, keeping every
+// stage. pd_checksum is treated as zero.
+func checksumSteps(page []byte, blkno uint32) *ChecksumSteps {
+	buf := make([]byte, len(page))
+	copy(buf, page)
+	buf[8], buf[9] = 0, 0 // pd_checksum
+
+	st := &ChecksumSteps{}
+	sums := &st.Fed
+	copy(sums[:], checksumBaseOffsets[:])
+	words := len(buf) / 4
+	for i := 0; i < words; i += checksumNSums {
+		for j := 0; j < checksumNSums; j++ {
+			v := binary.LittleEndian.Uint32(buf[(i+j)*4:])
+			sums[j] = checksumComp(sums[j], v)
+		}
+	}
+
+	st.Mixed = st.Fed
+	for round := 0; round < 2; round++ {
+		for j := 0; j < checksumNSums; j++ {
+			st.Mixed[j] = checksumComp(st.Mixed[j], 0)
+		}
+	}
+	for _, s := range st.Mixed {
+		st.Block ^= s
+	}
+	st.WithBlk = st.Block ^ blkno
+	st.Folded = st.WithBlk % 65535
+	st.Checksum = uint16(st.Folded) + 1
+	return st
+}
+
+// PageChecksum is pg_checksum_page: the checksum of page as block blkno,
+// computed with pd_checksum treated as zero.
+func PageChecksum(page []byte, blkno uint32) uint16 {
+	return checksumSteps(page, blkno).Checksum
+}
+
+// VerifyChecksum reports whether the stored pd_checksum matches. Pages with a
+// zero checksum (new pages, or checksums disabled) are not verifiable and
+// report ok=false, checked=false.
+func VerifyChecksum(page []byte, hdr *PageHeader, blkno uint32) (ok, checked bool) {
+	if hdr.PdChecksum == 0 {
+		return false, false
+	}
+	return PageChecksum(page, blkno) == hdr.PdChecksum, true
+}
+
+// ExplainChecksum prints how the checksum of page as block blkno comes
+// about, step by step (-explain-checksum).
+func ExplainChecksum(w io.Writer, page []byte, blkno uint32, stored uint16) error {
+	st := checksumSteps(page, blkno)
+	writeSums := func(sums [checksumNSums]uint32) {
+		for i := 0; i < checksumNSums; i += 8 {
+			fmt.Fprintf(w, "  ")
+			for _, s := range sums[i : i+8] {
+				fmt.Fprintf(w, " %08x", s)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintf(w, "== Block %d checksum ==\n", blkno)
+	fmt.Fprintf(w, "1. pd_checksum (bytes 8-9) is zeroed; the page is read as %d rows of %d uint32\n",
+		len(page)/4/checksumNSums, checksumNSums)
+	fmt.Fprintf(w, "2. %d sums start at fixed offsets; column j of every row is mixed into sum j\n", checksumNSums)
+	fmt.Fprintf(w, "   with sum = (sum ^ v) * %d ^ ((sum ^ v) >> 17); after all rows:\n", checksumFNVPrim)
+	writeSums(st.Fed)
+	fmt.Fprintf(w, "3. two more rounds with v = 0 spread the last words over all bits:\n")
+	writeSums(st.Mixed)
+	fmt.Fprintf(w, "4. XOR of the sums (pg_checksum_block):  0x%08x\n", st.Block)
+	fmt.Fprintf(w, "5. XOR block number %d:                  0x%08x\n", blkno, st.WithBlk)
+	fmt.Fprintf(w, "6. mod 65535 folds to 16 bits:          %d\n", st.Folded)
+	fmt.Fprintf(w, "7. +1 so that 0 means no checksum:      %d (0x%04x)\n", st.Checksum, st.Checksum)
+	switch {
+	case stored == 0:
+		fmt.Fprintf(w, "stored pd_checksum is 0: checksums off, or the page was never checksummed\n")
+	case stored == st.Checksum:
+		fmt.Fprintf(w, "stored pd_checksum %d matches\n", stored)
+	default:
+		fmt.Fprintf(w, "stored pd_checksum %d does NOT match\n", stored)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package heappage
+
+// Date/time types (integer datetimes; datatype/timestamp.h, date.h).
+//
+//	date         int32  days since 2000-01-01                  align 'i'
+//	time         int64  microseconds since midnight            align 'd'
+//	timetz       int64 time + int32 zone (seconds WEST of UTC) align 'd', 12 bytes
+//	timestamp    int64  microseconds since 2000-01-01 00:00:00 align 'd'
+//	timestamptz  same as timestamp, always UTC                 align 'd'
+//	interval     int64 time + int32 day + int32 month          align 'd', 16 bytes
+//
+// Clusters built with --disable-integer-datetimes (the default before 8.4,
+// gone in 10) store the time parts as float8 SECONDS instead; see
+// Options.FloatDatetimes. date is an int32 either way.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DATEOID        Oid = 1082
+	TIMEOID        Oid = 1083
+	TIMESTAMPOID   Oid = 1114
+	TIMESTAMPTZOID Oid = 1184
+	INTERVALOID    Oid = 1186
+	TIMETZOID      Oid = 1266
+)
+
+const usecPerDay = 86400 * 1000000
+
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func init() {
+	RegisterType(DATEOID, TypeInfo{"date", 4, 'i', fixedStringDecoder(4, decodeDate)})
+	RegisterType(TIMEOID, TypeInfo{"time", 8, 'd', fixedStringDecoderWith(8, decodeTime)})
+	RegisterType(TIMETZOID, TypeInfo{"timetz", 12, 'd', fixedStringDecoderWith(12, decodeTimeTZ)})
+	RegisterType(TIMESTAMPOID, TypeInfo{"timestamp", 8, 'd', fixedStringDecoderWith(8, decodeTimestamp)})
+	RegisterType(TIMESTAMPTZOID, TypeInfo{"timestamptz", 8, 'd', fixedStringDecoderWith(8, decodeTimestampTZ)})
+	RegisterType(INTERVALOID, TypeInfo{"interval", 16, 'd', fixedStringDecoderWith(16, decodeInterval)})
+}
+
+// formatTimeOfDay renders microseconds since midnight (or, for interval, any
+// number of hours) as HH:MM:SS[.ffffff]; all datetime output goes through it
+// for the fraction, shown as opt.TimePrecision asks.
+func formatTimeOfDay(usec int64, opt *Options) string {
+	sec := usec / 1000000
+	frac := fmt.Sprintf("%06d", usec%1000000)
+	s := fmt.Sprintf("%02d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+	if digits := opt.orDefault().TimePrecision; digits >= 0 {
+		frac = frac[:digits]
+	} else {
+		frac = strings.TrimRight(frac, "0")
+	}
+	if frac != "" {
+		s += "." + frac
+	}
+	return s
+}
+
+// formatZone renders a UTC offset in seconds as +HH[:MM[:SS]].
+func formatZone(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	s := fmt.Sprintf("%c%02d", sign, offset/3600)
+	if m, sec := offset/60%60, offset%60; m != 0 || sec != 0 {
+		s += fmt.Sprintf(":%02d", m)
+		if sec != 0 {
+			s += fmt.Sprintf(":%02d", sec)
+		}
+	}
+	return s
+}
+
+// pgTime converts microseconds since the PostgreSQL epoch to a time.Time,
+// stepping by whole days first so large values don't overflow a Duration.
+func pgTime(usec int64) time.Time {
+	days := usec / usecPerDay
+	rem := usec % usecPerDay
+	if rem < 0 {
+		days--
+		rem += usecPerDay
+	}
+	return pgEpoch.AddDate(0, 0, int(days)).Add(time.Duration(rem) * time.Microsecond)
+}
+
+func formatTimestamp(usec int64, opt *Options) string {
+	switch usec {
+	case math.MinInt64:
+		return "-infinity"
+	case math.MaxInt64:
+		return "infinity"
+	}
+	t := pgTime(usec)
+	day := t.Truncate(24 * time.Hour)
+	return t.Format("2006-01-02") + " " + formatTimeOfDay(int64(t.Sub(day)/time.Microsecond), opt)
+}
+
+func decodeDate(buf []byte, off int) (string, int) {
+	days := int32(binary.LittleEndian.Uint32(buf[off:]))
+	switch days {
+	case math.MinInt32:
+		return "-infinity", off + 4
+	case math.MaxInt32:
+		return "infinity", off + 4
+	}
+	return pgEpoch.AddDate(0, 0, int(days)).Format("2006-01-02"), off + 4
+}
+
+// timeUsec reads the time part of a datetime at buf[off:] as microseconds:
+// an int64, or with opt.FloatDatetimes float8 seconds rounded to whole
+// microseconds, the precision the formatters work in. Float infinities
+// (DT_NOEND/DT_NOBEGIN) become the integer sentinels.
+func timeUsec(buf []byte, off int, opt *Options) int64 {
+	bits := binary.LittleEndian.Uint64(buf[off:])
+	if !opt.orDefault().FloatDatetimes {
+		return int64(bits)
+	}
+	sec := math.Float64frombits(bits)
+	switch {
+	case math.IsInf(sec, 1):
+		return math.MaxInt64
+	case math.IsInf(sec, -1):
+		return math.MinInt64
+	}
+	return int64(math.Round(sec * 1e6))
+}
+
+func decodeTime(buf []byte, off int, opt *Options) (string, int) {
+	return formatTimeOfDay(timeUsec(buf, off, opt), opt), off + 8
+}
+
+// decodeTimeTZ renders a timetz. The stored zone is seconds WEST of UTC, so
+// +05:30 is stored as -19800.
+func decodeTimeTZ(buf []byte, off int, opt *Options) (string, int) {
+	usec := timeUsec(buf, off, opt)
+	zone := int32(binary.LittleEndian.Uint32(buf[off+8:]))
+	return formatTimeOfDay(usec, opt) + formatZone(-int(zone)), off + 12
+}
+
+func decodeTimestamp(buf []byte, off int, opt *Options) (string, int) {
+	return formatTimestamp(timeUsec(buf, off, opt), opt), off + 8
+}
+
+// formatTimestampTZ renders a timestamptz in opt.TimeZone with its offset,
+// e.g. 2024-03-10 01:30:00-05.
+func formatTimestampTZ(usec int64, opt *Options) string {
+	if usec == math.MinInt64 || usec == math.MaxInt64 {
+		return formatTimestamp(usec, opt)
+	}
+	zone := opt.orDefault().TimeZone
+	if zone == nil {
+		zone = time.UTC
+	}
+	t := pgTime(usec).In(zone)
+	_, offset := t.Zone()
+	tod := (int64(t.Hour())*3600+int64(t.Minute())*60+int64(t.Second()))*1000000 + int64(t.Nanosecond()/1000)
+	return t.Format("2006-01-02") + " " + formatTimeOfDay(tod, opt) + formatZone(offset)
+}
+
+func decodeTimestampTZ(buf []byte, off int, opt *Options) (string, int) {
+	return formatTimestampTZ(timeUsec(buf, off, opt), opt), off + 8
+}
+
+// decodeInterval renders PostgreSQL's default (postgres) interval style,
+// e.g. "1 year 2 mons 3 days 04:05:06". As in interval_out, a field whose
+// sign differs from the one before it carries its own: "-1 days +01:00:00".
+func decodeInterval(buf []byte, off int, opt *Options) (string, int) {
+	usec := timeUsec(buf, off, opt)
+	day := int32(binary.LittleEndian.Uint32(buf[off+8:]))
+	month := int32(binary.LittleEndian.Uint32(buf[off+12:]))
+
+	var parts []string
+	negative := false // the last field written was negative
+	unit := func(n int32, name string) {
+		if n == 0 {
+			return
+		}
+		sign := ""
+		if negative && n > 0 {
+			sign = "+"
+		}
+		if n != 1 {
+			name += "s"
+		}
+		parts = append(parts, fmt.Sprintf("%s%d %s", sign, n, name))
+		negative = n < 0
+	}
+	unit(month/12, "year")
+	unit(month%12, "mon")
+	unit(day, "day")
+	if usec != 0 || len(parts) == 0 {
+		sign := ""
+		if usec < 0 {
+			sign = "-"
+			usec = -usec
+		} else if negative {
+			sign = "+"
+		}
+		parts = append(parts, sign+formatTimeOfDay(usec, opt))
+	}
+	return strings.Join(parts, " "), off + 16
+}
+
+// EpochBaseDisplay shows the timestamp or timestamptz v decoded from
+// buf[off:] with its stored value (-epoch-base, text output only), e.g.
+//
+//	raw=123456789000000 (2000-01-01 based) -> 2003-11-29 21:33:09
+//
+// The raw value is microseconds, or float8 seconds with opt.FloatDatetimes.
+func EpochBaseDisplay(buf []byte, off int, v any, opt *Options) string {
+	return fmt.Sprintf("raw=%s (%s based) -> %v", rawDatetime(buf, off, opt), pgEpoch.Format("2006-01-02"), v)
+}
+
+func rawDatetime(buf []byte, off int, opt *Options) string {
+	bits := binary.LittleEndian.Uint64(buf[off:])
+	if opt.orDefault().FloatDatetimes {
+		return formatFloat8(math.Float64frombits(bits)) + "s"
+	}
+	return strconv.FormatInt(int64(bits), 10)
+}
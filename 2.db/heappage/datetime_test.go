@@ -0,0 +1,184 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// timetzImage is the 12-byte timetz datum: microseconds since midnight and
+// the zone in seconds west of UTC.
+func timetzImage(usec int64, west int32) []byte {
+	b := binary.LittleEndian.AppendUint64(nil, uint64(usec))
+	return binary.LittleEndian.AppendUint32(b, uint32(west))
+}
+
+func TestDecodeTimeTZ(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		want string
+	}{
+		{"utc", timetzImage(0, 0), "00:00:00+00"},
+		{"east of utc", timetzImage(((12*60+34)*60+56)*1e6+789000, -19800), "12:34:56.789+05:30"},
+		{"west of utc", timetzImage(23*3600e6, 8*3600), "23:00:00-08"},
+		{"seconds in the zone", timetzImage(1, -(3600 + 2*60 + 3)), "00:00:00.000001+01:02:03"},
+	}
+	typ := mustType(t, TIMETZOID)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := append([]byte{0xaa}, tt.buf...)
+			v, next, err := typ.Decode(buf, 1, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != 13 {
+				t.Errorf("got %v, next %d; want %s, next 13", v, next, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := typ.Decode(timetzImage(0, 0)[:11], 0, nil); err == nil {
+		t.Error("11 bytes: no error")
+	}
+}
+
+// pgUsec is the stored timestamptz value of a UTC wall-clock time.
+func pgUsec(year int, month time.Month, day, hour, min, sec, usec int) []byte {
+	t := time.Date(year, month, day, hour, min, sec, usec*1000, time.UTC)
+	return int64s(t.Sub(pgEpoch).Microseconds())
+}
+
+// A timestamptz is shown in TimeZone with the offset in effect at that
+// instant, so the offset changes across a DST transition while the stored
+// values stay a second apart.
+func TestDecodeTimestampTZZone(t *testing.T) {
+	zones := map[string]*time.Location{}
+	for _, name := range []string{"UTC", "America/New_York", "Europe/Berlin", "Australia/Sydney", "Asia/Kolkata"} {
+		loc, err := LoadTimeZone(name)
+		if err != nil {
+			t.Skip(err)
+		}
+		zones[name] = loc
+	}
+	tests := []struct {
+		zone  string
+		datum []byte
+		want  string
+	}{
+		// spring forward: 02:00 EST is 03:00 EDT
+		{"UTC", pgUsec(2024, 3, 10, 6, 59, 59, 500000), "2024-03-10 06:59:59.5+00"},
+		{"America/New_York", pgUsec(2024, 3, 10, 6, 59, 59, 500000), "2024-03-10 01:59:59.5-05"},
+		{"America/New_York", pgUsec(2024, 3, 10, 7, 0, 0, 0), "2024-03-10 03:00:00-04"},
+		// fall back: 01:30 comes twice, first in EDT, then in EST
+		{"America/New_York", pgUsec(2024, 11, 3, 5, 30, 0, 0), "2024-11-03 01:30:00-04"},
+		{"America/New_York", pgUsec(2024, 11, 3, 6, 30, 0, 0), "2024-11-03 01:30:00-05"},
+		{"Europe/Berlin", pgUsec(2024, 3, 31, 0, 59, 59, 0), "2024-03-31 01:59:59+01"},
+		{"Europe/Berlin", pgUsec(2024, 3, 31, 1, 0, 0, 0), "2024-03-31 03:00:00+02"},
+		// the day changes with the zone
+		{"Europe/Berlin", pgUsec(1999, 12, 31, 23, 30, 0, 0), "2000-01-01 00:30:00+01"},
+		// southern hemisphere: daylight time ends in April
+		{"Australia/Sydney", pgUsec(2024, 4, 6, 15, 59, 59, 0), "2024-04-07 02:59:59+11"},
+		{"Australia/Sydney", pgUsec(2024, 4, 6, 16, 0, 0, 0), "2024-04-07 02:00:00+10"},
+		{"Asia/Kolkata", pgUsec(2024, 7, 1, 0, 0, 0, 0), "2024-07-01 05:30:00+05:30"},
+	}
+	typ := mustType(t, TIMESTAMPTZOID)
+	for _, tt := range tests {
+		opt := &Options{TimePrecision: -1, TimeZone: zones[tt.zone]}
+		v, _, err := typ.Decode(tt.datum, 0, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.zone, v, tt.want)
+		}
+	}
+}
+
+// intervalDatum is an interval: microseconds, days and months.
+func intervalDatum(usec int64, days, months int32) []byte {
+	return append(int64s(usec), int32s(days, months)...)
+}
+
+// A field whose sign differs from the field before it carries its own, as
+// interval_out writes it; plurals follow the number, so -1 has "days".
+func TestDecodeInterval(t *testing.T) {
+	tests := []struct {
+		datum []byte
+		want  string
+	}{
+		{intervalDatum(0, 0, 0), "00:00:00"},
+		{intervalDatum(3600e6, -1, 0), "-1 days +01:00:00"},
+		{intervalDatum(-3600e6, 1, 14), "1 year 2 mons 1 day -01:00:00"},
+		{intervalDatum(0, -3, 1), "1 mon -3 days"},
+		{intervalDatum(0, 3, -13), "-1 years -1 mons +3 days"},
+		{intervalDatum(1500, 0, -1), "-1 mons +00:00:00.0015"},
+		{intervalDatum(-90061e6, -1, -1), "-1 mons -1 days -25:01:01"},
+		{intervalDatum(0, 0, -12), "-1 years"},
+		{intervalDatum(7200e6, 2, 25), "2 years 1 mon 2 days 02:00:00"},
+	}
+	typ := mustType(t, INTERVALOID)
+	for _, tt := range tests {
+		v, next, err := typ.Decode(tt.datum, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != tt.want || next != len(tt.datum) {
+			t.Errorf("got %q, want %q", v, tt.want)
+		}
+	}
+}
+
+// TimePrecision truncates the fraction rather than rounding it, so no value
+// moves on to the next second, day or year; 6 pads with zeros and -1 drops
+// them.
+func TestTimePrecision(t *testing.T) {
+	lastUsec := func(d []byte) []byte { // one microsecond before d
+		return int64s(int64(binary.LittleEndian.Uint64(d)) - 1)
+	}
+	newYear := pgUsec(2025, 1, 1, 0, 0, 0, 0)
+	tests := []struct {
+		name   string
+		typ    Oid
+		datum  []byte
+		digits map[int]string
+	}{
+		{"time", TIMEOID, int64s(((12*60+34)*60+56)*1e6 + 789500), map[int]string{
+			0: "12:34:56", 3: "12:34:56.789", 6: "12:34:56.789500", -1: "12:34:56.7895"}},
+		{"time before midnight", TIMEOID, int64s(86400e6 - 1), map[int]string{
+			0: "23:59:59", 3: "23:59:59.999", 6: "23:59:59.999999", -1: "23:59:59.999999"}},
+		{"whole second", TIMEOID, int64s(1e6), map[int]string{
+			0: "00:00:01", 3: "00:00:01.000", 6: "00:00:01.000000", -1: "00:00:01"}},
+		{"timetz", TIMETZOID, timetzImage(1500, -3600), map[int]string{
+			0: "00:00:00+01", 3: "00:00:00.001+01", -1: "00:00:00.0015+01"}},
+		{"timestamp before the new year", TIMESTAMPOID, lastUsec(newYear), map[int]string{
+			0: "2024-12-31 23:59:59", 3: "2024-12-31 23:59:59.999", -1: "2024-12-31 23:59:59.999999"}},
+		{"timestamp before 2000", TIMESTAMPOID, int64s(-500), map[int]string{
+			0: "1999-12-31 23:59:59", 3: "1999-12-31 23:59:59.999", -1: "1999-12-31 23:59:59.9995"}},
+		{"timestamptz", TIMESTAMPTZOID, lastUsec(newYear), map[int]string{
+			0: "2024-12-31 23:59:59+00", 3: "2024-12-31 23:59:59.999+00"}},
+		{"interval", INTERVALOID, intervalDatum(3600e6+999999, 2, 0), map[int]string{
+			0: "2 days 01:00:00", 3: "2 days 01:00:00.999", -1: "2 days 01:00:00.999999"}},
+		{"negative interval", INTERVALOID, intervalDatum(-1999999, 0, 0), map[int]string{
+			0: "-00:00:01", 3: "-00:00:01.999", -1: "-00:00:01.999999"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typ := mustType(t, tt.typ)
+			for digits, want := range tt.digits {
+				v, _, err := typ.Decode(tt.datum, 0, &Options{TimePrecision: digits})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if v != want {
+					t.Errorf("precision %d: got %q, want %q", digits, v, want)
+				}
+			}
+		})
+	}
+	for _, bad := range []int{-2, 7} {
+		if err := CheckTimePrecision(bad); err == nil {
+			t.Errorf("precision %d: no error", bad)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package heappage
+
+// Schema-driven tuple decoding (heaptuple.c: heap_deform_tuple).
+//
+// Walks the DATA area attribute by attribute using attlen/attalign from the
+// column definitions, honoring the NULL bitmap and "short" tuples whose natts
+// is smaller than the schema (columns added later read as NULL).
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const RowHeaderByteLen = 23 // offsetof(HeapTupleHeaderData, t_bits)
+
+// ColumnDef is the subset of pg_attribute needed to walk a tuple.
+type ColumnDef struct {
+	Name   string
+	Type   Oid
+	Len    int         // attlen: >0 fixed width, -1 varlena
+	Align  byte        // attalign: 'c','s','i','d'
+	Fields []ColumnDef // attributes of a composite type, if any
+}
+
+// Column builds a ColumnDef for a registered type.
+func Column(name string, typ Oid) ColumnDef { return columnWith(name, typ, nil) }
+
+// columnWith is Column with the type layouts opt selects.
+func columnWith(name string, typ Oid, opt *Options) ColumnDef {
+	col := ColumnDef{Name: name, Type: typ, Len: -1, Align: 'i'}
+	if t, ok := opt.LookupType(typ); ok {
+		col.Len, col.Align = t.Len, t.Align
+	}
+	return col
+}
+
+// RECORDOID is the pseudo-type of a row whose composite type is not known
+// by oid, as for one described field by field in -schema.
+const RECORDOID Oid = 2249
+
+// CompositeColumn builds a ColumnDef for a column of a composite (row) type.
+func CompositeColumn(name string, typ Oid, fields []ColumnDef) ColumnDef {
+	return ColumnDef{Name: name, Type: typ, Len: -1, Align: 'd', Fields: fields}
+}
+
+// ParseRowHeader decodes the fixed part of the tuple header.
+func ParseRowHeader(tuple []byte) (*RowHeader, error) {
+	if len(tuple) < RowHeaderByteLen {
+		return nil, fmt.Errorf("tuple too short for header: %d bytes", len(tuple))
+	}
+	rh := &RowHeader{}
+	if err := binary.Read(bytes.NewReader(tuple), binary.LittleEndian, rh); err != nil {
+		return nil, err
+	}
+	return rh, nil
+}
+
+// DecodeRow decodes the attributes of a tuple (buf starts at the tuple
+// header) with the settings of opt, which may be nil. NULL attributes are
+// returned as nil.
+func DecodeRow(buf []byte, rh *RowHeader, cols []ColumnDef, opt *Options) ([]any, error) {
+	out := make([]any, len(cols))
+	err := WalkRow(buf, rh, cols, len(cols), func(i, off, _ int, col *ColumnDef) (int, error) {
+		v, next, err := DecodeAttrAt(buf, off, col, opt)
+		out[i] = v
+		return next, err
+	})
+	return out, err
+}
+
+// AttrTrace records where the walk found one attribute (-trace-offsets).
+type AttrTrace struct {
+	Attr  int    `json:"attr"` // 1-based
+	Name  string `json:"name"`
+	Off   int    `json:"off"` // aligned offset within the tuple
+	Pad   int    `json:"pad"` // alignment padding skipped before it
+	Len   int    `json:"len"`
+	Null  bool   `json:"null,omitempty"`
+	Value any    `json:"value"`
+}
+
+// TraceRow decodes like DecodeRow but also reports every attribute's
+// offset, padding and length, to show where a wrong schema makes the walk
+// drift. The trace covers the attributes walked before an error too.
+func TraceRow(buf []byte, rh *RowHeader, cols []ColumnDef, opt *Options) ([]any, []AttrTrace, error) {
+	out := make([]any, len(cols))
+	trace := make([]AttrTrace, len(cols))
+	for i := range trace {
+		trace[i] = AttrTrace{Attr: i + 1, Name: cols[i].Name, Null: true}
+	}
+	walked := 0
+	err := WalkRow(buf, rh, cols, len(cols), func(i, off, pad int, col *ColumnDef) (int, error) {
+		walked = i + 1
+		trace[i] = AttrTrace{Attr: i + 1, Name: col.Name, Off: off, Pad: pad}
+		v, next, err := DecodeAttrAt(buf, off, col, opt)
+		out[i] = v
+		trace[i].Value = v
+		trace[i].Len = next - off
+		return next, err
+	})
+	if err != nil {
+		trace = trace[:walked]
+	}
+	return out, trace, err
+}
+
+// DecodeRowAttrs decodes only the given 1-based attribute numbers and returns
+// their values in the order requested. Attributes before the last requested
+// one are still walked to find offsets, but only measured, not interpreted.
+func DecodeRowAttrs(buf []byte, rh *RowHeader, cols []ColumnDef, attrs []int, opt *Options) ([]any, error) {
+	want := make(map[int]int, len(attrs)) // attr index -> position in out
+	upto := 0
+	for pos, a := range attrs {
+		if a < 1 || a > len(cols) {
+			return nil, fmt.Errorf("attribute %d out of range 1..%d", a, len(cols))
+		}
+		want[a-1] = pos
+		upto = max(upto, a)
+	}
+
+	out := make([]any, len(attrs))
+	err := WalkRow(buf, rh, cols, upto, func(i, off, _ int, col *ColumnDef) (int, error) {
+		pos, ok := want[i]
+		if !ok {
+			return SkipAttr(buf, off, col)
+		}
+		v, next, err := DecodeAttrAt(buf, off, col, opt)
+		out[pos] = v
+		return next, err
+	})
+	return out, err
+}
+
+// DecodeAttr decodes only the 1-based attribute attnum, measuring the ones
+// before it to find its offset and stopping there, for a consumer that
+// needs one column (say a key) of many tuples. A NULL, or an attribute the
+// tuple predates, is nil.
+func DecodeAttr(buf []byte, rh *RowHeader, cols []ColumnDef, attnum int, opt *Options) (any, error) {
+	if attnum < 1 || attnum > len(cols) {
+		return nil, fmt.Errorf("attribute %d out of range 1..%d", attnum, len(cols))
+	}
+	var out any
+	err := WalkRow(buf, rh, cols, attnum, func(i, off, _ int, col *ColumnDef) (int, error) {
+		if i < attnum-1 {
+			return SkipAttr(buf, off, col)
+		}
+		v, next, err := DecodeAttrAt(buf, off, col, opt)
+		out = v
+		return next, err
+	})
+	return out, err
+}
+
+// WalkRow walks the first upto attributes of the DATA area, applying the NULL
+// bitmap and alignment. step is called for every non-NULL attribute at its
+// aligned offset, with the padding skipped to get there, and returns the
+// offset just past the datum.
+func WalkRow(buf []byte, rh *RowHeader, cols []ColumnDef, upto int,
+	step func(i, off, pad int, col *ColumnDef) (int, error)) error {
+	// NULL bitmap follows the fixed header; a set bit means NOT NULL.
+	natts := rh.Natts()
+	var nullmap []byte
+	if rh.HasNull() {
+		nb := (natts + 7) / 8
+		if RowHeaderByteLen+nb > len(buf) {
+			return io.ErrUnexpectedEOF
+		}
+		nullmap = buf[RowHeaderByteLen : RowHeaderByteLen+nb]
+	}
+	isNull := func(attIdx int) bool {
+		if attIdx >= natts {
+			return true // attribute added after this tuple was written
+		}
+		if nullmap == nil {
+			return false
+		}
+		return nullmap[attIdx/8]&(1<<(attIdx%8)) == 0
+	}
+
+	off, end, err := rh.DataRange(len(buf))
+	if err != nil {
+		return err
+	}
+	if off == end {
+		// t_hoff == lp_len: a header with no data at all (zero columns,
+		// or all NULL without a bitmap in a hand-built tuple); every
+		// attribute reads as NULL rather than as a truncated datum
+		return nil
+	}
+	for i := 0; i < upto && i < len(cols); i++ {
+		if isNull(i) {
+			continue
+		}
+		col := &cols[i]
+		aligned := alignAttr(buf, off, col)
+		next, err := step(i, aligned, aligned-off, col)
+		off = aligned
+		if err != nil {
+			return fmt.Errorf("attr %d %q @ off=%d: %w", i+1, col.Name, off, err)
+		}
+		off = next
+	}
+	return nil
+}
+
+// SkipAttr returns the offset just past a datum without interpreting it:
+// fixed-width types advance by attlen, varlenas by their header length and
+// cstrings past their NUL.
+func SkipAttr(buf []byte, off int, col *ColumnDef) (int, error) {
+	switch col.Len {
+	case -1:
+		_, next, err := ReadVarlenaLE(buf, off)
+		return next, err
+	case -2:
+		return cstringEnd(buf, off)
+	}
+	if col.Len <= 0 || off+col.Len > len(buf) {
+		return off, io.ErrUnexpectedEOF
+	}
+	return off + col.Len, nil
+}
+
+// alignAttr mirrors att_align_pointer: a varlena that starts with a nonzero
+// byte is a short (1-byte header) datum and is not padded.
+func alignAttr(buf []byte, off int, col *ColumnDef) int {
+	if col.Len == -1 && off < len(buf) && buf[off] != 0 {
+		return off
+	}
+	return Align(off, col.Align)
+}
+
+// DecodeAttrAt decodes the datum of col at buf[off:], off already aligned,
+// and returns it with the offset just past it.
+func DecodeAttrAt(buf []byte, off int, col *ColumnDef, opt *Options) (any, int, error) {
+	if len(col.Fields) > 0 {
+		payload, next, err := ReadVarlenaLE(buf, off)
+		if err != nil {
+			return nil, off, err
+		}
+		v, err := decodeComposite(payload, col.Fields, opt)
+		if err != nil {
+			return nil, off, fmt.Errorf("composite: %w", err)
+		}
+		return v, next, nil
+	}
+	if t, ok := opt.LookupType(col.Type); ok {
+		return t.Decode(buf, off, opt)
+	}
+
+	// Unknown type: hand back the raw bytes.
+	if col.Len == -1 {
+		payload, next, err := ReadVarlenaLE(buf, off)
+		if err != nil {
+			return nil, off, err
+		}
+		return append([]byte(nil), payload...), next, nil
+	}
+	if col.Len == -2 {
+		next, err := cstringEnd(buf, off)
+		if err != nil {
+			return nil, off, err
+		}
+		return append([]byte(nil), buf[off:next-1]...), next, nil
+	}
+	if col.Len <= 0 || off+col.Len > len(buf) {
+		return nil, off, io.ErrUnexpectedEOF
+	}
+	return append([]byte(nil), buf[off:off+col.Len]...), off + col.Len, nil
+}
+
+// decodeComposite decodes a composite datum. The datum is itself a
+// HeapTupleHeader whose t_choice holds DatumTupleFields
+// (datum_len_, datum_typmod, datum_typeid) instead of xmin/xmax/cid, so it
+// has its own natts and NULL bitmap, independent of the outer tuple's.
+//
+// datum_len_ doubles as the varlena header and is already stripped from
+// payload, but t_hoff and alignment are relative to it, so a placeholder is
+// put back in front before walking the fields.
+func decodeComposite(payload []byte, fields []ColumnDef, opt *Options) ([]any, error) {
+	tup := make([]byte, 4+len(payload))
+	copy(tup[4:], payload)
+	rh, err := ParseRowHeader(tup)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRow(tup, rh, fields, opt)
+}
@@ -0,0 +1,175 @@
+package heappage
+
+import (
+	"reflect"
+	"testing"
+)
+
+var decodeTestCols = []ColumnDef{
+	Column("id", INT8OID),
+	Column("name", TEXTOID),
+	Column("flag", BOOLOID),
+	Column("n", INT4OID),
+	Column("note", TEXTOID),
+	Column("small", INT2OID),
+	Column("total", INT8OID),
+}
+
+func TestDecodeRow(t *testing.T) {
+	tests := []struct {
+		name string
+		vals []any // as stored; fewer than the columns makes a short tuple
+		want []any
+	}{
+		{
+			name: "all set",
+			vals: []any{int64(1), "abc", true, int32(-7), "x", int16(3), int64(1 << 40)},
+			want: []any{int64(1), "abc", true, int32(-7), "x", int16(3), int64(1 << 40)},
+		},
+		{
+			name: "nulls",
+			vals: []any{int64(2), nil, false, nil, "", nil, int64(-1)},
+			want: []any{int64(2), nil, false, nil, "", nil, int64(-1)},
+		},
+		{
+			name: "added columns",
+			vals: []any{int64(3), "old"},
+			want: []any{int64(3), "old", nil, nil, nil, nil, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tup := heapTuple(t, decodeTestCols, tt.vals)
+			got, err := DecodeRow(tup, mustRowHeader(t, tup), decodeTestCols, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeRow = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// DecodeAttr measures the attributes before attnum instead of decoding
+// them; it must land on the same value as the full walk.
+func TestDecodeAttrMatchesDecodeRow(t *testing.T) {
+	rows := [][]any{
+		{int64(1), "abc", true, int32(-7), "x", int16(3), int64(1 << 40)},
+		{int64(2), nil, false, nil, "", nil, int64(-1)},
+		{nil, "a longer text value", nil, int32(9), nil, int16(-2), nil},
+		{int64(3), "old"},
+	}
+	for _, vals := range rows {
+		tup := heapTuple(t, decodeTestCols, vals)
+		rh := mustRowHeader(t, tup)
+		row, err := DecodeRow(tup, rh, decodeTestCols, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for attnum := 1; attnum <= len(decodeTestCols); attnum++ {
+			got, err := DecodeAttr(tup, rh, decodeTestCols, attnum, nil)
+			if err != nil {
+				t.Fatalf("%v: DecodeAttr(%d): %v", vals, attnum, err)
+			}
+			if !reflect.DeepEqual(got, row[attnum-1]) {
+				t.Errorf("%v: DecodeAttr(%d) = %#v, DecodeRow has %#v", vals, attnum, got, row[attnum-1])
+			}
+		}
+	}
+}
+
+func TestDecodeAttrOutOfRange(t *testing.T) {
+	tup := heapTuple(t, decodeTestCols, []any{int64(1)})
+	for _, attnum := range []int{0, len(decodeTestCols) + 1} {
+		if _, err := DecodeAttr(tup, mustRowHeader(t, tup), decodeTestCols, attnum, nil); err == nil {
+			t.Errorf("DecodeAttr(%d): no error", attnum)
+		}
+	}
+}
+
+func TestDecodeComposite(t *testing.T) {
+	addr := []ColumnDef{Column("street", TEXTOID), Column("zip", INT4OID), Column("note", TEXTOID)}
+	cols := []ColumnDef{Column("id", INT8OID), CompositeColumn("addr", RECORDOID, addr), Column("tag", TEXTOID)}
+	tests := []struct {
+		name string
+		addr []any
+		vals func(addr []byte) []any
+		want []any
+	}{
+		{
+			name: "fields set",
+			addr: []any{"Main", int32(12345), "x"},
+			vals: func(a []byte) []any { return []any{int64(1), a, "t"} },
+			want: []any{int64(1), []any{"Main", int32(12345), "x"}, "t"},
+		},
+		{
+			// the composite has its own bitmap; the outer tuple has none
+			name: "null field",
+			addr: []any{nil, int32(7), "y"},
+			vals: func(a []byte) []any { return []any{int64(2), a, "u"} },
+			want: []any{int64(2), []any{nil, int32(7), "y"}, "u"},
+		},
+		{
+			// and the other way round
+			name: "outer nulls",
+			addr: []any{"Elm", int32(1), "z"},
+			vals: func(a []byte) []any { return []any{nil, a, nil} },
+			want: []any{nil, []any{"Elm", int32(1), "z"}, nil},
+		},
+		{
+			name: "composite from before a field was added",
+			addr: []any{"Oak"},
+			vals: func(a []byte) []any { return []any{int64(3), a, "v"} },
+			want: []any{int64(3), []any{"Oak", nil, nil}, "v"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tup := heapTuple(t, cols, tt.vals(compositeDatum(t, addr, tt.addr)))
+			got, err := DecodeRow(tup, mustRowHeader(t, tup), cols, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeRow = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A typlen -2 attribute ends at its NUL, then the walk goes on from there
+// to the next attribute's alignment.
+func TestDecodeCString(t *testing.T) {
+	unknown := ColumnDef{Name: "u", Type: 99999, Len: -2, Align: 'c'}
+	cols := []ColumnDef{Column("a", INT2OID), Column("s", CSTRINGOID), Column("n", INT4OID), unknown, Column("z", INT2OID)}
+	if cols[1].Len != -2 || cols[1].Align != 'c' {
+		t.Fatalf("cstring column %+v", cols[1])
+	}
+	tup := heapTuple(t, cols, []any{int16(1), []byte("héllo\x00"), int32(7), []byte("x\x00"), int16(9)})
+	// s right after a at 26, n aligned from 33 to 36, u at 40, z from 42
+	if tup[32] != 0 || tup[36] != 7 || tup[40] != 'x' || tup[42] != 9 {
+		t.Fatalf("tuple laid out unexpectedly: % x", tup[24:])
+	}
+	rh := mustRowHeader(t, tup)
+
+	want := []any{int16(1), "héllo", int32(7), []byte("x"), int16(9)}
+	got, err := DecodeRow(tup, rh, cols, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeRow = %#v, want %#v", got, want)
+	}
+	for attnum := range cols {
+		v, err := DecodeAttr(tup, rh, cols, attnum+1, nil)
+		if err != nil || !reflect.DeepEqual(v, want[attnum]) {
+			t.Errorf("DecodeAttr(%d) = %#v, %v; want %#v", attnum+1, v, err, want[attnum])
+		}
+	}
+
+	unterminated := heapTuple(t, cols[:2], []any{int16(1), []byte("abc")})
+	if _, err := DecodeRow(unterminated, mustRowHeader(t, unterminated), cols[:2], nil); err == nil {
+		t.Error("cstring without NUL: no error")
+	}
+}
@@ -0,0 +1,113 @@
+package heappage
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+)
+
+func mustEncoding(t *testing.T, name string) ServerEncoding {
+	t.Helper()
+	enc, err := LookupEncoding(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+// Text in a single-byte server encoding comes out as UTF-8. The stored
+// bytes are what the server writes for these strings, e.g.
+// convert_to('Grüße', 'LATIN1').
+func TestServerEncodingText(t *testing.T) {
+	tests := []struct {
+		enc    string
+		stored string
+		want   string
+	}{
+		{"LATIN1", "Gr\xfc\xdfe", "Grüße"},
+		{"LATIN1", "caf\xe9 \xa3\xa7\xff", "café £§ÿ"},
+		{"WIN1251", "\xcf\xf0\xe8\xe2\xe5\xf2, \xec\xe8\xf0", "Привет, мир"},
+		{"WIN1251", "\xa8\xeb\xea\xe0 \xb9\x31 \x88", "Ёлка №1 €"},
+		{"UTF8", "Grüße", "Grüße"},
+		{"SQL_ASCII", "Gr\xfc\xdfe", "Gr\xfc\xdfe"},
+		// no WIN1251 character is encoded as 0x98
+		{"WIN1251", "a\x98b", "a�b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.enc, func(t *testing.T) {
+			opt := &Options{TimePrecision: -1, Encoding: mustEncoding(t, tt.enc)}
+			datum := varlena4([]byte(tt.stored))
+			v, next, err := mustType(t, TEXTOID).Decode(datum, 0, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != len(datum) {
+				t.Errorf("%q: got %q, want %q", tt.stored, v, tt.want)
+			}
+		})
+	}
+}
+
+// Every byte of a single-byte encoding maps to its own character, so text
+// converted to UTF-8 can be converted back; the bytes with no character
+// are the only ones that give U+FFFD.
+func TestServerEncodingRoundTrip(t *testing.T) {
+	unmapped := map[string][]byte{"LATIN1": nil, "WIN1251": {0x98}}
+	for name, holes := range unmapped {
+		enc := mustEncoding(t, name)
+		opt := &Options{TimePrecision: -1, Encoding: enc}
+		back := map[rune]byte{}
+		for b := 0x80; b <= 0xFF; b++ {
+			s := opt.serverString([]byte{byte(b)})
+			r, _ := utf8.DecodeRuneInString(s)
+			if r == utf8.RuneError {
+				continue
+			}
+			if prev, dup := back[r]; dup {
+				t.Errorf("%s: %#x and %#x both decode to %U", name, prev, b, r)
+			}
+			back[r] = byte(b)
+		}
+		if len(back) != 128-len(holes) {
+			t.Errorf("%s: %d bytes have a character, want %d", name, len(back), 128-len(holes))
+		}
+		var stored, again []byte
+		for b := 0x20; b <= 0xFF; b++ {
+			if b < 0x80 || !bytes.Contains(holes, []byte{byte(b)}) {
+				stored = append(stored, byte(b))
+			}
+		}
+		for _, r := range opt.serverString(stored) {
+			if r < utf8.RuneSelf {
+				again = append(again, byte(r))
+			} else {
+				again = append(again, back[r])
+			}
+		}
+		if !bytes.Equal(again, stored) {
+			t.Errorf("%s: round trip changed the text:\n% x\n% x", name, stored, again)
+		}
+		for _, b := range holes {
+			if s := opt.serverString([]byte{b}); s != "�" {
+				t.Errorf("%s: %#x decodes to %q, want U+FFFD", name, b, s)
+			}
+		}
+	}
+}
+
+func TestLookupEncoding(t *testing.T) {
+	for _, name := range []string{"win1251", "WIN-1251", "Win_1251"} {
+		if enc, err := LookupEncoding(name); err != nil || enc.ID != 23 {
+			t.Errorf("%s: %v, %v", name, enc.Name, err)
+		}
+	}
+	if enc, err := EncodingByID(8); err != nil || enc.Name != "LATIN1" {
+		t.Errorf("encoding 8: %v, %v", enc.Name, err)
+	}
+	if _, err := LookupEncoding("EUC_JP"); err == nil {
+		t.Error("EUC_JP: no error")
+	}
+	if _, err := EncodingByID(1); err == nil {
+		t.Error("encoding 1: no error")
+	}
+}
@@ -0,0 +1,127 @@
+package heappage
+
+// Rendering decoded values as text, shared by the output formats. Decoders
+// return Go values (int64, float64, string, []byte, []any for composites,
+// nil for NULL); FormatValue turns one into what the type's output function
+// prints, and each writer adds its own quoting on top.
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FormatBytea renders a bytea value in opt.BinaryEncoding.
+func FormatBytea(b []byte, opt *Options) string {
+	switch opt.orDefault().BinaryEncoding {
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b)
+	case "escape":
+		return formatByteaEscape(b)
+	default:
+		return FormatByteaHex(b)
+	}
+}
+
+// FormatByteaHex renders bytea like bytea_output = hex.
+func FormatByteaHex(b []byte) string { return fmt.Sprintf(`\x%x`, b) }
+
+// formatByteaEscape follows byteaout's escape format: a backslash doubled,
+// printable ASCII as is, every other byte as a backslash and three octal
+// digits.
+func formatByteaEscape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '\\':
+			sb.WriteString(`\\`)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&sb, `\%03o`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// FormatValue renders v the way psql shows it: NULL as the empty string,
+// bool as t/f, bytea per opt.BinaryEncoding, floats like float8out and
+// composites like record_out.
+func FormatValue(v any, opt *Options) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case bool:
+		if x {
+			return "t"
+		}
+		return "f"
+	case []byte:
+		return FormatBytea(x, opt)
+	case float32:
+		return formatFloat(float64(x), 32)
+	case float64:
+		return formatFloat(x, 64)
+	case []any:
+		return formatRecord(x, opt)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func formatFloat(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits)
+}
+
+// formatRecord renders a composite like record_out: (a,,"b c") with NULL
+// fields empty and fields double-quoted when empty or holding special
+// characters.
+func formatRecord(fields []any, opt *Options) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for i, f := range fields {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		if f == nil {
+			continue
+		}
+		s := FormatValue(f, opt)
+		if s == "" || strings.ContainsAny(s, "(),\"\\ \t\n\r\v\f") {
+			s = `"` + strings.NewReplacer(`"`, `""`, `\`, `\\`).Replace(s) + `"`
+		}
+		sb.WriteString(s)
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// FormatTuple renders a decoded row like psql's expanded display (\x),
+// one "column | value" line per attribute with the names padded to line up.
+func FormatTuple(cols []ColumnDef, values []any, opt *Options) string {
+	width := 0
+	for _, c := range cols {
+		width = max(width, len(c.Name))
+	}
+	var sb strings.Builder
+	for i, c := range cols {
+		var v any
+		if i < len(values) {
+			v = values[i]
+		}
+		fmt.Fprintf(&sb, "%-*s | %s\n", width, c.Name, FormatValue(v, opt))
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package heappage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"null", nil, ""},
+		{"empty string", "", ""},
+		{"bool", true, "t"},
+		{"int", int64(-42), "-42"},
+		{"float", 1.5, "1.5"},
+		{"infinity", math.Inf(1), "Infinity"},
+		{"bytea", []byte{0xde, 0xad}, `\xdead`},
+		{"record", []any{int64(1), nil, "b c", ""}, `(1,,"b c","")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatValue(tt.v, nil); got != tt.want {
+				t.Errorf("FormatValue(%#v) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTuple(t *testing.T) {
+	// numeric 123.45: 1-byte varlena header, short header with dscale 2 and
+	// weight 0, digits 123 and 4500
+	num, _, err := mustType(t, NUMERICOID).Decode([]byte{0x0f, 0x00, 0x81, 0x7b, 0x00, 0x94, 0x11}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := []ColumnDef{Column("id", INT8OID), Column("note", TEXTOID), Column("amount", NUMERICOID)}
+
+	tests := []struct {
+		name   string
+		values []any
+		want   string
+	}{
+		{"values", []any{int64(7), "hi", num}, "id     | 7\nnote   | hi\namount | 123.45\n"},
+		{"null and empty", []any{nil, "", nil}, "id     | \nnote   | \namount | \n"},
+		{"short row", []any{int64(1)}, "id     | 1\nnote   | \namount | \n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatTuple(cols, tt.values, nil); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Escape mode is byteaout with bytea_output = escape: a backslash doubled,
+// bytes outside printable ASCII as \ooo, everything else as is.
+func TestFormatBytea(t *testing.T) {
+	tests := []struct {
+		name                string
+		b                   []byte
+		hex, escape, base64 string
+	}{
+		{"empty", []byte{}, `\x`, ``, ``},
+		{"printable", []byte("abc ~"), `\x616263207e`, `abc ~`, `YWJjIH4=`},
+		{"backslash", []byte(`a\b`), `\x615c62`, `a\\b`, `YVxi`},
+		{"quotes", []byte(`'"`), `\x2722`, `'"`, `JyI=`},
+		{"nul", []byte{'a', 0}, `\x6100`, `a\000`, `YQA=`},
+		{"control", []byte("\t\n\r\x1f"), `\x090a0d1f`, `\011\012\015\037`, `CQoNHw==`},
+		{"del and high", []byte{0x7f, 0x80, 0xff}, `\x7f80ff`, `\177\200\377`, `f4D/`},
+		{"utf-8", []byte("é"), `\xc3a9`, `\303\251`, `w6k=`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for enc, want := range map[string]string{"": tt.hex, "hex": tt.hex, "escape": tt.escape, "base64": tt.base64} {
+				if got := FormatBytea(tt.b, &Options{TimePrecision: -1, BinaryEncoding: enc}); got != want {
+					t.Errorf("%q: got %q, want %q", enc, got, want)
+				}
+			}
+		})
+	}
+	for _, enc := range []string{"hex", "escape", "base64"} {
+		if err := CheckBinaryEncoding(enc); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := CheckBinaryEncoding("base32"); err == nil {
+		t.Error("base32: no error")
+	}
+}
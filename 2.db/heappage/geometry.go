@@ -0,0 +1,141 @@
+package heappage
+
+// Geometric types (utils/geo_decls.h). All coordinates are float8.
+//
+//	point    x, y                                 16 bytes      align 'd'
+//	lseg     p[2]                                 32 bytes      align 'd'
+//	box      high, low (upper-right, lower-left)  32 bytes      align 'd'
+//	line     A, B, C (Ax + By + C = 0)            24 bytes      align 'd'
+//	circle   center, radius                       24 bytes      align 'd'
+//	path     varlena: npts, closed, dummy, p[npts]              align 'd'
+//	polygon  varlena: npts, boundbox, p[npts]                   align 'd'
+//
+// Offsets inside path/polygon are given relative to the payload, i.e. after
+// the varlena header; the int32 "dummy" in PATH only pads p[] to 8 bytes.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	POINTOID   Oid = 600
+	LSEGOID    Oid = 601
+	PATHOID    Oid = 602
+	BOXOID     Oid = 603
+	POLYGONOID Oid = 604
+	LINEOID    Oid = 628
+	CIRCLEOID  Oid = 718
+)
+
+const pointLen = 16
+
+func init() {
+	RegisterType(POINTOID, TypeInfo{"point", pointLen, 'd', fixedStringDecoder(pointLen, decodePoint)})
+	RegisterType(LSEGOID, TypeInfo{"lseg", 2 * pointLen, 'd', fixedStringDecoder(2*pointLen, decodeLseg)})
+	RegisterType(BOXOID, TypeInfo{"box", 2 * pointLen, 'd', fixedStringDecoder(2*pointLen, decodeBox)})
+	RegisterType(LINEOID, TypeInfo{"line", 24, 'd', fixedStringDecoder(24, decodeLine)})
+	RegisterType(CIRCLEOID, TypeInfo{"circle", 24, 'd', fixedStringDecoder(24, decodeCircle)})
+	RegisterType(PATHOID, TypeInfo{"path", -1, 'd', varlenaDecoder(decodePath)})
+	RegisterType(POLYGONOID, TypeInfo{"polygon", -1, 'd', varlenaDecoder(decodePolygon)})
+}
+
+// formatFloat8 follows float8out with extra_float_digits > 0: the shortest
+// exact representation, switching to exponent form outside 1e-4..1e15.
+func formatFloat8(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	if a := math.Abs(f); a != 0 && (a < 1e-4 || a >= 1e15) {
+		return strconv.FormatFloat(f, 'e', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func readFloat8(buf []byte, off int) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf[off:]))
+}
+
+func formatPoint(buf []byte, off int) string {
+	return "(" + formatFloat8(readFloat8(buf, off)) + "," + formatFloat8(readFloat8(buf, off+8)) + ")"
+}
+
+// formatPoints renders npts points starting at off, comma-separated.
+func formatPoints(buf []byte, off, npts int) string {
+	parts := make([]string, npts)
+	for i := range parts {
+		parts[i] = formatPoint(buf, off+i*pointLen)
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodePoint(buf []byte, off int) (string, int) {
+	return formatPoint(buf, off), off + pointLen
+}
+
+func decodeLseg(buf []byte, off int) (string, int) {
+	return "[" + formatPoints(buf, off, 2) + "]", off + 2*pointLen
+}
+
+func decodeBox(buf []byte, off int) (string, int) {
+	return formatPoints(buf, off, 2), off + 2*pointLen
+}
+
+func decodeLine(buf []byte, off int) (string, int) {
+	return fmt.Sprintf("{%s,%s,%s}",
+		formatFloat8(readFloat8(buf, off)),
+		formatFloat8(readFloat8(buf, off+8)),
+		formatFloat8(readFloat8(buf, off+16))), off + 24
+}
+
+func decodeCircle(buf []byte, off int) (string, int) {
+	return "<" + formatPoint(buf, off) + "," + formatFloat8(readFloat8(buf, off+pointLen)) + ">", off + 24
+}
+
+// geoPointCount reads npts at nptsOff and checks that exactly npts points
+// follow at pointsOff.
+func geoPointCount(payload []byte, nptsOff, pointsOff int) (int, error) {
+	if pointsOff > len(payload) {
+		return 0, errors.New("geometric header truncated")
+	}
+	npts := int(int32(binary.LittleEndian.Uint32(payload[nptsOff:])))
+	if npts < 0 || pointsOff+npts*pointLen != len(payload) {
+		return 0, fmt.Errorf("npts=%d does not match %d payload bytes", npts, len(payload))
+	}
+	return npts, nil
+}
+
+// decodePath renders an open path as [(x,y),...] and a closed one as
+// ((x,y),...).
+func decodePath(payload []byte) (any, error) {
+	const pointsOff = 12 // npts, closed, dummy
+	npts, err := geoPointCount(payload, 0, pointsOff)
+	if err != nil {
+		return nil, err
+	}
+	open, end := "[", "]"
+	if binary.LittleEndian.Uint32(payload[4:]) != 0 {
+		open, end = "(", ")"
+	}
+	return open + formatPoints(payload, pointsOff, npts) + end, nil
+}
+
+// decodePolygon renders a polygon as ((x,y),...); the stored bounding box
+// is derived data and not shown, as in poly_out.
+func decodePolygon(payload []byte) (any, error) {
+	const pointsOff = 4 + 2*pointLen // npts, boundbox
+	npts, err := geoPointCount(payload, 0, pointsOff)
+	if err != nil {
+		return nil, err
+	}
+	return "(" + formatPoints(payload, pointsOff, npts) + ")", nil
+}
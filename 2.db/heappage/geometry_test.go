@@ -0,0 +1,71 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// float8s is the little-endian image of float8 values, as points are
+// stored.
+func float8s(fs ...float64) []byte {
+	var b []byte
+	for _, f := range fs {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(f))
+	}
+	return b
+}
+
+func int32s(vs ...int32) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, uint32(v))
+	}
+	return b
+}
+
+func TestDecodePathPolygon(t *testing.T) {
+	box := float8s(3, 4, 1, 2) // high, low corners
+	tests := []struct {
+		name  string
+		typ   Oid
+		datum []byte
+		want  string
+	}{
+		{"open path", PATHOID, varlena4(int32s(2, 0, 0), float8s(1, 2, 3, 4)), "[(1,2),(3,4)]"},
+		{"closed path", PATHOID, varlena4(int32s(2, 1, 0), float8s(1, 2, 3, 4)), "((1,2),(3,4))"},
+		{"path of one point", PATHOID, varlena4(int32s(1, 0, 0), float8s(-0.5, 1e20)), "[(-0.5,1e+20)]"},
+		{"polygon", POLYGONOID, varlena4(int32s(3), box, float8s(1, 2, 3, 4, 1, 4)), "((1,2),(3,4),(1,4))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, next, err := mustType(t, tt.typ).Decode(tt.datum, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != len(tt.datum) {
+				t.Errorf("got %v, next %d; want %s, next %d", v, next, tt.want, len(tt.datum))
+			}
+		})
+	}
+}
+
+func TestDecodePathPolygonErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   Oid
+		datum []byte
+	}{
+		{"npts past the points", PATHOID, varlena4(int32s(3, 0, 0), float8s(1, 2, 3, 4))},
+		{"negative npts", PATHOID, varlena4(int32s(-1, 0, 0))},
+		{"header truncated", PATHOID, varlena4(int32s(0, 0))},
+		{"polygon without its box", POLYGONOID, varlena4(int32s(0), float8s(1, 2))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, _, err := mustType(t, tt.typ).Decode(tt.datum, 0, nil); err == nil {
+				t.Errorf("no error, got %v", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Package heaptest builds heap tuple and page images for tests of code
+// built on heappage. heappage's own tests keep internal copies, since they
+// cannot import it.
+package heaptest
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// Tuple builds a tuple image the way heap_form_tuple lays one out: the
+// header with natts = len(vals), a NULL bitmap if a value is nil, t_hoff
+// MAXALIGNed, then each datum at its column's alignment. Values are int16,
+// int32, int64, uint32 (oid), uint8 ("char"), bool, string (text with a
+// 1-byte varlena header, or NUL-padded to a fixed-width column's attlen, as
+// for name) or []byte (a datum already encoded, varlena header included).
+// The tuple is inserted by xid 100 and committed.
+func Tuple(t testing.TB, cols []heappage.ColumnDef, vals []any) []byte {
+	t.Helper()
+	natts := len(vals)
+	var infomask uint16
+	hoff := heappage.RowHeaderByteLen
+	for _, v := range vals {
+		if v == nil {
+			infomask |= heappage.HEAP_HASNULL
+			hoff += (natts + 7) / 8
+			break
+		}
+	}
+	hoff = heappage.Align(hoff, 'd')
+
+	tup := make([]byte, hoff, hoff+64)
+	for i, v := range vals {
+		if v == nil {
+			continue
+		}
+		if infomask&heappage.HEAP_HASNULL != 0 {
+			tup[heappage.RowHeaderByteLen+i/8] |= 1 << (i % 8)
+		}
+		var datum []byte
+		switch x := v.(type) {
+		case int16:
+			datum = binary.LittleEndian.AppendUint16(nil, uint16(x))
+		case int32:
+			datum = binary.LittleEndian.AppendUint32(nil, uint32(x))
+		case int64:
+			datum = binary.LittleEndian.AppendUint64(nil, uint64(x))
+		case uint32:
+			datum = binary.LittleEndian.AppendUint32(nil, x)
+		case uint8:
+			datum = []byte{x}
+		case bool:
+			datum = []byte{0}
+			if x {
+				datum[0] = 1
+			}
+		case string:
+			if cols[i].Len > 0 {
+				datum = make([]byte, cols[i].Len)
+				copy(datum, x)
+				break
+			}
+			if len(x) > 126 {
+				t.Fatalf("heaptest.Tuple: text of %d bytes needs a 4-byte header", len(x))
+			}
+			datum = append([]byte{byte(len(x)+1)<<1 | 1}, x...)
+		case []byte:
+			datum = x
+		default:
+			t.Fatalf("heaptest.Tuple: unsupported value %T", v)
+		}
+		if cols[i].Len == -1 {
+			infomask |= heappage.HEAP_HASVARWIDTH
+		}
+		off := len(tup)
+		if cols[i].Len != -1 || datum[0]&0x01 == 0 {
+			off = heappage.Align(off, cols[i].Align)
+		}
+		tup = append(tup, make([]byte, off-len(tup))...)
+		tup = append(tup, datum...)
+	}
+	binary.LittleEndian.PutUint32(tup[0:], 100)            // xmin
+	binary.LittleEndian.PutUint16(tup[16:], 1)             // ctid offset
+	binary.LittleEndian.PutUint16(tup[18:], uint16(natts)) // infomask2
+	binary.LittleEndian.PutUint16(tup[20:], infomask|heappage.HEAP_XMIN_COMMITTED|heappage.HEAP_XMAX_INVALID)
+	tup[22] = byte(hoff)
+	return tup
+}
+
+// Varlena4 prefixes payload with an uncompressed 4-byte varlena header.
+func Varlena4(payload ...[]byte) []byte {
+	d := make([]byte, 4)
+	for _, p := range payload {
+		d = append(d, p...)
+	}
+	binary.LittleEndian.PutUint32(d, uint32(len(d))<<2)
+	return d
+}
+
+// TextArray is a text[] datum without NULLs.
+func TextArray(elems ...string) []byte {
+	data := Int32s(1, 0, int32(heappage.TEXTOID), int32(len(elems)), 1)
+	for _, e := range elems {
+		data = append(data, make([]byte, heappage.Align(len(data)+4, 'i')-len(data)-4)...)
+		data = append(data, Varlena4([]byte(e))...)
+	}
+	return Varlena4(data)
+}
+
+// Page builds a heap page holding the tuples, with NORMAL line pointers in
+// order and the tuples placed from the end of the page down, each
+// MAXALIGNed as PageAddItem does, and a valid checksum for block blkno.
+func Page(t testing.TB, blkno uint32, tuples ...[]byte) []byte {
+	t.Helper()
+	page := make([]byte, heappage.PageSize)
+	lower, upper := heappage.PageHeaderByteLen, heappage.PageSize
+	for _, tup := range tuples {
+		upper = (upper - len(tup)) &^ 7
+		if upper < lower+heappage.ItemIDByteLen {
+			t.Fatalf("heaptest.Page: %d tuples do not fit", len(tuples))
+		}
+		copy(page[upper:], tup)
+		binary.LittleEndian.PutUint32(page[lower:], uint32(upper)|heappage.LP_NORMAL<<15|uint32(len(tup))<<17)
+		lower += heappage.ItemIDByteLen
+	}
+	binary.LittleEndian.PutUint16(page[12:], uint16(lower))
+	binary.LittleEndian.PutUint16(page[14:], uint16(upper))
+	binary.LittleEndian.PutUint16(page[16:], heappage.PageSize)
+	binary.LittleEndian.PutUint16(page[18:], heappage.PageSize|heappage.PageLayoutVersion)
+	binary.LittleEndian.PutUint16(page[8:], heappage.PageChecksum(page, blkno))
+	return page
+}
+
+// RowHeader parses the header of a tuple built by Tuple.
+func RowHeader(t testing.TB, tuple []byte) *heappage.RowHeader {
+	t.Helper()
+	rh, err := heappage.ParseRowHeader(tuple)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rh
+}
+
+// Int32s encodes vs little-endian, back to back.
+func Int32s(vs ...int32) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, uint32(v))
+	}
+	return b
+}
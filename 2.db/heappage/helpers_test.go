@@ -0,0 +1,127 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// mustType returns the registered type of oid, failing the test if there is
+// none.
+func mustType(t *testing.T, oid Oid) TypeInfo {
+	t.Helper()
+	ti, ok := LookupType(oid)
+	if !ok {
+		t.Fatalf("type %d not registered", oid)
+	}
+	return ti
+}
+
+// heapTuple builds a tuple image the way heap_form_tuple lays one out: the
+// header with natts = len(vals), a NULL bitmap if a value is nil, t_hoff
+// MAXALIGNed, then each datum at its column's alignment. Values are int16,
+// int32, int64, uint32 (oid), uint8 ("char"), bool, string (text with a
+// 1-byte varlena header, or NUL-padded to a fixed-width column's attlen, as
+// for name) or []byte (a datum already encoded, varlena header included).
+func heapTuple(t *testing.T, cols []ColumnDef, vals []any) []byte {
+	t.Helper()
+	natts := len(vals)
+	var infomask uint16
+	hoff := RowHeaderByteLen
+	for _, v := range vals {
+		if v == nil {
+			infomask |= HEAP_HASNULL
+			hoff += (natts + 7) / 8
+			break
+		}
+	}
+	hoff = Align(hoff, 'd')
+
+	tup := make([]byte, hoff, hoff+64)
+	for i, v := range vals {
+		if v == nil {
+			continue
+		}
+		if infomask&HEAP_HASNULL != 0 {
+			tup[RowHeaderByteLen+i/8] |= 1 << (i % 8)
+		}
+		var datum []byte
+		switch x := v.(type) {
+		case int16:
+			datum = binary.LittleEndian.AppendUint16(nil, uint16(x))
+		case int32:
+			datum = binary.LittleEndian.AppendUint32(nil, uint32(x))
+		case int64:
+			datum = binary.LittleEndian.AppendUint64(nil, uint64(x))
+		case uint32:
+			datum = binary.LittleEndian.AppendUint32(nil, x)
+		case uint8:
+			datum = []byte{x}
+		case bool:
+			datum = []byte{0}
+			if x {
+				datum[0] = 1
+			}
+		case string:
+			if cols[i].Len > 0 {
+				datum = make([]byte, cols[i].Len)
+				copy(datum, x)
+				break
+			}
+			if len(x) > 126 {
+				t.Fatalf("heapTuple: text of %d bytes needs a 4-byte header", len(x))
+			}
+			datum = append([]byte{byte(len(x)+1)<<1 | 1}, x...)
+		case []byte:
+			datum = x
+		default:
+			t.Fatalf("heapTuple: unsupported value %T", v)
+		}
+		if cols[i].Len == -1 {
+			infomask |= HEAP_HASVARWIDTH
+		}
+		off := len(tup)
+		if cols[i].Len != -1 || datum[0]&0x01 == 0 {
+			off = Align(off, cols[i].Align)
+		}
+		tup = append(tup, make([]byte, off-len(tup))...)
+		tup = append(tup, datum...)
+	}
+	binary.LittleEndian.PutUint32(tup[0:], 100)            // xmin
+	binary.LittleEndian.PutUint16(tup[16:], 1)             // ctid offset
+	binary.LittleEndian.PutUint16(tup[18:], uint16(natts)) // infomask2
+	binary.LittleEndian.PutUint16(tup[20:], infomask|HEAP_XMIN_COMMITTED|HEAP_XMAX_INVALID)
+	tup[22] = byte(hoff)
+	return tup
+}
+
+// varlena4 prefixes payload with an uncompressed 4-byte varlena header.
+func varlena4(payload ...[]byte) []byte {
+	d := make([]byte, 4)
+	for _, p := range payload {
+		d = append(d, p...)
+	}
+	binary.LittleEndian.PutUint32(d, uint32(len(d))<<2)
+	return d
+}
+
+// compositeDatum builds a composite datum of the given fields: a tuple like
+// heapTuple's whose first 12 bytes are DatumTupleFields, datum_len_ being
+// the 4-byte varlena header.
+func compositeDatum(t *testing.T, fields []ColumnDef, vals []any) []byte {
+	t.Helper()
+	d := heapTuple(t, fields, vals)
+	binary.LittleEndian.PutUint32(d[0:], uint32(len(d))<<2)
+	binary.LittleEndian.PutUint32(d[4:], 0xFFFFFFFF) // datum_typmod -1
+	binary.LittleEndian.PutUint32(d[8:], uint32(RECORDOID))
+	return d
+}
+
+// mustRowHeader parses the header of a tuple built by heapTuple.
+func mustRowHeader(t *testing.T, tuple []byte) *RowHeader {
+	t.Helper()
+	rh, err := ParseRowHeader(tuple)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rh
+}
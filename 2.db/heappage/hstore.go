@@ -0,0 +1,100 @@
+package heappage
+
+// hstore (contrib/hstore/hstore.h). An extension type, so its oid differs
+// per cluster: -hstore-oid registers it (SELECT 'hstore'::regtype::oid).
+//
+//	uint32 size_     HS_FLAG_NEWVERSION (0x80000000) | count
+//	HEntry[2*count]  key, value, key, value, ...: end offset into the
+//	                 strings in the low 30 bits, ISFIRST, ISNULL (values)
+//	char   strings[]
+//
+// Pairs are stored sorted by key, as hstore_out prints them.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	hstoreNewVersion = 0x80000000
+	hstoreCountMask  = 0x0FFFFFFF
+	hentryIsFirst    = 0x80000000
+	hentryIsNull     = 0x40000000
+	hentryPosMask    = 0x3FFFFFFF
+)
+
+// RegisterHstore registers hstore under the cluster's oid for it.
+func RegisterHstore(oid Oid) {
+	RegisterType(oid, TypeInfo{"hstore", -1, 'i', varlenaDecoderWith(func(payload []byte, opt *Options) (any, error) {
+		return decodeHstore(payload, opt)
+	})})
+}
+
+// decodeHstore renders an hstore like hstore_out: "k1"=>"v1", "k2"=>NULL.
+// A NULL value and an empty string stay distinct. payload starts after the
+// varlena header.
+func decodeHstore(payload []byte, opt *Options) (string, error) {
+	if len(payload) < 4 {
+		return "", errors.New("hstore header truncated")
+	}
+	size := binary.LittleEndian.Uint32(payload)
+	if size&hstoreNewVersion == 0 && size != 0 {
+		return "", errors.New("pre-9.0 hstore format not supported")
+	}
+	count := int(size & hstoreCountMask)
+	strOff := 4 + 8*count
+	if count > len(payload)/8 || strOff > len(payload) {
+		return "", fmt.Errorf("hstore count %d does not fit %d payload bytes", count, len(payload))
+	}
+	strs := payload[strOff:]
+
+	entry := func(i int) (s string, null bool, err error) {
+		he := binary.LittleEndian.Uint32(payload[4+4*i:])
+		start := 0
+		if i > 0 && he&hentryIsFirst == 0 {
+			start = int(binary.LittleEndian.Uint32(payload[4+4*(i-1):]) & hentryPosMask)
+		}
+		end := int(he & hentryPosMask)
+		if start > end || end > len(strs) {
+			return "", false, fmt.Errorf("hstore entry %d spans %d..%d of %d bytes", i, start, end, len(strs))
+		}
+		return opt.serverString(strs[start:end]), he&hentryIsNull != 0, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < count; i++ {
+		key, _, err := entry(2 * i)
+		if err != nil {
+			return "", err
+		}
+		val, null, err := entry(2*i + 1)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		writeHstoreString(&b, key)
+		b.WriteString("=>")
+		if null {
+			b.WriteString("NULL")
+		} else {
+			writeHstoreString(&b, val)
+		}
+	}
+	return b.String(), nil
+}
+
+// writeHstoreString quotes s, backslash-escaping '"' and '\'.
+func writeHstoreString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+}
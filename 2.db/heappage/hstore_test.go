@@ -0,0 +1,89 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// hstoreOID stands in for the cluster's hstore oid in these tests.
+const hstoreOID Oid = 16620
+
+// hstoreDatum lays out pairs (key, value, key, value, ...; a nil value is
+// NULL) the way hstorePairs does, in the order given: the new-format count,
+// the HEntries with their end offsets, then the strings.
+func hstoreDatum(pairs ...*string) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, hstoreNewVersion|uint32(len(pairs)/2))
+	var strs []byte
+	for i, s := range pairs {
+		var he uint32
+		if i == 0 {
+			he |= hentryIsFirst
+		}
+		if s == nil {
+			he |= hentryIsNull
+		} else {
+			strs = append(strs, *s...)
+		}
+		b = binary.LittleEndian.AppendUint32(b, he|uint32(len(strs)))
+	}
+	return varlena4(b, strs)
+}
+
+func hs(s string) *string { return &s }
+
+func TestDecodeHstore(t *testing.T) {
+	RegisterHstore(hstoreOID)
+	tests := []struct {
+		name  string
+		datum []byte
+		want  string
+	}{
+		{"empty", hstoreDatum(), ""},
+		{"pair", hstoreDatum(hs("a"), hs("1")), `"a"=>"1"`},
+		{"pairs", hstoreDatum(hs("a"), hs("1"), hs("bb"), hs("two")), `"a"=>"1", "bb"=>"two"`},
+		{"null value", hstoreDatum(hs("a"), nil), `"a"=>NULL`},
+		{"null between values", hstoreDatum(hs("a"), hs("x"), hs("b"), nil, hs("c"), hs("y")),
+			`"a"=>"x", "b"=>NULL, "c"=>"y"`},
+		{"empty value is not null", hstoreDatum(hs("a"), hs(""), hs("b"), nil), `"a"=>"", "b"=>NULL`},
+		{"string NULL", hstoreDatum(hs("a"), hs("NULL")), `"a"=>"NULL"`},
+		{"quote", hstoreDatum(hs(`say "hi"`), hs(`"`)), `"say \"hi\""=>"\""`},
+		{"backslash", hstoreDatum(hs(`c:\dir`), hs(`\\`)), `"c:\\dir"=>"\\\\"`},
+		{"arrow and comma", hstoreDatum(hs("a=>b"), hs("c, d")), `"a=>b"=>"c, d"`},
+		{"space", hstoreDatum(hs(" k "), hs("v w")), `" k "=>"v w"`},
+		{"multibyte", hstoreDatum(hs("ключ"), hs("значение")), `"ключ"=>"значение"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, next, err := mustType(t, hstoreOID).Decode(tt.datum, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != len(tt.datum) {
+				t.Errorf("got %q, next %d; want %q, next %d", v, next, tt.want, len(tt.datum))
+			}
+		})
+	}
+}
+
+func TestDecodeHstoreErrors(t *testing.T) {
+	good := hstoreDatum(hs("key"), hs("value"))[4:]
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"header truncated", []byte{1, 0}, "header truncated"},
+		{"old format", append([]byte{1, 0, 0, 0}, good[4:]...), "pre-9.0"},
+		{"entries past the end", good[:8], "does not fit"},
+		{"string past the end", good[:len(good)-1], "spans 3..8 of 7 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := decodeHstore(tt.payload, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %q, %v; want error %q", v, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package heappage
+
+// Block and offset numbers, and the ItemPointer (TID) built from them
+// (storage/block.h, storage/off.h, storage/itemptr.h).
+//
+// On disk an ItemPointerData is 6 bytes: the block number split into two
+// uint16 halves (BlockIdData, high half first) so that the struct needs only
+// 2-byte alignment, then the offset number.
+
+import (
+	"fmt"
+)
+
+type BlockNumber uint32
+
+// OffsetNumber is a 1-based index into a page's line pointer array.
+type OffsetNumber uint16
+
+const (
+	InvalidBlockNumber  BlockNumber  = 0xFFFFFFFF
+	InvalidOffsetNumber OffsetNumber = 0
+	FirstOffsetNumber   OffsetNumber = 1
+	MaxOffsetNumber     OffsetNumber = PageSize / ItemIDByteLen
+
+	// Out-of-range offsets that give t_ctid a special meaning (htup_details.h,
+	// itemptr.h): a speculative insertion in progress, with the token in the
+	// block number, and a row moved to another partition by UPDATE.
+	SpecTokenOffsetNumber       OffsetNumber = 0xfffe
+	MovedPartitionsOffsetNumber OffsetNumber = 0xfffd
+	MovedPartitionsBlockNumber               = InvalidBlockNumber
+)
+
+// ItemPointer identifies a tuple version: block and line pointer.
+type ItemPointer struct {
+	Block  BlockNumber
+	Offset OffsetNumber
+}
+
+// MakeItemPointer assembles an ItemPointer from its on-disk BlockIdData
+// halves.
+func MakeItemPointer(blockHi, blockLo uint16, off OffsetNumber) ItemPointer {
+	return ItemPointer{Block: BlockNumber(blockHi)<<16 | BlockNumber(blockLo), Offset: off}
+}
+
+// BlockID splits the block number into the on-disk (bi_hi, bi_lo) halves.
+func (p ItemPointer) BlockID() (hi, lo uint16) {
+	return uint16(p.Block >> 16), uint16(p.Block)
+}
+
+func (p ItemPointer) IsValid() bool {
+	return p.Block != InvalidBlockNumber && p.Offset != InvalidOffsetNumber
+}
+
+// IndicatesMovedPartitions reports the marker left in t_ctid when UPDATE
+// moved the row to another partition.
+func (p ItemPointer) IndicatesMovedPartitions() bool {
+	return p.Block == MovedPartitionsBlockNumber && p.Offset == MovedPartitionsOffsetNumber
+}
+
+// String formats the pointer as PostgreSQL prints a tid: (block,offset).
+func (p ItemPointer) String() string {
+	return fmt.Sprintf("(%d,%d)", p.Block, p.Offset)
+}
@@ -0,0 +1,250 @@
+package heappage
+
+// json and jsonb (utils/jsonb.h). json is the input text as typed, kept in
+// a text varlena; only jsonb is the binary tree below. A jsonb datum is a
+// varlena holding one JsonbContainer:
+//
+//	uint32 header     count (28 bits) | JB_FSCALAR | JB_FOBJECT | JB_FARRAY
+//	JEntry children[] arrays: count entries; objects: count keys followed by
+//	                  count values, keys sorted by (length, bytes)
+//	...    data       the children's values back to back
+//
+// A JEntry is 3 type bits and 28 bits that are either the value's length or,
+// when JENTRY_HAS_OFF is set (every JB_OFFSET_STRIDE-th entry), the end
+// offset of the value relative to the start of the data. A value's start is
+// thus the sum of the preceding lengths back to the nearest offset.
+// Numerics and nested containers are padded to 4 bytes; the padding counts
+// towards their length.
+//
+// A top-level scalar is stored as a one-element array with JB_FSCALAR set.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	JSONOID  Oid = 114
+	JSONBOID Oid = 3802
+)
+
+const (
+	jbCountMask = 0x0FFFFFFF
+	jbFScalar   = 0x10000000
+	jbFObject   = 0x20000000
+	jbFArray    = 0x40000000
+
+	jentryOffLenMask = 0x0FFFFFFF
+	jentryTypeMask   = 0x70000000
+	jentryHasOff     = 0x80000000
+
+	jentryIsString    = 0x00000000
+	jentryIsNumeric   = 0x10000000
+	jentryIsBoolFalse = 0x20000000
+	jentryIsBoolTrue  = 0x30000000
+	jentryIsNull      = 0x40000000
+	jentryIsContainer = 0x50000000
+)
+
+// maxJsonbDepth bounds recursion on corrupted data; PostgreSQL itself
+// limits nesting only by stack depth.
+const maxJsonbDepth = 1000
+
+func init() {
+	RegisterType(JSONOID, TypeInfo{"json", -1, 'i', varlenaDecoderWith(decodeJSON)})
+	RegisterType(JSONBOID, TypeInfo{"jsonb", -1, 'i', varlenaDecoderWith(decodeJsonbAny)})
+}
+
+// decodeJSON returns a json value as stored, or indented with
+// opt.PrettyJSON.
+func decodeJSON(payload []byte, opt *Options) (any, error) {
+	return prettyJSON(opt.serverString(payload), opt), nil
+}
+
+func decodeJsonbAny(payload []byte, opt *Options) (any, error) {
+	s, err := decodeJsonb(payload, opt)
+	if err != nil {
+		return nil, err
+	}
+	return prettyJSON(s, opt), nil
+}
+
+// prettyJSON indents s if opt.PrettyJSON asks for it. A json value that
+// does not parse is a sign of corruption, since json_in validated it; it is
+// returned as stored.
+func prettyJSON(s string, opt *Options) string {
+	if !opt.orDefault().PrettyJSON {
+		return s
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(s), "", "  "); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// decodeJsonb renders a jsonb payload the way jsonb_out does, e.g.
+// {"a": {"b": [1, 2, {"c": true}]}}.
+func decodeJsonb(payload []byte, opt *Options) (string, error) {
+	var sb strings.Builder
+	if err := writeJsonbContainer(&sb, payload, 0, opt); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func writeJsonbContainer(sb *strings.Builder, c []byte, depth int, opt *Options) error {
+	if depth > maxJsonbDepth {
+		return errors.New("jsonb nested too deeply")
+	}
+	if len(c) < 4 {
+		return errors.New("jsonb container header truncated")
+	}
+	header := binary.LittleEndian.Uint32(c)
+	count := int(header & jbCountMask)
+	nEntries := count
+	if header&jbFObject != 0 {
+		nEntries = 2 * count
+	}
+	dataStart := 4 + 4*nEntries
+	if nEntries > len(c) || dataStart > len(c) {
+		return fmt.Errorf("jsonb container: %d entries do not fit in %d bytes", nEntries, len(c))
+	}
+	entries := make([]uint32, nEntries)
+	for i := range entries {
+		entries[i] = binary.LittleEndian.Uint32(c[4+4*i:])
+	}
+	data := c[dataStart:]
+
+	// value renders entry i; see getJsonbOffset/getJsonbLength.
+	value := func(i int) error {
+		start := 0
+		for j := i - 1; j >= 0; j-- {
+			start += int(entries[j] & jentryOffLenMask)
+			if entries[j]&jentryHasOff != 0 {
+				break
+			}
+		}
+		end := int(entries[i] & jentryOffLenMask)
+		if entries[i]&jentryHasOff == 0 {
+			end += start
+		}
+		if start > end || end > len(data) {
+			return fmt.Errorf("jsonb entry %d: [%d,%d) outside %d data bytes", i, start, end, len(data))
+		}
+		return writeJsonbValue(sb, entries[i], data, start, end, depth, opt)
+	}
+
+	switch {
+	case header&jbFArray != 0 && header&jbFScalar != 0:
+		if count != 1 {
+			return fmt.Errorf("jsonb scalar container with %d elements", count)
+		}
+		return value(0)
+	case header&jbFArray != 0:
+		sb.WriteByte('[')
+		for i := 0; i < count; i++ {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if err := value(i); err != nil {
+				return err
+			}
+		}
+		sb.WriteByte(']')
+	case header&jbFObject != 0:
+		sb.WriteByte('{')
+		for i := 0; i < count; i++ {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if entries[i]&jentryTypeMask != jentryIsString {
+				return fmt.Errorf("jsonb object key %d is not a string", i)
+			}
+			if err := value(i); err != nil {
+				return err
+			}
+			sb.WriteString(": ")
+			if err := value(count + i); err != nil {
+				return err
+			}
+		}
+		sb.WriteByte('}')
+	default:
+		return fmt.Errorf("jsonb container header 0x%08x is neither array nor object", header)
+	}
+	return nil
+}
+
+// writeJsonbValue renders the value in data[start:end]. Numerics and
+// containers start at the next 4-byte boundary; data itself is 4-aligned
+// within the container, so aligning start is enough.
+func writeJsonbValue(sb *strings.Builder, entry uint32, data []byte, start, end, depth int, opt *Options) error {
+	kind := entry & jentryTypeMask
+	if kind == jentryIsNumeric || kind == jentryIsContainer {
+		start = Align(start, 'i')
+		if start > end {
+			return errors.New("jsonb entry padding runs past its end")
+		}
+	}
+	b := data[start:end]
+	switch kind {
+	case jentryIsString:
+		writeJSONString(sb, []byte(opt.serverString(b)))
+	case jentryIsContainer:
+		return writeJsonbContainer(sb, b, depth+1, opt)
+	case jentryIsNumeric:
+		payload, _, err := ReadVarlenaLE(b, 0)
+		if err != nil {
+			return fmt.Errorf("jsonb numeric: %w", err)
+		}
+		s, err := decodeNumeric(payload)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(s)
+	case jentryIsBoolFalse:
+		sb.WriteString("false")
+	case jentryIsBoolTrue:
+		sb.WriteString("true")
+	case jentryIsNull:
+		sb.WriteString("null")
+	default:
+		return fmt.Errorf("unknown jsonb entry type 0x%08x", kind)
+	}
+	return nil
+}
+
+// writeJSONString quotes s like escape_json.
+func writeJSONString(sb *strings.Builder, s []byte) {
+	sb.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(sb, `\u%04x`, c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+	sb.WriteByte('"')
+}
@@ -0,0 +1,166 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Container images below are laid out after convertJsonbValue in
+// jsonb_util.c: the first JEntry of a container carries an offset, the
+// others lengths, and numerics and nested containers are padded to 4 bytes.
+
+func TestDecodeJsonb(t *testing.T) {
+	tests := []struct {
+		name      string
+		container []byte
+		want      string
+	}{
+		{"empty array", []byte{0x00, 0x00, 0x00, 0x40}, "[]"},
+		{"empty object", []byte{0x00, 0x00, 0x00, 0x20}, "{}"},
+		{"scalar string", []byte{
+			0x01, 0x00, 0x00, 0x50, // 1 element, JB_FSCALAR | JB_FARRAY
+			0x01, 0x00, 0x00, 0x80, // string ending at 1
+			'x',
+		}, `"x"`},
+		{"null, false, utf-8", []byte{
+			0x03, 0x00, 0x00, 0x40,
+			0x00, 0x00, 0x00, 0xc0, // null, offset 0
+			0x00, 0x00, 0x00, 0x20, // false
+			0x02, 0x00, 0x00, 0x00, // string of 2
+			0xc3, 0xa9,
+		}, `[null, false, "é"]`},
+		{"object keys by length, escapes, padded numeric", []byte{
+			0x02, 0x00, 0x00, 0x20, // 2 pairs
+			0x01, 0x00, 0x00, 0x80, // "b", ending at 1
+			0x02, 0x00, 0x00, 0x00, // "aa"
+			0x03, 0x00, 0x00, 0x00, // "q\"\n"
+			0x07, 0x00, 0x00, 0x10, // numeric, 2 bytes of padding included
+			'b', 'a', 'a', 'q', '"', '\n', 0x00, 0x00,
+			0x0b, 0x00, 0x80, 0x01, 0x00, // numeric 1
+		}, `{"b": "q\"\n", "aa": 1}`},
+		{"nested", []byte{
+			0x01, 0x00, 0x00, 0x20,
+			0x01, 0x00, 0x00, 0x80, // "a"
+			0x40, 0x00, 0x00, 0x50, // container of 64 bytes, 3 of padding
+			'a', 0x00, 0x00, 0x00,
+			0x01, 0x00, 0x00, 0x20,
+			0x01, 0x00, 0x00, 0x80, // "b"
+			0x30, 0x00, 0x00, 0x50, // container of 48, 3 of padding
+			'b', 0x00, 0x00, 0x00,
+			0x03, 0x00, 0x00, 0x40,
+			0x05, 0x00, 0x00, 0x90, // numeric ending at 5
+			0x08, 0x00, 0x00, 0x10, // numeric of 8, 3 of padding
+			0x10, 0x00, 0x00, 0x50, // container of 16
+			0x0b, 0x00, 0x80, 0x01, 0x00, 0x00, 0x00, 0x00,
+			0x0b, 0x00, 0x80, 0x02, 0x00, 0x00, 0x00, 0x00,
+			0x01, 0x00, 0x00, 0x20,
+			0x01, 0x00, 0x00, 0x80, // "c"
+			0x00, 0x00, 0x00, 0x30, // true
+			'c',
+		}, `{"a": {"b": [1, 2, {"c": true}]}}`},
+		{"stride", jsonbStrideArray(), "[" + strings.Repeat(`"ab", `, 32) + `"ab"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datum := varlena4(tt.container)
+			v, next, err := mustType(t, JSONBOID).Decode(datum, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != len(datum) {
+				t.Errorf("got %v, next %d\nwant %s, next %d", v, next, tt.want, len(datum))
+			}
+		})
+	}
+}
+
+// jsonbStrideArray is an array of 33 "ab" strings, long enough for the
+// 33rd JEntry to carry an offset (JB_OFFSET_STRIDE) and not a length.
+func jsonbStrideArray() []byte {
+	const n = 33
+	c := binary.LittleEndian.AppendUint32(nil, n|jbFArray)
+	for i := range n {
+		entry := uint32(2)
+		if i%32 == 0 {
+			entry = uint32(2*(i+1)) | jentryHasOff
+		}
+		c = binary.LittleEndian.AppendUint32(c, entry)
+	}
+	return append(c, strings.Repeat("ab", n)...)
+}
+
+func TestDecodeJsonbErrors(t *testing.T) {
+	// each level an array holding the next as its only element
+	deep := []byte{0x00, 0x00, 0x00, 0x40}
+	for range maxJsonbDepth + 1 {
+		entry := uint32(len(deep)) | jentryIsContainer | jentryHasOff
+		deep = append(binary.LittleEndian.AppendUint32([]byte{0x01, 0x00, 0x00, 0x40}, entry), deep...)
+	}
+
+	tests := []struct {
+		name      string
+		container []byte
+		want      string
+	}{
+		{"header truncated", []byte{0x01, 0x00}, "header truncated"},
+		{"entries past the end", []byte{0x05, 0x00, 0x00, 0x40, 0x00}, "do not fit"},
+		{"value past the data", []byte{0x01, 0x00, 0x00, 0x40, 0x09, 0x00, 0x00, 0x80, 'x'}, "outside 1 data bytes"},
+		{"neither array nor object", []byte{0x00, 0x00, 0x00, 0x00}, "neither array nor object"},
+		{"numeric key", []byte{0x01, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x90, 0x00, 0x00, 0x00, 0x40}, "not a string"},
+		{"too deep", deep, "nested too deeply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeJsonb(tt.container, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// json keeps the text as typed; jsonb is the parsed tree, with keys
+// sorted and whitespace normalized.
+func TestJSONBesideJsonb(t *testing.T) {
+	cols := []ColumnDef{Column("doc", JSONOID), Column("docb", JSONBOID)}
+	jsonb := varlena4([]byte{
+		0x02, 0x00, 0x00, 0x20,
+		0x01, 0x00, 0x00, 0x80, // "a"
+		0x01, 0x00, 0x00, 0x00, // "b"
+		0x0a, 0x00, 0x00, 0x50, // [true], 2 bytes of padding included
+		0x05, 0x00, 0x00, 0x10, // 1
+		'a', 'b', 0x00, 0x00,
+		0x01, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0xb0,
+		0x0b, 0x00, 0x80, 0x01, 0x00,
+	})
+	text := `{"b":1,  "a":[true]}`
+	tup := heapTuple(t, cols, []any{text, jsonb})
+
+	decode := func(opt *Options) []any {
+		t.Helper()
+		row, err := DecodeRow(tup, mustRowHeader(t, tup), cols, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return row
+	}
+	if got, want := decode(nil), []any{text, `{"a": [true], "b": 1}`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	pretty := &Options{TimePrecision: -1, PrettyJSON: true}
+	want := "{\n  \"b\": 1,\n  \"a\": [\n    true\n  ]\n}"
+	wantb := "{\n  \"a\": [\n    true\n  ],\n  \"b\": 1\n}"
+	if got := decode(pretty); !reflect.DeepEqual(got, []any{want, wantb}) {
+		t.Errorf("-pretty-json: got %q, want %q", got, []any{want, wantb})
+	}
+
+	// json_in validated it, so bad json is corruption and shown as stored
+	bad := heapTuple(t, cols[:1], []any{`{"a":`})
+	row, err := DecodeRow(bad, mustRowHeader(t, bad), cols[:1], pretty)
+	if err != nil || row[0] != `{"a":` {
+		t.Errorf("invalid json: got %q, %v", row[0], err)
+	}
+}
@@ -0,0 +1,110 @@
+package heappage
+
+// Locale-style display of numeric and money (-locale). Only the handful of
+// conventions below are known, kept as a table rather than read from the
+// system's locale database; grouping is always by three digits.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NumberLocale holds the lconv fields the numeric and money decoders use.
+// An empty Group means no grouping for numeric; money still groups with ",",
+// like cash_out.
+type NumberLocale struct {
+	Group          string
+	Decimal        string
+	CurrencyPrefix string
+	CurrencySuffix string
+}
+
+var cLocale = &NumberLocale{Decimal: ".", CurrencyPrefix: "$"}
+
+var numberLocales = map[string]*NumberLocale{
+	"C":     cLocale,
+	"POSIX": cLocale,
+	"en_US": {Group: ",", Decimal: ".", CurrencyPrefix: "$"},
+	"en_GB": {Group: ",", Decimal: ".", CurrencyPrefix: "£"},
+	"de_DE": {Group: ".", Decimal: ",", CurrencySuffix: " €"},
+	"de_CH": {Group: "'", Decimal: ".", CurrencyPrefix: "CHF "},
+	"fr_FR": {Group: " ", Decimal: ",", CurrencySuffix: " €"},
+	"ru_RU": {Group: " ", Decimal: ",", CurrencySuffix: " ₽"},
+}
+
+// LookupLocale returns the numberLocales key of a -locale name. An encoding
+// suffix such as ".UTF-8" is ignored.
+func LookupLocale(name string) (string, error) {
+	base, _, _ := strings.Cut(name, ".")
+	if _, ok := numberLocales[base]; !ok {
+		names := make([]string, 0, len(numberLocales))
+		for n := range numberLocales {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("unknown locale %q (known: %s)", name, strings.Join(names, ", "))
+	}
+	return base, nil
+}
+
+// LocaleDisplay shows a numeric or money column with the separators of
+// locale, a name LookupLocale returned, for text output only: the decoders
+// keep numeric_out and C-locale cash_out text, which exports can load back.
+// v is the decoded value of the datum at buf[off:]; values inside arrays,
+// ranges and composites are left as they are, where a grouping comma would
+// be ambiguous.
+func LocaleDisplay(buf []byte, off int, typ Oid, v any, locale string) string {
+	loc := numberLocales[locale]
+	if loc == nil {
+		return ""
+	}
+	switch typ {
+	case NUMERICOID:
+		if s, ok := v.(string); ok {
+			return formatNumericLocale(s, loc)
+		}
+	case CASHOID:
+		if off+8 <= len(buf) {
+			return formatCash(int64(binary.LittleEndian.Uint64(buf[off:])), loc)
+		}
+	}
+	return ""
+}
+
+// formatNumericLocale regroups numeric_out text such as -1234567.89. NaN and
+// the infinities pass through.
+func formatNumericLocale(s string, loc *NumberLocale) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return sign + s
+	}
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+	out := sign + groupDigits(intPart, loc.Group)
+	if hasFrac {
+		out += loc.Decimal + frac
+	}
+	return out
+}
+
+// groupDigits inserts sep between groups of three digits from the right.
+func groupDigits(digits, sep string) string {
+	if sep == "" || len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % 3
+	if head == 0 {
+		head = 3
+	}
+	b.WriteString(digits[:head])
+	for i := head; i < len(digits); i += 3 {
+		b.WriteString(sep)
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package heappage
+
+import (
+	"math"
+	"testing"
+)
+
+// money keeps cash_out's C-locale text as its value; -locale changes only
+// the text display, with the locale's separators and currency symbol.
+func TestMoneyLocale(t *testing.T) {
+	tests := []struct {
+		cents  int64
+		locale string
+		want   string
+	}{
+		{123456789, "C", "$1,234,567.89"},
+		{123456789, "en_US", "$1,234,567.89"},
+		{123456789, "en_GB", "£1,234,567.89"},
+		{123456789, "de_DE", "1.234.567,89 €"},
+		{123456789, "de_CH", "CHF 1'234'567.89"},
+		{123456789, "fr_FR", "1 234 567,89 €"},
+		{123456789, "ru_RU", "1 234 567,89 ₽"},
+		{-123456, "de_DE", "-1.234,56 €"},
+		{-5, "de_DE", "-0,05 €"},
+		{100000, "fr_FR", "1 000,00 €"},
+		{99999, "de_CH", "CHF 999.99"},
+		{0, "ru_RU", "0,00 ₽"},
+		{math.MinInt64, "de_DE", "-92.233.720.368.547.758,08 €"},
+		{math.MaxInt64, "en_GB", "£92,233,720,368,547,758.07"},
+	}
+	typ := mustType(t, CASHOID)
+	for _, tt := range tests {
+		datum := int64s(tt.cents)
+		v, _, err := typ.Decode(datum, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := formatCash(tt.cents, cLocale); v != want {
+			t.Errorf("%d: decoded %q, want the C-locale %q", tt.cents, v, want)
+		}
+		if got := LocaleDisplay(datum, 0, CASHOID, v, tt.locale); got != tt.want {
+			t.Errorf("%d in %s: got %q, want %q", tt.cents, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestNumericLocale(t *testing.T) {
+	tests := []struct {
+		v, locale, want string
+	}{
+		{"-1234567.89", "de_DE", "-1.234.567,89"},
+		{"1234567.89", "C", "1234567.89"},
+		{"1234", "fr_FR", "1 234"},
+		{"123", "en_US", "123"},
+		{"0.5", "de_CH", "0.5"},
+		{"NaN", "de_DE", "NaN"},
+		{"-Infinity", "ru_RU", "-Infinity"},
+	}
+	for _, tt := range tests {
+		if got := LocaleDisplay(nil, 0, NUMERICOID, tt.v, tt.locale); got != tt.want {
+			t.Errorf("%s in %s: got %q, want %q", tt.v, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestLookupLocale(t *testing.T) {
+	for name, want := range map[string]string{"de_DE": "de_DE", "de_DE.UTF-8": "de_DE", "POSIX": "POSIX"} {
+		if got, err := LookupLocale(name); got != want || err != nil {
+			t.Errorf("%s: got %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := LookupLocale("xx_XX"); err == nil {
+		t.Error("xx_XX: no error")
+	}
+}
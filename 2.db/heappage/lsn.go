@@ -0,0 +1,49 @@
+package heappage
+
+// Log sequence numbers (xlogdefs.h). An LSN is a 64-bit WAL position; on a
+// page it is stored as two uint32 halves (pd_lsn.xlogid, pd_lsn.xrecoff).
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const PG_LSNOID Oid = 3220
+
+func init() {
+	RegisterType(PG_LSNOID, TypeInfo{"pg_lsn", 8, 'd', fixedStringDecoder(8, decodePgLSN)})
+}
+
+// FormatLSN renders an LSN the way PostgreSQL and pg_waldump do: %X/%X.
+func FormatLSN(hi, lo uint32) string {
+	return fmt.Sprintf("%X/%X", hi, lo)
+}
+
+// ParseLSN parses an LSN in %X/%X form, e.g. "16/B374D848".
+func ParseLSN(s string) (uint64, error) {
+	hi, lo, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return 0, fmt.Errorf("bad LSN %q, want XXX/XXX", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad LSN %q: %w", s, err)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad LSN %q: %w", s, err)
+	}
+	return h<<32 | l, nil
+}
+
+// PageLSN returns the page LSN as a single 64-bit value.
+func (h *PageHeader) PageLSN() uint64 {
+	return uint64(h.XLogID)<<32 | uint64(h.XRecOff)
+}
+
+func decodePgLSN(buf []byte, off int) (string, int) {
+	v := binary.LittleEndian.Uint64(buf[off:])
+	return FormatLSN(uint32(v>>32), uint32(v)), off + 8
+}
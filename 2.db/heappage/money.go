@@ -0,0 +1,40 @@
+package heappage
+
+// money (utils/adt/cash.c): an int64 count of the currency's smallest unit,
+// align 'd'. cash_out takes the symbol, separators and number of fraction
+// digits from lc_monetary; the decoder renders the C locale, where cash_out
+// falls back to "$", "," and two digits, and -locale only changes the text
+// display (LocaleDisplay).
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+const CASHOID Oid = 790
+
+func init() {
+	RegisterType(CASHOID, TypeInfo{"money", 8, 'd', fixedStringDecoder(8, decodeCash)})
+}
+
+func decodeCash(buf []byte, off int) (string, int) {
+	return formatCash(int64(binary.LittleEndian.Uint64(buf[off:])), cLocale), off + 8
+}
+
+// formatCash renders v hundredths with loc's separators, e.g. -$1,234.56 or
+// -1.234,56 €.
+func formatCash(v int64, loc *NumberLocale) string {
+	u := uint64(v) // so that MinInt64 negates without overflow
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		u = -u
+	}
+	frac := strconv.FormatUint(u%100+100, 10)[1:]
+	group := loc.Group
+	if group == "" {
+		group = "," // cash_out's default when mon_thousands_sep is empty
+	}
+	num := groupDigits(strconv.FormatUint(u/100, 10), group) + loc.Decimal + frac
+	return sign + loc.CurrencyPrefix + num + loc.CurrencySuffix
+}
@@ -0,0 +1,71 @@
+package heappage
+
+// pg_node_tree (catalog/pg_type.dat): the nodeToString() serialization of a
+// parse tree, stored as plain text in a varlena, e.g. pg_attrdef.adbin or
+// pg_constraint.conbin:
+//
+//	{FUNCEXPR :funcid 480 :funcresulttype 23 :args ({CONST :consttype 20 ...})}
+//
+// -pretty-node-trees indents it in the spirit of pretty_format_node_dump:
+// every node and list opens a level, every node and :field starts a line.
+
+import (
+	"bytes"
+	"strings"
+)
+
+const PGNODETREEOID Oid = 194
+
+const nodeTreeIndent = 3
+
+func init() {
+	RegisterType(PGNODETREEOID, TypeInfo{"pg_node_tree", -1, 'i', varlenaDecoderWith(decodeNodeTree)})
+}
+
+// decodeNodeTree returns a node tree as stored, or indented with
+// opt.PrettyNodeTrees.
+func decodeNodeTree(payload []byte, opt *Options) (any, error) {
+	if opt.orDefault().PrettyNodeTrees {
+		return FormatNodeTree(string(payload)), nil
+	}
+	return opt.serverString(payload), nil
+}
+
+// FormatNodeTree indents a node tree dump. Backslash escapes inside tokens
+// (outToken writes "\{" for a literal brace) are copied through untouched.
+// Unbalanced input is formatted as far as it goes, never rejected.
+func FormatNodeTree(s string) string {
+	var out []byte
+	depth := 0
+	newline := func() {
+		out = bytes.TrimRight(out, " ")
+		out = append(out, '\n')
+		out = append(out, strings.Repeat(" ", depth*nodeTreeIndent)...)
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			out = append(out, c, s[i+1])
+			i++
+		case c == '{':
+			// a node inside a list goes on its own line, the first one too
+			if len(out) > 0 {
+				newline()
+			}
+			out = append(out, c)
+			depth++
+		case c == '(':
+			out = append(out, c)
+			depth++
+		case c == '}' || c == ')':
+			depth = max(depth-1, 0)
+			out = append(out, c)
+		case c == ' ' && i+1 < len(s) && s[i+1] == ':':
+			newline()
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
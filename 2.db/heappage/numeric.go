@@ -0,0 +1,132 @@
+package heappage
+
+// numeric (utils/adt/numeric.c). A varlena whose payload is base-10000
+// digits behind one of two headers:
+//
+//	short  uint16 header: 10 sign | 1 sign | 6 dscale | 1 weight sign | 6 weight
+//	long   uint16 sign_dscale (2 sign | 14 dscale), int16 weight
+//
+// followed by int16 digits[], most significant first; weight is the power of
+// 10000 of the first digit. The top two bits 11 mark NaN and +/-Infinity.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const NUMERICOID Oid = 1700
+
+const (
+	numericSignMask    = 0xC000
+	numericNeg         = 0x4000
+	numericShort       = 0x8000
+	numericSpecial     = 0xC000
+	numericNaN         = 0xC000
+	numericPInf        = 0xD000
+	numericNInf        = 0xF000
+	numericExtSignMask = 0xF000
+
+	numericShortSignMask   = 0x2000
+	numericShortDscaleMask = 0x1F80
+	numericShortDscaleShft = 7
+	numericShortWeightSign = 0x0040
+	numericShortWeightMask = 0x003F
+
+	numericDscaleMask = 0x3FFF
+
+	numericBase = 10000 // NBASE
+)
+
+func init() {
+	RegisterType(NUMERICOID, TypeInfo{"numeric", -1, 'i', varlenaDecoder(decodeNumericAny)})
+}
+
+func decodeNumericAny(payload []byte) (any, error) { return decodeNumeric(payload) }
+
+// decodeNumeric renders a numeric payload like numeric_out.
+func decodeNumeric(payload []byte) (string, error) {
+	if len(payload) < 2 {
+		return "", errors.New("numeric header truncated")
+	}
+	header := binary.LittleEndian.Uint16(payload)
+
+	var neg bool
+	var dscale, weight int
+	var digits []byte
+	switch header & numericSignMask {
+	case numericSpecial:
+		switch header & numericExtSignMask {
+		case numericNaN:
+			return "NaN", nil
+		case numericPInf:
+			return "Infinity", nil
+		case numericNInf:
+			return "-Infinity", nil
+		}
+		return "", fmt.Errorf("unknown special numeric 0x%04x", header)
+	case numericShort:
+		neg = header&numericShortSignMask != 0
+		dscale = int(header&numericShortDscaleMask) >> numericShortDscaleShft
+		weight = int(header & numericShortWeightMask)
+		if header&numericShortWeightSign != 0 {
+			weight |= ^numericShortWeightMask
+		}
+		digits = payload[2:]
+	default:
+		if len(payload) < 4 {
+			return "", errors.New("numeric header truncated")
+		}
+		neg = header&numericSignMask == numericNeg
+		dscale = int(header & numericDscaleMask)
+		weight = int(int16(binary.LittleEndian.Uint16(payload[2:])))
+		digits = payload[4:]
+	}
+	if len(digits)%2 != 0 {
+		return "", fmt.Errorf("numeric digits: odd length %d", len(digits))
+	}
+	ndigits := len(digits) / 2
+	for i := 0; i < ndigits; i++ {
+		if d := int16(binary.LittleEndian.Uint16(digits[2*i:])); d < 0 || d >= numericBase {
+			return "", fmt.Errorf("numeric digit %d is %d, outside 0..%d", i, d, numericBase-1)
+		}
+	}
+	// digit i has the value digit * 10000^(weight-i). Positions the
+	// stored digits do not cover are zeros: between the decimal point and
+	// the first digit when weight < -1 (0.00000001 is weight -2, digits
+	// [1]), after the last digit up to the units when weight is large
+	// (1e100 is weight 25, digits [1]), and after the last digit up to
+	// dscale.
+	digit := func(i int) int {
+		if i < 0 || i >= ndigits {
+			return 0
+		}
+		return int(int16(binary.LittleEndian.Uint16(digits[2*i:])))
+	}
+
+	var sb strings.Builder
+	if neg && ndigits > 0 { // make_result stores zero as positive; don't print -0
+		sb.WriteByte('-')
+	}
+	if weight < 0 {
+		sb.WriteByte('0')
+	} else {
+		fmt.Fprintf(&sb, "%d", digit(0))
+		for i := 1; i <= weight; i++ {
+			fmt.Fprintf(&sb, "%04d", digit(i))
+		}
+	}
+	if dscale > 0 {
+		// fractional position p (1-based, in base-10000 digits) is digit
+		// weight+p; numeric_out prints exactly dscale decimal digits, so
+		// the last base-10000 digit may be cut
+		var frac strings.Builder
+		for i := weight + 1; frac.Len() < dscale; i++ {
+			fmt.Fprintf(&frac, "%04d", digit(i))
+		}
+		sb.WriteByte('.')
+		sb.WriteString(frac.String()[:dscale])
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,74 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// numericPayload is a numeric varlena payload of 16-bit words: the header
+// (one word short, two long) and then the base-10000 digits.
+func numericPayload(words ...uint16) []byte {
+	var b []byte
+	for _, w := range words {
+		b = binary.LittleEndian.AppendUint16(b, w)
+	}
+	return b
+}
+
+func TestDecodeNumeric(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"zero", numericPayload(0x8000), "0"},
+		{"zero, dscale 2", numericPayload(0x8100), "0.00"},
+		{"123.45", numericPayload(0x8100, 123, 4500), "123.45"},
+		{"dscale cuts the last digit", numericPayload(0x8080|1, 1234, 5678, 9000), "12345678.9"},
+		{"dscale past the digits", numericPayload(0x8180, 2), "2.000"},
+		{"negative fraction", numericPayload(0xa0ff, 5000), "-0.5"},
+		// weight 25 in the short header: 25 groups of 0000 after the 1
+		{"1e100", numericPayload(0x8019, 1), "1" + strings.Repeat("0", 100)},
+		{"weight -2", numericPayload(0x847e, 1), "0.00000001"},
+		{"digits either side", numericPayload(0x8200|1, 1, 0, 1), "10000.0001"},
+		// beyond the short header's 6-bit weight and dscale
+		{"1e300, long header", numericPayload(0x0000, 75, 1), "1" + strings.Repeat("0", 300)},
+		{"1e-400, long header", numericPayload(400, 0xff9c, 1), "0." + strings.Repeat("0", 399) + "1"},
+		{"negative, long header", numericPayload(0x4000|2, 0, 7, 100), "-7.01"},
+		{"NaN", numericPayload(0xc000), "NaN"},
+		{"Infinity", numericPayload(0xd000), "Infinity"},
+		{"-Infinity", numericPayload(0xf000), "-Infinity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeNumeric(tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeNumericErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", nil},
+		{"long header truncated", numericPayload(0x0000)},
+		{"odd digit bytes", append(numericPayload(0x8000, 1), 0)},
+		{"digit over 9999", numericPayload(0x8000, 10000)},
+		{"unknown special", numericPayload(0xe000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodeNumeric(tt.payload); err == nil {
+				t.Errorf("no error, got %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package heappage
+
+// Optional oid -> name resolution for columns that reference catalog
+// objects (reg* types). Names come from a user-supplied map file with lines
+//
+//	<catalog> <oid> <name>
+//
+// e.g. "pg_class 16384 public.users". Blank lines and # comments are ignored.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var oidNames = map[string]map[Oid]string{}
+
+// RegisterOidName records the name of an object in a catalog.
+func RegisterOidName(catalog string, oid Oid, name string) {
+	m := oidNames[catalog]
+	if m == nil {
+		m = map[Oid]string{}
+		oidNames[catalog] = m
+	}
+	m[oid] = name
+}
+
+// LookupOidName returns the registered name of an object, if any.
+func LookupOidName(catalog string, oid Oid) (string, bool) {
+	name, ok := oidNames[catalog][oid]
+	return name, ok
+}
+
+// LoadOidNames reads a catalog map file into the registry.
+func LoadOidNames(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 3)
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: want \"catalog oid name\"", path, line)
+		}
+		oid, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s:%d: bad oid %q", path, line, fields[1])
+		}
+		RegisterOidName(fields[0], Oid(oid), strings.TrimSpace(fields[2]))
+	}
+	return sc.Err()
+}
+
+// oidRefDecoder decodes a 4-byte oid that references an object in catalog,
+// rendering its name when known. InvalidOid prints as "-" like regclassout.
+func oidRefDecoder(catalog string) TypeDecoder {
+	return func(buf []byte, off int, _ *Options) (any, int, error) {
+		b, err := fixedSlice(buf, off, 4)
+		if err != nil {
+			return nil, off, err
+		}
+		oid := Oid(binary.LittleEndian.Uint32(b))
+		if oid == 0 {
+			return "-", off + 4, nil
+		}
+		if name, ok := LookupOidName(catalog, oid); ok {
+			return name, off + 4, nil
+		}
+		return fmt.Sprintf("%d (unresolved %s oid)", oid, catalog), off + 4, nil
+	}
+}
+
+// reg* types: oid -> (type name, referenced catalog)
+var regTypes = map[Oid][2]string{
+	24:   {"regproc", "pg_proc"},
+	2202: {"regprocedure", "pg_proc"},
+	2203: {"regoper", "pg_operator"},
+	2204: {"regoperator", "pg_operator"},
+	2205: {"regclass", "pg_class"},
+	2206: {"regtype", "pg_type"},
+	3734: {"regconfig", "pg_ts_config"},
+	3769: {"regdictionary", "pg_ts_dict"},
+	4089: {"regnamespace", "pg_namespace"},
+	4096: {"regrole", "pg_authid"},
+	4191: {"regcollation", "pg_collation"},
+}
+
+func init() {
+	for oid, rt := range regTypes {
+		RegisterType(oid, TypeInfo{rt[0], 4, 'i', oidRefDecoder(rt[1])})
+	}
+}
@@ -0,0 +1,100 @@
+package heappage
+
+// Decode options: the settings that change how a stored value is rendered,
+// the counterparts of server settings such as TimeZone, bytea_output and
+// server_encoding. They travel with each decode (DecodeRow, DecodeAttrAt,
+// TypeDecoder) instead of living in package variables, so decodes with
+// different settings can run side by side.
+
+import (
+	"fmt"
+	"time"
+)
+
+// Options are the decode settings. A nil *Options means DefaultOptions.
+type Options struct {
+	// TimeZone is the zone timestamptz is shown in; nil is UTC. The stored
+	// value is always UTC and the offset is printed, so the instant stays
+	// unambiguous.
+	TimeZone *time.Location
+	// TimePrecision is the number of fractional second digits time,
+	// timetz, timestamp[tz] and interval are shown with, truncated rather
+	// than rounded so a value never moves to the next second; -1 shows as
+	// many as needed and none for whole seconds, like PostgreSQL.
+	TimePrecision int
+	// FloatDatetimes reads the time parts of datetimes as float8 seconds,
+	// for clusters built with --disable-integer-datetimes.
+	FloatDatetimes bool
+	// LegacyAclItem reads aclitem in the pre-16 layout with a 32-bit
+	// AclMode (12 bytes, align 'i').
+	LegacyAclItem bool
+	// PrettyJSON indents json and jsonb values.
+	PrettyJSON bool
+	// PrettyNodeTrees indents pg_node_tree values (FormatNodeTree).
+	PrettyNodeTrees bool
+	// Encoding is the server encoding text is converted from; the zero
+	// ServerEncoding passes bytes through, as UTF8 and SQL_ASCII do.
+	Encoding ServerEncoding
+	// BinaryEncoding is how FormatValue renders bytea: "hex" like
+	// bytea_output = hex, "escape" like bytea_output = escape, or "base64"
+	// like encode(x, 'base64'). Empty is hex.
+	BinaryEncoding string
+}
+
+// DefaultOptions returns PostgreSQL's defaults. Options built from scratch
+// should start from it, since the zero TimePrecision means no fractional
+// digits at all.
+func DefaultOptions() *Options { return &Options{TimePrecision: -1} }
+
+var defaultOptions = DefaultOptions()
+
+// orDefault lets the accessors below treat a nil *Options as the defaults.
+func (o *Options) orDefault() *Options {
+	if o == nil {
+		return defaultOptions
+	}
+	return o
+}
+
+// CheckTimePrecision validates a TimePrecision other than -1.
+func CheckTimePrecision(n int) error {
+	if n < 0 || n > 6 {
+		return fmt.Errorf("precision %d out of range 0..6", n)
+	}
+	return nil
+}
+
+// CheckBinaryEncoding validates a BinaryEncoding.
+func CheckBinaryEncoding(name string) error {
+	switch name {
+	case "hex", "escape", "base64":
+		return nil
+	}
+	return fmt.Errorf("unknown binary encoding %q (want hex, escape or base64)", name)
+}
+
+// LoadTimeZone loads the named IANA zone for TimeZone, e.g.
+// America/New_York.
+func LoadTimeZone(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w (want an IANA zone name such as Europe/Berlin or UTC)", err)
+	}
+	return loc, nil
+}
+
+// LookupType is the package LookupType with the layouts these options
+// select: with LegacyAclItem, aclitem is the 12-byte pre-16 type and
+// aclitem[] aligned to match.
+func (o *Options) LookupType(oid Oid) (TypeInfo, bool) {
+	t, ok := LookupType(oid)
+	if ok && o.orDefault().LegacyAclItem {
+		switch {
+		case oid == ACLITEMOID:
+			t = aclItem12
+		case arrayTypes[oid] == ACLITEMOID:
+			t.Align = containerAlign(aclItem12.Align)
+		}
+	}
+	return t, ok
+}
@@ -0,0 +1,91 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Each decode renders with its own Options: decodes with different settings
+// running side by side don't see each other's.
+func TestOptionsPerDecode(t *testing.T) {
+	cols := []ColumnDef{Column("ts", TIMESTAMPTZOID), Column("b", BYTEAOID), Column("a", 1034)}
+	acl := make([]byte, 16)
+	binary.LittleEndian.PutUint32(acl[4:], 10)
+	binary.LittleEndian.PutUint64(acl[8:], 0x3)
+	tup := heapTuple(t, cols, []any{
+		int64(86400e6 + 1500),
+		varlena4([]byte{'a', 0}),
+		varlena4(append(arrayHeader(1033, 1), acl...)),
+	})
+
+	berlin, err := LoadTimeZone("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		opt  *Options
+		want []any
+	}{
+		{nil, []any{"2000-01-02 00:00:00.0015+00", []byte("a\x00"), "{=ar/10}"}},
+		{DefaultOptions(), []any{"2000-01-02 00:00:00.0015+00", []byte("a\x00"), "{=ar/10}"}},
+		{&Options{TimeZone: berlin, TimePrecision: 3, BinaryEncoding: "escape"},
+			[]any{"2000-01-02 01:00:00.001+01", []byte("a\x00"), "{=ar/10}"}},
+		{&Options{TimeZone: time.UTC, TimePrecision: 0}, []any{"2000-01-02 00:00:00+00", []byte("a\x00"), "{=ar/10}"}},
+	}
+	var wg sync.WaitGroup
+	for range 8 {
+		for _, tt := range tests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := DecodeRow(tup, mustRowHeader(t, tup), cols, tt.opt)
+				if err != nil || !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%+v: got %q, %v; want %q", tt.opt, got, err, tt.want)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if got := FormatValue([]byte("a\x00"), tests[2].opt); got != `a\000` {
+		t.Errorf("escape: got %q", got)
+	}
+	if got := FormatValue([]byte("a\x00"), nil); got != `\x6100` {
+		t.Errorf("default: got %q", got)
+	}
+}
+
+// LegacyAclItem changes aclitem's layout, and aclitem[]'s alignment with
+// it, only for the decodes that ask for it.
+func TestOptionsLegacyAclItem(t *testing.T) {
+	legacy := &Options{TimePrecision: -1, LegacyAclItem: true}
+	for _, tt := range []struct {
+		opt        *Options
+		len        int
+		elem, arrs byte
+	}{{nil, 16, 'd', 'd'}, {legacy, 12, 'i', 'i'}} {
+		elem, _ := tt.opt.LookupType(ACLITEMOID)
+		arr, _ := tt.opt.LookupType(1034)
+		if elem.Len != tt.len || elem.Align != tt.elem || arr.Align != tt.arrs {
+			t.Errorf("%+v: aclitem %d/%c, aclitem[] %c", tt.opt, elem.Len, elem.Align, arr.Align)
+		}
+	}
+	if typ := mustType(t, ACLITEMOID); typ.Len != 16 {
+		t.Errorf("registry aclitem is %d bytes after a legacy lookup", typ.Len)
+	}
+}
+
+// arrayHeader is the one-dimensional array header of n elements of elem
+// without a NULL bitmap and with lower bound 1, after the varlena header.
+// The data follows it directly: the header ends 8-aligned.
+func arrayHeader(elem Oid, n int) []byte {
+	h := make([]byte, 20)
+	binary.LittleEndian.PutUint32(h[0:], 1)
+	binary.LittleEndian.PutUint32(h[8:], uint32(elem))
+	binary.LittleEndian.PutUint32(h[12:], uint32(n))
+	binary.LittleEndian.PutUint32(h[16:], 1)
+	return h
+}
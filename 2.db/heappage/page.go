@@ -0,0 +1,476 @@
+// Package heappage reads PostgreSQL heap pages: the page header, line
+// pointers and tuple headers, and the attributes of a tuple decoded by a
+// column schema through a registry of type decoders that RegisterType
+// extends. The pgheapdump command is built on it.
+package heappage
+
+// Heap page layout: the page header and line pointers (bufpage.h,
+// itemid.h), the tuple header (htup_details.h) and loading a page from a
+// relation file.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	PageSize          = 8192
+	PageHeaderByteLen = 24
+	ItemIDByteLen     = 4
+	PageLayoutVersion = 4 // PG_PAGE_LAYOUT_VERSION
+)
+
+// -------- Page header (bufpage.h) --------
+
+type PageHeader struct {
+	XLogID            uint32 // pd_lsn.xlogid
+	XRecOff           uint32 // pd_lsn.xrecoff
+	PdChecksum        uint16
+	PdFlags           uint16
+	PdLower           uint16 // start of line pointers area end
+	PdUpper           uint16 // start of tuples (from the end)
+	PdSpecial         uint16 // start of special space (heap: == BLCKSZ)
+	PdPagesizeVersion uint16
+	PdPruneXID        uint32
+}
+
+// pd_flags bits
+const (
+	PD_HAS_FREE_LINES = 0x0001 // are there any unused line pointers?
+	PD_PAGE_FULL      = 0x0002 // not enough free space for new tuple?
+	PD_ALL_VISIBLE    = 0x0004 // all tuples on page are visible to everyone
+)
+
+// ReadPageHeader reads the 24-byte page header from r without validating it.
+func ReadPageHeader(r io.Reader) (*PageHeader, error) {
+	h := &PageHeader{}
+	if err := binary.Read(r, binary.LittleEndian, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// -------- ItemIdData (itemid.h) --------
+//
+// On-disk: two uint16. 2 flag bits are split across them:
+//  - high bit of lp_off (bit15) is low flag bit
+//  - low bit of lp_len (bit0) is high flag bit
+//
+// Decoding to fields:
+//  off15  = lp_off & 0x7FFF
+//  len15  = lp_len >> 1
+//  flags2 = ((lp_off>>15)&0x01) | ((lp_len<<1)&0x02)
+
+type rawItemID struct {
+	LpOff uint16
+	LpLen uint16
+}
+
+type ItemID struct {
+	LpOff uint16       // 15-bit offset from page start
+	LpLen uint16       // 15-bit length
+	Flags byte         // 2-bit flags
+	Index OffsetNumber // position within the line pointer array, 1-based
+}
+
+const (
+	LP_UNUSED   = 0
+	LP_NORMAL   = 1
+	LP_REDIRECT = 2
+	LP_DEAD     = 3
+)
+
+// ReadItemIDs reads the line pointer array that follows the page header in
+// r, as many entries as pd_lower allows.
+func ReadItemIDs(r io.Reader, header *PageHeader) ([]ItemID, error) {
+	// Signed arithmetic: pd_lower < 24 must not wrap around as uint16.
+	span := int(header.PdLower) - PageHeaderByteLen
+	if span < 0 {
+		return nil, fmt.Errorf("bad PdLower=%d; below the %d-byte page header", header.PdLower, PageHeaderByteLen)
+	}
+	n := span / ItemIDByteLen
+	if n > (PageSize-PageHeaderByteLen)/ItemIDByteLen {
+		return nil, fmt.Errorf("bad PdLower=%d; computed itemId count=%d", header.PdLower, n)
+	}
+	out := make([]ItemID, 0, n)
+	for i := 0; i < n; i++ {
+		var raw rawItemID
+		if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+			return nil, fmt.Errorf("read ItemIdData[%d]: %w", i, err)
+		}
+		flags := byte(((raw.LpOff >> 15) & 0x01) | ((raw.LpLen << 1) & 0x02))
+		item := ItemID{
+			LpOff: raw.LpOff & 0x7FFF,
+			LpLen: raw.LpLen >> 1,
+			Flags: flags,
+			Index: FirstOffsetNumber + OffsetNumber(i),
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// -------- Heap tuple header (htup_details.h) --------
+//
+// Minimal subset; sizes match common PG builds (little-endian).
+// This maps to: t_xmin,t_xmax,t_cid/t_xvac, t_ctid(blockhi,blocklo,offset),
+// t_infomask2, t_infomask, t_hoff.
+
+type RowHeader struct {
+	Xmin uint32
+	Xmax uint32
+	CId  uint32
+	// ItemPointerData (ctid)
+	CTIDBlockHi uint16
+	CTIDBlockLo uint16
+	CTIDOffset  OffsetNumber
+	InfoMask2   uint16 // low 11 bits = natts
+	InfoMask    uint16
+	Hoff        byte
+}
+
+func (rh *RowHeader) Natts() int { return int(rh.InfoMask2 & 0x07FF) }
+
+// CTID is t_ctid: this version itself, or the newer version it was updated
+// to.
+func (rh *RowHeader) CTID() ItemPointer {
+	return MakeItemPointer(rh.CTIDBlockHi, rh.CTIDBlockLo, rh.CTIDOffset)
+}
+
+// IsSpeculative reports a tuple inserted by INSERT ... ON CONFLICT that is
+// not yet confirmed: t_ctid holds the speculative insertion token, not a tid
+// (HeapTupleHeaderIsSpeculative).
+func (rh *RowHeader) IsSpeculative() bool { return rh.CTIDOffset == SpecTokenOffsetNumber }
+
+// SpeculativeToken is the token of a speculative tuple, kept in the block
+// number of t_ctid.
+func (rh *RowHeader) SpeculativeToken() uint32 { return uint32(rh.CTID().Block) }
+
+// CTIDLabel is t_ctid as dumps show it: the tid, or a label when it holds a
+// speculative insertion token or the moved-partitions marker.
+func (rh *RowHeader) CTIDLabel() string {
+	switch ctid := rh.CTID(); {
+	case rh.IsSpeculative():
+		return "(speculative)"
+	case ctid.IndicatesMovedPartitions():
+		return "(moved to another partition)"
+	default:
+		return ctid.String()
+	}
+}
+
+// DataRange returns the bounds of the attribute data within a tuple of
+// lpLen bytes (ItemIdData.lp_len): it starts at t_hoff and ends with the
+// tuple. A t_hoff inside the fixed header or past lp_len is an error, so
+// decoders never have to trust either value on its own.
+func (rh *RowHeader) DataRange(lpLen int) (start, end int, err error) {
+	start, end = int(rh.Hoff), lpLen
+	if start < RowHeaderByteLen || start > end {
+		return 0, 0, fmt.Errorf("hoff=%d outside tuple of %d bytes", rh.Hoff, lpLen)
+	}
+	return start, end, nil
+}
+
+// TupleDataLength is the number of bytes of attribute data in a tuple of
+// lpLen bytes, or 0 if the header is inconsistent with lpLen.
+func (rh *RowHeader) TupleDataLength(lpLen int) int {
+	start, end, err := rh.DataRange(lpLen)
+	if err != nil {
+		return 0
+	}
+	return end - start
+}
+
+// OldOid returns the object id of a pre-PG12 WITH OIDS tuple. The oid is the
+// last 4 bytes before t_hoff (HeapTupleHeaderGetOid), so t_hoff already
+// points past it. Since PG12 the 0x0008 bit is never set, but callers should
+// only trust it for dumps of older clusters.
+func (rh *RowHeader) OldOid(tuple []byte) (uint32, bool) {
+	if rh.InfoMask&HEAP_HASOID_OLD == 0 {
+		return 0, false
+	}
+	h := int(rh.Hoff)
+	if h < RowHeaderByteLen+4 || h > len(tuple) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(tuple[h-4 : h]), true
+}
+
+// t_infomask flags we care about (subset)
+const (
+	HEAP_HASNULL          = 0x0001
+	HEAP_HASVARWIDTH      = 0x0002
+	HEAP_HASEXTERNAL      = 0x0004 // TOAST pointer
+	HEAP_HASOID_OLD       = 0x0008 // pre-PG12 WITH OIDS; unused since PG12
+	HEAP_XMAX_KEYSHR_LOCK = 0x0010
+	HEAP_COMBOCID         = 0x0020 // t_cid is a combo cid
+	HEAP_XMAX_EXCL_LOCK   = 0x0040
+	HEAP_XMAX_LOCK_ONLY   = 0x0080 // xmax is only a locker
+	HEAP_XMIN_COMMITTED   = 0x0100
+	HEAP_XMIN_INVALID     = 0x0200
+	HEAP_XMIN_FROZEN      = HEAP_XMIN_COMMITTED | HEAP_XMIN_INVALID
+	HEAP_XMAX_COMMITTED   = 0x0400
+	HEAP_XMAX_INVALID     = 0x0800
+	HEAP_XMAX_IS_MULTI    = 0x1000
+	HEAP_UPDATED          = 0x2000
+	HEAP_MOVED_OFF        = 0x4000 // pre-9.0 VACUUM FULL
+	HEAP_MOVED_IN         = 0x8000
+
+	HEAP_XMAX_SHR_LOCK = HEAP_XMAX_EXCL_LOCK | HEAP_XMAX_KEYSHR_LOCK
+	HEAP_LOCK_MASK     = HEAP_XMAX_SHR_LOCK | HEAP_XMAX_EXCL_LOCK | HEAP_XMAX_KEYSHR_LOCK
+	HEAP_MOVED         = HEAP_MOVED_OFF | HEAP_MOVED_IN
+)
+
+// t_infomask2 flags (the low 11 bits are natts)
+const (
+	HEAP_KEYS_UPDATED = 0x2000 // tuple was updated and key cols modified, or deleted
+	HEAP_HOT_UPDATED  = 0x4000 // tuple was HOT-updated
+	HEAP_ONLY_TUPLE   = 0x8000 // this is a heap-only tuple
+)
+
+// Accessors for t_infomask, after the htup_details.h macros. The xmin
+// hint bits overlap: both set means frozen, not committed and aborted.
+
+func (rh *RowHeader) HasNull() bool     { return rh.InfoMask&HEAP_HASNULL != 0 }
+func (rh *RowHeader) HasVarWidth() bool { return rh.InfoMask&HEAP_HASVARWIDTH != 0 }
+func (rh *RowHeader) HasExternal() bool { return rh.InfoMask&HEAP_HASEXTERNAL != 0 }
+
+// XminCommitted is also true for a frozen tuple (HeapTupleHeaderXminCommitted).
+func (rh *RowHeader) XminCommitted() bool { return rh.InfoMask&HEAP_XMIN_COMMITTED != 0 }
+
+// XminInvalid means the inserter aborted; false when frozen.
+func (rh *RowHeader) XminInvalid() bool {
+	return rh.InfoMask&HEAP_XMIN_FROZEN == HEAP_XMIN_INVALID
+}
+
+func (rh *RowHeader) XminFrozen() bool {
+	return rh.InfoMask&HEAP_XMIN_FROZEN == HEAP_XMIN_FROZEN
+}
+
+func (rh *RowHeader) XmaxCommitted() bool { return rh.InfoMask&HEAP_XMAX_COMMITTED != 0 }
+func (rh *RowHeader) XmaxInvalid() bool   { return rh.InfoMask&HEAP_XMAX_INVALID != 0 }
+func (rh *RowHeader) XmaxIsMulti() bool   { return rh.InfoMask&HEAP_XMAX_IS_MULTI != 0 }
+
+// XmaxIsLockedOnly reports an xmax that only locked the row
+// (HEAP_XMAX_IS_LOCKED_ONLY): LOCK_ONLY set, or, as pg_upgraded pre-9.3
+// tuples have it, a plain non-multi xmax with just the exclusive lock bit.
+func (rh *RowHeader) XmaxIsLockedOnly() bool {
+	return rh.InfoMask&HEAP_XMAX_LOCK_ONLY != 0 ||
+		rh.InfoMask&(HEAP_XMAX_IS_MULTI|HEAP_LOCK_MASK) == HEAP_XMAX_EXCL_LOCK
+}
+
+// LockMode names the row lock xmax holds, as the SELECT clause that takes
+// it, or "none" when xmax is not a live locker: absent, hinted aborted, or
+// a deleter or updater. A multixact's member modes are in pg_multixact, not
+// on the page, so it is only reported as "multixact".
+func LockMode(rh *RowHeader) string {
+	switch {
+	case rh.Xmax == 0 || rh.XmaxInvalid():
+		return "none"
+	case rh.XmaxIsMulti():
+		return "multixact"
+	case !rh.XmaxIsLockedOnly():
+		return "none"
+	}
+	switch rh.InfoMask & HEAP_LOCK_MASK {
+	case HEAP_XMAX_KEYSHR_LOCK:
+		return "FOR KEY SHARE"
+	case HEAP_XMAX_SHR_LOCK:
+		return "FOR SHARE"
+	case HEAP_XMAX_EXCL_LOCK:
+		// pre-9.3 tuples have no LOCK_ONLY bit and only knew FOR UPDATE
+		if rh.InfoMask2&HEAP_KEYS_UPDATED != 0 || rh.InfoMask&HEAP_XMAX_LOCK_ONLY == 0 {
+			return "FOR UPDATE"
+		}
+		return "FOR NO KEY UPDATE"
+	default:
+		// LOCK_ONLY alone was HEAP_XMAX_SHARED_LOCK before 9.3
+		return "FOR SHARE"
+	}
+}
+
+// IsMoved reports a tuple moved by pre-9.0 VACUUM FULL, whose t_cid field
+// holds the xvac xid instead.
+func (rh *RowHeader) IsMoved() bool { return rh.InfoMask&HEAP_MOVED != 0 }
+
+// LooksLive approximates visibility from hint bits alone, without pg_xact:
+// the inserter is not known to have aborted, and xmax is absent, aborted or
+// only a row lock. A deleter whose commit was never hinted counts as deleted.
+func (rh *RowHeader) LooksLive() bool {
+	if rh.XminInvalid() {
+		return false // inserting transaction aborted
+	}
+	if rh.Xmax == 0 || rh.XmaxInvalid() {
+		return true
+	}
+	return rh.XmaxIsLockedOnly()
+}
+
+// Align rounds off up to the boundary of attalign align: 'c'=1, 's'=2,
+// 'i'=4, 'd'=8.
+func Align(off int, align byte) int {
+	var a int
+	switch align {
+	case 'c':
+		a = 1
+	case 's':
+		a = 2
+	case 'i':
+		a = 4
+	case 'd':
+		a = 8
+	default:
+		a = 1
+	}
+	m := (off + (a - 1)) & ^(a - 1)
+	return m
+}
+
+// Varlenas (postgres.h): detect 1-byte vs 4-byte header on little-endian.
+// Returns payload slice and new offset.
+// This simplified reader supports:
+// - 1-byte short varlena (xxxxxxx1) up to 126 bytes
+// - 4-byte uncompressed (.... ..00) (length includes the 4 bytes)
+// Does NOT support compressed or TOAST pointer (you'll get an error).
+//
+// buf must end where the tuple ends (LpOff+LpLen), not at the end of the
+// page: a length word claiming more bytes than the tuple has left is a
+// corrupted datum and is reported as ErrVarlenaOverrun, rather than silently
+// reading into the neighbouring tuple.
+func ReadVarlenaLE(buf []byte, off int) (payload []byte, next int, err error) {
+	if off < 0 || off >= len(buf) {
+		return nil, off, io.ErrUnexpectedEOF
+	}
+	first := buf[off]
+	if first == 0x01 {
+		// 1-byte header 00000001 is VARATT_IS_1B_E: a TOAST pointer, not a
+		// short varlena of length 0
+		return nil, off, errors.New("TOAST pointer varlena not supported")
+	}
+	if first&0x01 == 1 {
+		// short varlena: length in upper 7 bits + includes itself. l == 1
+		// (0x03) is a present but empty value, e.g. '' in a text column,
+		// and yields an empty, non-nil payload.
+		total := int(first >> 1)
+		if off+total > len(buf) {
+			return nil, off, varlenaOverrun(buf, off, total)
+		}
+		return buf[off+1 : off+total], off + total, nil
+	}
+	// Check 4-byte header (xxxxxx00 or xxxxxx10)
+	if off+4 > len(buf) {
+		return nil, off, io.ErrUnexpectedEOF
+	}
+	h := binary.LittleEndian.Uint32(buf[off : off+4])
+	// lowest two bits are flags; if ==00 -> uncompressed aligned
+	switch h & 0x03 {
+	case 0x00: // uncompressed 4-byte len
+		length := int(h >> 2) // length including the 4 bytes
+		if length < 4 {
+			return nil, off, errors.New("invalid long varlena length")
+		}
+		total := length
+		if off+total > len(buf) {
+			return nil, off, varlenaOverrun(buf, off, total)
+		}
+		return buf[off+4 : off+total], off + total, nil
+	default: // compressed (xxxxxx10) -> not handled here
+		return nil, off, errors.New("compressed varlena not supported")
+	}
+}
+
+// ErrVarlenaOverrun means a varlena length word points past the end of its
+// tuple.
+var ErrVarlenaOverrun = errors.New("varlena crosses tuple end")
+
+func varlenaOverrun(buf []byte, off, total int) error {
+	return fmt.Errorf("%w: %d-byte datum at off=%d, tuple ends at %d", ErrVarlenaOverrun, total, off, len(buf))
+}
+
+// ReadPageAt reads one page (8KiB) at the given page index.
+func ReadPageAt(r io.ReaderAt, pageNo int) ([]byte, error) {
+	page := make([]byte, PageSize)
+	n, err := r.ReadAt(page, int64(pageNo)*PageSize)
+	if n == PageSize {
+		return page, nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read page: %w", err)
+	}
+	return nil, fmt.Errorf("short read: got %d: %w", n, io.ErrUnexpectedEOF)
+}
+
+// PageIsNew reports an all-zero page (extended but never initialized), which
+// PostgreSQL accepts as valid.
+func PageIsNew(hdr *PageHeader) bool { return hdr.PdUpper == 0 }
+
+// ValidatePageHeader checks the basic invariants (PageHeaderIsValid):
+// 24 <= pd_lower <= pd_upper <= pd_special <= BLCKSZ, plus size/version.
+func ValidatePageHeader(hdr *PageHeader) error {
+	if size := int(hdr.PdPagesizeVersion & 0xFF00); size != PageSize {
+		return fmt.Errorf("page size %d != %d", size, PageSize)
+	}
+	if ver := hdr.PdPagesizeVersion & 0x00FF; ver != PageLayoutVersion {
+		return fmt.Errorf("page layout version %d != %d", ver, PageLayoutVersion)
+	}
+	if hdr.PdLower < PageHeaderByteLen || hdr.PdLower > hdr.PdUpper ||
+		hdr.PdUpper > hdr.PdSpecial || int(hdr.PdSpecial) > PageSize {
+		return fmt.Errorf("pd_lower=%d pd_upper=%d pd_special=%d violate 24 <= lower <= upper <= special <= %d",
+			hdr.PdLower, hdr.PdUpper, hdr.PdSpecial, PageSize)
+	}
+	return nil
+}
+
+// PageError says at which stage a page could not be loaded.
+type PageError struct {
+	PageNo int
+	Stage  string // "read", "header", "itemids", "decode"
+	Err    error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("page %d: %s: %v", e.PageNo, e.Stage, e.Err)
+}
+
+func (e *PageError) Unwrap() error { return e.Err }
+
+// ParsePage decodes and validates the page header and the line pointer array.
+// A new (all-zero) page has no line pointers.
+func ParsePage(page []byte) (*PageHeader, []ItemID, error) {
+	r := bytes.NewReader(page)
+	hdr, err := ReadPageHeader(r)
+	if err != nil {
+		return nil, nil, &PageError{Stage: "header", Err: err}
+	}
+	if PageIsNew(hdr) {
+		return hdr, nil, nil
+	}
+	if err := ValidatePageHeader(hdr); err != nil {
+		return hdr, nil, &PageError{Stage: "header", Err: err}
+	}
+	itemIDs, err := ReadItemIDs(r, hdr)
+	if err != nil {
+		return hdr, nil, &PageError{Stage: "itemids", Err: err}
+	}
+	return hdr, itemIDs, nil
+}
+
+// LoadPage reads and parses one page; failures are returned as *PageError.
+func LoadPage(r io.ReaderAt, pageNo int) ([]byte, *PageHeader, []ItemID, error) {
+	page, err := ReadPageAt(r, pageNo)
+	if err != nil {
+		return nil, nil, nil, &PageError{PageNo: pageNo, Stage: "read", Err: err}
+	}
+	hdr, itemIDs, err := ParsePage(page)
+	if err != nil {
+		var pe *PageError
+		if errors.As(err, &pe) {
+			pe.PageNo = pageNo
+		}
+		return page, hdr, nil, err
+	}
+	return page, hdr, itemIDs, nil
+}
@@ -0,0 +1,156 @@
+package heappage
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadItemIDs(t *testing.T) {
+	// lp_off 8048, lp_len 40, NORMAL; lp_off 5 (the redirect target),
+	// REDIRECT; lp_len 0, DEAD
+	lps := []byte{0x70, 0x9f, 0x50, 0x00, 0x05, 0x00, 0x01, 0x00, 0x00, 0x80, 0x01, 0x00}
+	tests := []struct {
+		name    string
+		lower   uint16
+		want    []ItemID
+		wantErr string
+	}{
+		{"no line pointers", 24, []ItemID{}, ""},
+		{"three", 36, []ItemID{
+			{LpOff: 8048, LpLen: 40, Flags: LP_NORMAL, Index: 1},
+			{LpOff: 5, LpLen: 0, Flags: LP_REDIRECT, Index: 2},
+			{LpOff: 0, LpLen: 0, Flags: LP_DEAD, Index: 3},
+		}, ""},
+		{"partial line pointer ignored", 26, []ItemID{}, ""},
+		{"pd_lower 0", 0, nil, "below the 24-byte page header"},
+		{"pd_lower 23", 23, nil, "below the 24-byte page header"},
+		{"more than a page holds", PageSize + 4, nil, "itemId count=2043"},
+		{"past the data", 40, nil, "ItemIdData[3]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadItemIDs(bytes.NewReader(lps), &PageHeader{PdLower: tt.lower})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowHeaderAccessors(t *testing.T) {
+	accessors := []struct {
+		name string
+		fn   func(*RowHeader) bool
+	}{
+		{"HasNull", (*RowHeader).HasNull},
+		{"HasVarWidth", (*RowHeader).HasVarWidth},
+		{"HasExternal", (*RowHeader).HasExternal},
+		{"XminCommitted", (*RowHeader).XminCommitted},
+		{"XminInvalid", (*RowHeader).XminInvalid},
+		{"XminFrozen", (*RowHeader).XminFrozen},
+		{"XmaxCommitted", (*RowHeader).XmaxCommitted},
+		{"XmaxInvalid", (*RowHeader).XmaxInvalid},
+		{"XmaxIsMulti", (*RowHeader).XmaxIsMulti},
+		{"XmaxIsLockedOnly", (*RowHeader).XmaxIsLockedOnly},
+		{"IsMoved", (*RowHeader).IsMoved},
+		{"LooksLive", (*RowHeader).LooksLive},
+	}
+	tests := []struct {
+		name     string
+		xmax     uint32
+		infomask uint16
+		want     string // the accessors that are true
+	}{
+		{"inserted, hinted", 0, 0x0902, "HasVarWidth XminCommitted XmaxInvalid LooksLive"},
+		{"frozen", 0, 0x0b03, "HasNull HasVarWidth XminCommitted XminFrozen XmaxInvalid LooksLive"},
+		{"inserter aborted", 0, 0x0a00, "XminInvalid XmaxInvalid"},
+		{"deleted, hinted", 742, 0x0506, "HasVarWidth HasExternal XminCommitted XmaxCommitted"},
+		{"deleted, not hinted", 742, 0x0100, "XminCommitted"},
+		{"deleter aborted", 742, 0x0900, "XminCommitted XmaxInvalid LooksLive"},
+		{"FOR SHARE", 742, 0x01d0, "XminCommitted XmaxIsLockedOnly LooksLive"},
+		{"pre-9.3 FOR UPDATE", 742, 0x0140, "XminCommitted XmaxIsLockedOnly LooksLive"},
+		{"updated by a multixact", 9, 0x1100, "XminCommitted XmaxIsMulti"},
+		{"locked by a multixact", 9, 0x1190, "XminCommitted XmaxIsMulti XmaxIsLockedOnly LooksLive"},
+		{"moved by old VACUUM FULL", 0, 0x8900, "XminCommitted XmaxInvalid IsMoved LooksLive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := &RowHeader{Xmin: 741, Xmax: tt.xmax, InfoMask: tt.infomask}
+			var got []string
+			for _, a := range accessors {
+				if a.fn(rh) {
+					got = append(got, a.name)
+				}
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("infomask %#04x: %s, want %s", tt.infomask, strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRowHeader(t *testing.T) {
+	// the first tuple of the sample relation: xmin 23597, ctid (0,1),
+	// natts 2, HEAP_XMIN_COMMITTED | HEAP_XMAX_INVALID | HEAP_HASVARWIDTH
+	img := []byte{
+		0x2d, 0x5c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x02, 0x00, 0x02, 0x09, 0x18,
+	}
+	rh, err := ParseRowHeader(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RowHeader{Xmin: 23597, CTIDOffset: 1, InfoMask2: 2, InfoMask: 0x0902, Hoff: 24}
+	if *rh != want {
+		t.Errorf("got %+v, want %+v", *rh, want)
+	}
+	if rh.Natts() != 2 || rh.CTID() != (ItemPointer{Block: 0, Offset: 1}) || !rh.LooksLive() {
+		t.Errorf("natts=%d ctid=%v live=%v", rh.Natts(), rh.CTID(), rh.LooksLive())
+	}
+	if _, err := ParseRowHeader(img[:RowHeaderByteLen-1]); err == nil {
+		t.Error("22 bytes: no error")
+	}
+}
+
+func TestLockMode(t *testing.T) {
+	// infomask bits as heap_lock_tuple's compute_infobits sets them, plus
+	// the pre-9.3 forms pg_upgrade carries over
+	tests := []struct {
+		name      string
+		xmax      uint32
+		infomask  uint16
+		infomask2 uint16
+		want      string
+	}{
+		{"no xmax", 0, HEAP_XMAX_INVALID, 0, "none"},
+		{"FOR KEY SHARE", 742, HEAP_XMAX_LOCK_ONLY | HEAP_XMAX_KEYSHR_LOCK, 0, "FOR KEY SHARE"},
+		{"FOR SHARE", 742, HEAP_XMAX_LOCK_ONLY | HEAP_XMAX_SHR_LOCK, 0, "FOR SHARE"},
+		{"FOR NO KEY UPDATE", 742, HEAP_XMAX_LOCK_ONLY | HEAP_XMAX_EXCL_LOCK, 0, "FOR NO KEY UPDATE"},
+		{"FOR UPDATE", 742, HEAP_XMAX_LOCK_ONLY | HEAP_XMAX_EXCL_LOCK, HEAP_KEYS_UPDATED, "FOR UPDATE"},
+		{"pre-9.3 FOR UPDATE", 742, HEAP_XMAX_EXCL_LOCK, 0, "FOR UPDATE"},
+		{"pre-9.3 FOR SHARE", 742, HEAP_XMAX_LOCK_ONLY, 0, "FOR SHARE"},
+		{"multixact lockers", 9, HEAP_XMAX_IS_MULTI | HEAP_XMAX_LOCK_ONLY | HEAP_XMAX_KEYSHR_LOCK, 0, "multixact"},
+		{"locker aborted", 742, HEAP_XMAX_LOCK_ONLY | HEAP_XMAX_EXCL_LOCK | HEAP_XMAX_INVALID, 0, "none"},
+		{"deleted", 742, 0, HEAP_KEYS_UPDATED, "none"},
+		{"updated", 742, HEAP_XMAX_COMMITTED, HEAP_HOT_UPDATED, "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := &RowHeader{Xmin: 741, Xmax: tt.xmax, InfoMask: HEAP_XMIN_COMMITTED | tt.infomask, InfoMask2: 2 | tt.infomask2}
+			if got := LockMode(rh); got != tt.want {
+				t.Errorf("LockMode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package heappage
+
+// Range types (utils/rangetypes.h). After the varlena header:
+//
+//	Oid   rangetypid
+//	...   lower bound, then upper bound, each aligned to the subtype's
+//	      typalign and present only if the range is non-empty and that
+//	      side is finite
+//	char  flags        the LAST byte of the datum
+//
+// As for arrays, bound alignment is relative to the 4-byte varlena header,
+// so a placeholder is put back in front before walking.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	rangeEmpty  = 0x01
+	rangeLBInc  = 0x02
+	rangeUBInc  = 0x04
+	rangeLBInf  = 0x08
+	rangeUBInf  = 0x10
+	rangeLBNull = 0x20 // never set in stored values
+	rangeUBNull = 0x40
+)
+
+// range type oid -> subtype oid
+var rangeTypes = map[Oid]Oid{
+	3904: INT4OID,
+	3906: NUMERICOID,
+	3908: TIMESTAMPOID,
+	3910: TIMESTAMPTZOID,
+	3912: DATEOID,
+	3926: INT8OID,
+}
+
+var rangeNames = map[Oid]string{
+	3904: "int4range",
+	3906: "numrange",
+	3908: "tsrange",
+	3910: "tstzrange",
+	3912: "daterange",
+	3926: "int8range",
+}
+
+// A range is aligned like its subtype, and at least 'i', so int8range,
+// tsrange and tstzrange are 'd'. The subtypes are registered by files
+// initialized before this one (datetime.go, numeric.go) or are core types.
+func init() {
+	for rng, sub := range rangeTypes {
+		st, ok := LookupType(sub)
+		if !ok {
+			panic(fmt.Sprintf("range type %d: subtype %d is not registered", rng, sub))
+		}
+		RegisterType(rng, TypeInfo{rangeNames[rng], -1, containerAlign(st.Align), varlenaDecoderWith(rangeDecoder(sub))})
+	}
+}
+
+func rangeDecoder(subtype Oid) func(payload []byte, opt *Options) (any, error) {
+	return func(payload []byte, opt *Options) (any, error) { return decodeRange(payload, subtype, opt) }
+}
+
+// decodeRange renders a range like range_out: [1,10), (,5], empty. The
+// bounds are decoded with opt, so FloatDatetimes applies to tsrange bounds
+// too.
+func decodeRange(payload []byte, subtype Oid, opt *Options) (string, error) {
+	if len(payload) < 5 {
+		return "", fmt.Errorf("range datum too short: %d bytes", len(payload))
+	}
+	flags := payload[len(payload)-1]
+	if flags&rangeEmpty != 0 {
+		return "empty", nil
+	}
+	sub, ok := LookupType(subtype)
+	if !ok {
+		return "", fmt.Errorf("unsupported range subtype %d", subtype)
+	}
+
+	buf := make([]byte, 4+len(payload)-1) // placeholder header, no flags byte
+	copy(buf[4:], payload)
+	if got := Oid(binary.LittleEndian.Uint32(buf[4:])); rangeTypes[got] != subtype && rangeTypes[got] != 0 {
+		return "", fmt.Errorf("range datum is of type %d, not a range over %d", got, subtype)
+	}
+	off := 8
+	bound := func() (string, error) {
+		if sub.Len == -1 {
+			off = alignAttr(buf, off, &ColumnDef{Len: -1, Align: sub.Align})
+		} else {
+			off = Align(off, sub.Align)
+		}
+		v, next, err := sub.Decode(buf, off, opt)
+		if err != nil {
+			return "", err
+		}
+		off = next
+		return rangeBoundEscape(formatRangeValue(v)), nil
+	}
+
+	var sb strings.Builder
+	if flags&rangeLBInc != 0 {
+		sb.WriteByte('[')
+	} else {
+		sb.WriteByte('(')
+	}
+	if flags&(rangeLBInf|rangeLBNull) == 0 {
+		s, err := bound()
+		if err != nil {
+			return "", fmt.Errorf("range lower bound: %w", err)
+		}
+		sb.WriteString(s)
+	}
+	sb.WriteByte(',')
+	if flags&(rangeUBInf|rangeUBNull) == 0 {
+		s, err := bound()
+		if err != nil {
+			return "", fmt.Errorf("range upper bound: %w", err)
+		}
+		sb.WriteString(s)
+	}
+	if flags&rangeUBInc != 0 {
+		sb.WriteByte(']')
+	} else {
+		sb.WriteByte(')')
+	}
+	return sb.String(), nil
+}
+
+func formatRangeValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// rangeBoundEscape double-quotes a bound that is empty or contains
+// characters special to range input, like range_bound_escape.
+func rangeBoundEscape(s string) string {
+	if s != "" && !strings.ContainsAny(s, "\"\\()[], \t\n\r\v\f") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,127 @@
+package heappage
+
+// -schema parsing: "name:type,name:type,..." using the type registry names
+// (and a few SQL spellings), e.g. "id:bigint,name:text,tags:text[]". A
+// composite column lists its fields in parentheses the same way, e.g.
+// "id:int8,addr:(street:text,zip:int4)".
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var typeAliases = map[string]string{
+	"bigint":            "int8",
+	"integer":           "int4",
+	"int":               "int4",
+	"smallint":          "int2",
+	"boolean":           "bool",
+	"real":              "float4",
+	"double precision":  "float8",
+	"character varying": "varchar",
+	"character":         "bpchar",
+	// "char" is deliberately not an alias: it names the internal 1-byte
+	// type; spell char(n) as bpchar.
+}
+
+// TypeByName finds a registered type by name; "T[]" means the array of T.
+func TypeByName(name string) (Oid, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if elem, ok := strings.CutSuffix(name, "[]"); ok {
+		elemOid, ok := TypeByName(elem)
+		if !ok {
+			return 0, false
+		}
+		for arr, e := range arrayTypes {
+			if e == elemOid {
+				return arr, true
+			}
+		}
+		return 0, false
+	}
+	if a, ok := typeAliases[name]; ok {
+		name = a
+	}
+	if elem, ok := strings.CutPrefix(name, "_"); ok {
+		return TypeByName(elem + "[]") // pg_type's own name for T[]
+	}
+	for oid, t := range typeRegistry {
+		if t.Name == name {
+			return oid, true
+		}
+	}
+	return 0, false
+}
+
+// ParseSchema parses a -schema spec into column definitions, with the type
+// layouts opt selects (aclitem with LegacyAclItem).
+func ParseSchema(spec string, opt *Options) ([]ColumnDef, error) {
+	parts, err := splitSchema(spec)
+	if err != nil {
+		return nil, err
+	}
+	var cols []ColumnDef
+	for _, part := range parts {
+		name, typ, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("bad schema column %q, want name:type", part)
+		}
+		if inner, ok := strings.CutPrefix(strings.TrimSpace(typ), "("); ok {
+			inner, ok = strings.CutSuffix(inner, ")")
+			if !ok {
+				return nil, fmt.Errorf("column %q: composite type %q does not end in \")\"", name, typ)
+			}
+			fields, err := ParseSchema(inner, opt)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: %w", name, err)
+			}
+			cols = append(cols, CompositeColumn(name, RECORDOID, fields))
+			continue
+		}
+		oid, ok := TypeByName(typ)
+		if !ok {
+			return nil, fmt.Errorf("column %q: unknown type %q", name, typ)
+		}
+		cols = append(cols, columnWith(name, oid, opt))
+	}
+	return cols, nil
+}
+
+// splitSchema splits a -schema spec at the commas outside parentheses.
+func splitSchema(spec string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range spec {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("unbalanced \")\" at %d in schema %q", i, spec)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unclosed \"(\" in schema %q", spec)
+	}
+	return append(parts, spec[start:]), nil
+}
+
+// ParseAttrs parses a comma-separated list of 1-based attribute numbers.
+func ParseAttrs(spec string) ([]int, error) {
+	var out []int
+	for _, part := range strings.Split(spec, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("bad attribute number %q", part)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,58 @@
+package heappage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []ColumnDef
+	}{
+		{"id:int8,name:text", []ColumnDef{Column("id", INT8OID), Column("name", TEXTOID)}},
+		{"id: bigint, ok:boolean", []ColumnDef{Column("id", INT8OID), Column("ok", BOOLOID)}},
+		{
+			"id:int8,addr:(street:text,zip:int4),n:int2",
+			[]ColumnDef{
+				Column("id", INT8OID),
+				CompositeColumn("addr", RECORDOID, []ColumnDef{Column("street", TEXTOID), Column("zip", INT4OID)}),
+				Column("n", INT2OID),
+			},
+		},
+		{
+			"p:(a:int4, q:(b:text))",
+			[]ColumnDef{
+				CompositeColumn("p", RECORDOID, []ColumnDef{
+					Column("a", INT4OID),
+					CompositeColumn("q", RECORDOID, []ColumnDef{Column("b", TEXTOID)}),
+				}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseSchema(tt.spec, nil)
+		if err != nil {
+			t.Errorf("ParseSchema(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSchema(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, spec := range []string{
+		"id",
+		"id:nosuchtype",
+		"addr:(street:text",
+		"addr:street:text)",
+		"addr:(street:text)x",
+		"addr:(street)",
+	} {
+		if cols, err := ParseSchema(spec, nil); err == nil {
+			t.Errorf("ParseSchema(%q) = %+v, want an error", spec, cols)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package heappage
+
+// tsquery (tsearch/ts_type.h). After the varlena header:
+//
+//	int32     size            number of items
+//	QueryItem items[size]     12 bytes each, the tree in prefix order
+//	char      operands[]      lexemes, NUL-terminated
+//
+// A QueryItem is either
+//
+//	QueryOperand   int8 type=1, uint8 weight, bool prefix, pad,
+//	               int32 valcrc, uint32 length:12 | distance:20
+//	QueryOperator  int8 type=2, int8 oper, int16 distance, uint32 left
+//
+// distance of an operand is the offset of its lexeme in operands[]; that of
+// an operator is the <N> of a phrase. An operator's right operand is the
+// next item and its left one follows the right subtree, so the tree can be
+// read front to back without using left.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const TSQUERYOID Oid = 3615
+
+const (
+	tsQueryItemLen = 12 // sizeof(QueryItem)
+
+	qiVal = 1 // QI_VAL
+	qiOpr = 2 // QI_OPR
+
+	opNot    = 1
+	opAnd    = 2
+	opOr     = 3
+	opPhrase = 4
+)
+
+// tsQueryPriority is tsearch_op_priority, indexed by oper
+var tsQueryPriority = [...]int{opNot: 4, opAnd: 2, opOr: 1, opPhrase: 3}
+
+func init() {
+	RegisterType(TSQUERYOID, TypeInfo{"tsquery", -1, 'i', varlenaDecoder(decodeTSQueryAny)})
+}
+
+func decodeTSQueryAny(payload []byte) (any, error) { return decodeTSQuery(payload) }
+
+// decodeTSQuery renders a tsquery like tsqueryout: 'cat' & ( 'dog' | 'rat' ),
+// with parentheses where a child binds looser than its parent, and around a
+// phrase that is the right operand of another phrase.
+func decodeTSQuery(payload []byte) (string, error) {
+	if len(payload) < 4 {
+		return "", fmt.Errorf("tsquery header truncated")
+	}
+	size := int(int32(binary.LittleEndian.Uint32(payload)))
+	opsOff := 4 + tsQueryItemLen*size
+	if size < 0 || opsOff > len(payload) {
+		return "", fmt.Errorf("tsquery: %d items do not fit in %d bytes", size, len(payload))
+	}
+	if size == 0 {
+		return "", nil // an empty query, e.g. of stop words only
+	}
+	q := tsQuery{items: payload[4:opsOff], operands: payload[opsOff:], size: size}
+	var sb strings.Builder
+	if err := q.infix(&sb, -1, false); err != nil {
+		return "", err
+	}
+	if q.next != size {
+		return "", fmt.Errorf("tsquery: tree ends at item %d of %d", q.next, size)
+	}
+	return sb.String(), nil
+}
+
+type tsQuery struct {
+	items, operands []byte
+	size, next      int // next: the item infix reads next
+}
+
+func (q *tsQuery) infix(sb *strings.Builder, parentPriority int, rightPhrase bool) error {
+	if q.next >= q.size {
+		return fmt.Errorf("tsquery: the %d items end in the middle of the tree", q.size)
+	}
+	i := q.next
+	item := q.items[tsQueryItemLen*i : tsQueryItemLen*(i+1)]
+	q.next++
+	switch item[0] {
+	case qiVal:
+		return q.operand(sb, i, item)
+	case qiOpr:
+	default:
+		return fmt.Errorf("tsquery item %d: unknown type %d", i, item[0])
+	}
+
+	op := int(item[1])
+	if op < opNot || op > opPhrase {
+		return fmt.Errorf("tsquery item %d: unknown operator %d", i, op)
+	}
+	priority := tsQueryPriority[op]
+	if op == opNot {
+		paren := priority < parentPriority
+		if paren {
+			sb.WriteString("( ")
+		}
+		sb.WriteByte('!')
+		if err := q.infix(sb, priority, false); err != nil {
+			return err
+		}
+		if paren {
+			sb.WriteString(" )")
+		}
+		return nil
+	}
+
+	paren := priority < parentPriority || op == opPhrase && rightPhrase
+	// the right operand comes first in the items but is printed last
+	var right strings.Builder
+	if err := q.infix(&right, priority, op == opPhrase); err != nil {
+		return err
+	}
+	if paren {
+		sb.WriteString("( ")
+	}
+	if err := q.infix(sb, priority, false); err != nil {
+		return err
+	}
+	switch op {
+	case opAnd:
+		sb.WriteString(" & ")
+	case opOr:
+		sb.WriteString(" | ")
+	case opPhrase:
+		if d := int16(binary.LittleEndian.Uint16(item[2:])); d != 1 {
+			fmt.Fprintf(sb, " <%d> ", d)
+		} else {
+			sb.WriteString(" <-> ")
+		}
+	}
+	sb.WriteString(right.String())
+	if paren {
+		sb.WriteString(" )")
+	}
+	return nil
+}
+
+// operand writes a quoted lexeme with its :* prefix mark and weights.
+func (q *tsQuery) operand(sb *strings.Builder, i int, item []byte) error {
+	weight, prefix := item[1], item[2] != 0
+	bits := binary.LittleEndian.Uint32(item[8:])
+	n, off := int(bits&0xFFF), int(bits>>12)
+	if off+n > len(q.operands) {
+		return fmt.Errorf("tsquery item %d: lexeme [%d,%d) outside %d operand bytes", i, off, off+n, len(q.operands))
+	}
+	sb.WriteByte('\'')
+	for _, c := range q.operands[off : off+n] {
+		if c == '\'' || c == '\\' {
+			sb.WriteByte(c)
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteByte('\'')
+	if weight != 0 || prefix {
+		sb.WriteByte(':')
+		if prefix {
+			sb.WriteByte('*')
+		}
+		for b, w := range "ABCD" {
+			if weight&(1<<(3-b)) != 0 {
+				sb.WriteRune(w)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// tsNode is a tsquery tree node: an operand if op is 0, else an operator
+// over right (and left, except for !). dist is a phrase's <N>.
+type tsNode struct {
+	word        string
+	weight      uint8 // A=8, B=4, C=2, D=1
+	prefix      bool
+	op          uint8
+	dist        int16
+	left, right *tsNode
+}
+
+func tsWord(w string) *tsNode    { return &tsNode{word: w} }
+func tsNot(n *tsNode) *tsNode    { return &tsNode{op: opNot, right: n} }
+func tsAnd(l, r *tsNode) *tsNode { return &tsNode{op: opAnd, left: l, right: r} }
+func tsOr(l, r *tsNode) *tsNode  { return &tsNode{op: opOr, left: l, right: r} }
+func tsPhrase(l *tsNode, d int16, r *tsNode) *tsNode {
+	return &tsNode{op: opPhrase, dist: d, left: l, right: r}
+}
+
+// tsqueryDatum lays out a tree the way tsqueryin does: items in prefix
+// order with an operator's right operand first, then the lexemes.
+func tsqueryDatum(root *tsNode) []byte {
+	var items, operands []byte
+	var emit func(n *tsNode)
+	emit = func(n *tsNode) {
+		item := make([]byte, tsQueryItemLen)
+		at := len(items)
+		items = append(items, item...)
+		item = items[at:]
+		if n.op == 0 {
+			item[0], item[1] = qiVal, n.weight
+			if n.prefix {
+				item[2] = 1
+			}
+			binary.LittleEndian.PutUint32(item[8:], uint32(len(operands))<<12|uint32(len(n.word)))
+			operands = append(append(operands, n.word...), 0)
+			return
+		}
+		item[0], item[1] = qiOpr, n.op
+		binary.LittleEndian.PutUint16(item[2:], uint16(n.dist))
+		emit(n.right)
+		if n.left != nil {
+			binary.LittleEndian.PutUint32(items[at+4:], uint32((len(items)-at)/tsQueryItemLen))
+			emit(n.left)
+		}
+	}
+	if root != nil {
+		emit(root)
+	}
+	return varlena4(int32s(int32(len(items)/tsQueryItemLen)), items, operands)
+}
+
+func TestDecodeTSQuery(t *testing.T) {
+	a, b, c, d := tsWord("a"), tsWord("b"), tsWord("c"), tsWord("d")
+	tests := []struct {
+		name string
+		root *tsNode
+		want string
+	}{
+		{"empty", nil, ""},
+		{"operand", a, "'a'"},
+		{"and", tsAnd(a, b), "'a' & 'b'"},
+		{"or of and", tsOr(tsAnd(a, b), c), "'a' & 'b' | 'c'"},
+		{"and of or", tsAnd(a, tsOr(b, c)), "'a' & ( 'b' | 'c' )"},
+		{"or on the left", tsAnd(tsOr(a, b), c), "( 'a' | 'b' ) & 'c'"},
+		{"not", tsAnd(tsNot(a), b), "!'a' & 'b'"},
+		{"not of and", tsNot(tsAnd(a, b)), "!( 'a' & 'b' )"},
+		{"not not", tsNot(tsNot(a)), "!!'a'"},
+		{"phrase", tsPhrase(a, 1, b), "'a' <-> 'b'"},
+		{"distance", tsPhrase(a, 3, b), "'a' <3> 'b'"},
+		{"distance 0", tsPhrase(a, 0, b), "'a' <0> 'b'"},
+		{"phrase chain", tsPhrase(tsPhrase(a, 1, b), 2, c), "'a' <-> 'b' <2> 'c'"},
+		{"phrase on the right", tsPhrase(a, 1, tsPhrase(b, 1, c)), "'a' <-> ( 'b' <-> 'c' )"},
+		{"phrase under and", tsAnd(a, tsPhrase(b, 1, c)), "'a' & 'b' <-> 'c'"},
+		{"or under phrase", tsPhrase(tsOr(a, b), 1, c), "( 'a' | 'b' ) <-> 'c'"},
+		{"not under phrase", tsPhrase(tsNot(a), 1, b), "!'a' <-> 'b'"},
+		{"not of phrase", tsNot(tsPhrase(a, 1, b)), "!( 'a' <-> 'b' )"},
+		{"deep", tsOr(tsAnd(a, tsNot(b)), tsPhrase(c, 2, d)), "'a' & !'b' | 'c' <2> 'd'"},
+		{"weights", &tsNode{word: "fat", weight: 8 | 4}, "'fat':AB"},
+		{"all weights", &tsNode{word: "fat", weight: 15}, "'fat':ABCD"},
+		{"prefix", &tsNode{word: "sup", prefix: true}, "'sup':*"},
+		{"prefix and weight", &tsNode{word: "sup", prefix: true, weight: 2}, "'sup':*C"},
+		{"quoted", tsAnd(tsWord("it's"), tsWord(`a\b`)), `'it''s' & 'a\\b'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datum := tsqueryDatum(tt.root)
+			v, next, err := mustType(t, TSQUERYOID).Decode(datum, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != len(datum) {
+				t.Errorf("got %q, next %d; want %q, next %d", v, next, tt.want, len(datum))
+			}
+		})
+	}
+}
+
+func TestDecodeTSQueryErrors(t *testing.T) {
+	and := tsqueryDatum(tsAnd(tsWord("a"), tsWord("b")))[4:]
+	items, operands := and[4:4+3*tsQueryItemLen], and[4+3*tsQueryItemLen:]
+	build := func(size int32, items []byte) []byte {
+		return append(append(int32s(size), items...), operands...)
+	}
+	withByte := func(off int, v byte) []byte {
+		b := append([]byte(nil), and...)
+		b[off] = v
+		return b
+	}
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"header truncated", []byte{1}, "header truncated"},
+		{"items past the end", int32s(2, 0, 0), "2 items do not fit"},
+		{"negative size", int32s(-1), "-1 items do not fit"},
+		{"tree cut short", build(2, items[:2*tsQueryItemLen]), "end in the middle of the tree"},
+		{"items left over", build(2, items[tsQueryItemLen:]), "tree ends at item 1 of 2"},
+		{"unknown operator", withByte(4+1, 9), "unknown operator 9"},
+		{"unknown item type", withByte(4, 3), "unknown type 3"},
+		{"lexeme past the operands", and[:len(and)-3], "outside 1 operand bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := decodeTSQuery(tt.payload)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %q, %v; want error %q", v, err, tt.want)
+			}
+		})
+	}
+}
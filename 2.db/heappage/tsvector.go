@@ -0,0 +1,83 @@
+package heappage
+
+// tsvector (tsearch/ts_type.h). After the varlena header:
+//
+//	int32     size            number of lexemes
+//	WordEntry entries[size]   haspos:1 | len:11 | pos:20 (low bits first)
+//	char      data[]          lexemes, each optionally followed, at the
+//	                          next 2-byte boundary, by uint16 npos and
+//	                          WordEntryPos[npos] (weight:2 | position:14)
+//
+// pos is relative to data, which always starts on an even offset.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const TSVECTOROID Oid = 3614
+
+// weight letters by WEP_GETWEIGHT; D (0) is the default and not printed
+var tsWeights = [4]string{"", "C", "B", "A"}
+
+func init() {
+	RegisterType(TSVECTOROID, TypeInfo{"tsvector", -1, 'i', varlenaDecoder(decodeTSVectorAny)})
+}
+
+func decodeTSVectorAny(payload []byte) (any, error) { return decodeTSVector(payload) }
+
+// decodeTSVector renders a tsvector like tsvectorout: 'cat':1 'sat':3A.
+func decodeTSVector(payload []byte) (string, error) {
+	if len(payload) < 4 {
+		return "", fmt.Errorf("tsvector header truncated")
+	}
+	size := int(int32(binary.LittleEndian.Uint32(payload)))
+	dataOff := 4 + 4*size
+	if size < 0 || dataOff > len(payload) {
+		return "", fmt.Errorf("tsvector: %d lexemes do not fit in %d bytes", size, len(payload))
+	}
+	data := payload[dataOff:]
+
+	parts := make([]string, size)
+	for i := range parts {
+		e := binary.LittleEndian.Uint32(payload[4+4*i:])
+		hasPos := e&1 != 0
+		n := int(e>>1) & 0x7FF
+		pos := int(e >> 12)
+		if pos+n > len(data) {
+			return "", fmt.Errorf("tsvector lexeme %d: [%d,%d) outside %d data bytes", i, pos, pos+n, len(data))
+		}
+		var sb strings.Builder
+		sb.WriteByte('\'')
+		for _, c := range data[pos : pos+n] {
+			if c == '\'' || c == '\\' {
+				sb.WriteByte(c)
+			}
+			sb.WriteByte(c)
+		}
+		sb.WriteByte('\'')
+
+		if hasPos {
+			at := Align(pos+n, 's')
+			if at+2 > len(data) {
+				return "", fmt.Errorf("tsvector lexeme %d: positions truncated", i)
+			}
+			npos := int(binary.LittleEndian.Uint16(data[at:]))
+			if at+2+2*npos > len(data) {
+				return "", fmt.Errorf("tsvector lexeme %d: %d positions truncated", i, npos)
+			}
+			for j := range npos {
+				wep := binary.LittleEndian.Uint16(data[at+2+2*j:])
+				if j == 0 {
+					sb.WriteByte(':')
+				} else {
+					sb.WriteByte(',')
+				}
+				fmt.Fprintf(&sb, "%d%s", wep&0x3FFF, tsWeights[wep>>14])
+			}
+		}
+		parts[i] = sb.String()
+	}
+	return strings.Join(parts, " "), nil
+}
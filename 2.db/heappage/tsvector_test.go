@@ -0,0 +1,89 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// tsLexeme is a lexeme and its WordEntryPos values (weight<<14 | position),
+// nil for a lexeme stored without positions.
+type tsLexeme struct {
+	word string
+	pos  []uint16
+}
+
+// tsvectorDatum lays out a tsvector the way tsvectorin does, lexemes in the
+// order given: the entries, then each lexeme followed, if it has positions,
+// by padding to a 2-byte boundary, npos and the positions.
+func tsvectorDatum(lexemes ...tsLexeme) []byte {
+	b := int32s(int32(len(lexemes)))
+	var data []byte
+	for _, l := range lexemes {
+		e := uint32(len(data))<<12 | uint32(len(l.word))<<1
+		data = append(data, l.word...)
+		if l.pos != nil {
+			e |= 1
+			data = append(data, make([]byte, Align(len(data), 's')-len(data))...)
+			data = binary.LittleEndian.AppendUint16(data, uint16(len(l.pos)))
+			for _, p := range l.pos {
+				data = binary.LittleEndian.AppendUint16(data, p)
+			}
+		}
+		b = binary.LittleEndian.AppendUint32(b, e)
+	}
+	return varlena4(b, data)
+}
+
+func TestDecodeTSVector(t *testing.T) {
+	const a, b, c = 3 << 14, 2 << 14, 1 << 14
+	tests := []struct {
+		name  string
+		datum []byte
+		want  string
+	}{
+		{"empty", tsvectorDatum(), ""},
+		{"positions", tsvectorDatum(tsLexeme{"cat", []uint16{1}}, tsLexeme{"sat", []uint16{3, 7}}), "'cat':1 'sat':3,7"},
+		{"weights", tsvectorDatum(tsLexeme{"fat", []uint16{1 | a, 2 | b, 3 | c, 4}}), "'fat':1A,2B,3C,4"},
+		{"largest position", tsvectorDatum(tsLexeme{"end", []uint16{16383 | a}}), "'end':16383A"},
+		{"without positions", tsvectorDatum(tsLexeme{"a", nil}, tsLexeme{"rat", nil}), "'a' 'rat'"},
+		{"mixed", tsvectorDatum(tsLexeme{"ab", nil}, tsLexeme{"cde", []uint16{2 | b}}, tsLexeme{"f", nil}), "'ab' 'cde':2B 'f'"},
+		{"even lexeme", tsvectorDatum(tsLexeme{"dogs", []uint16{5}}, tsLexeme{"x", []uint16{6}}), "'dogs':5 'x':6"},
+		{"quote", tsvectorDatum(tsLexeme{"it's", []uint16{1}}), "'it''s':1"},
+		{"backslash", tsvectorDatum(tsLexeme{`back\slash`, nil}), `'back\\slash'`},
+		{"space", tsvectorDatum(tsLexeme{"new york", []uint16{2 | a}}), "'new york':2A"},
+		{"multibyte", tsvectorDatum(tsLexeme{"café", []uint16{1}}), "'café':1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, next, err := mustType(t, TSVECTOROID).Decode(tt.datum, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != len(tt.datum) {
+				t.Errorf("got %q, next %d; want %q, next %d", v, next, tt.want, len(tt.datum))
+			}
+		})
+	}
+}
+
+func TestDecodeTSVectorErrors(t *testing.T) {
+	good := tsvectorDatum(tsLexeme{"cat", []uint16{1, 2}})
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"header truncated", []byte{1, 0}},
+		{"entries past the end", int32s(3, 0)},
+		{"negative size", int32s(-1)},
+		{"lexeme past the data", append(int32s(1, 10<<1), "cat"...)},
+		{"positions truncated", good[4 : len(good)-2]},
+		{"npos missing", append(int32s(1, 3<<1|1), "cat"...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, err := decodeTSVector(tt.payload); err == nil {
+				t.Errorf("got %q, want an error", v)
+			}
+		})
+	}
+}
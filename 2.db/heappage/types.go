@@ -0,0 +1,315 @@
+package heappage
+
+// Type registry: pg_type oid -> how to decode a datum of that type.
+// Only the subset of built-in types this tool understands is listed; unknown
+// oids fall back to raw bytes in DecodeRow.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Oid uint32
+
+// pg_type oids (pg_type.dat)
+const (
+	BOOLOID    Oid = 16
+	BYTEAOID   Oid = 17
+	CHAROID    Oid = 18
+	NAMEOID    Oid = 19
+	INT8OID    Oid = 20
+	INT2OID    Oid = 21
+	INT4OID    Oid = 23
+	TEXTOID    Oid = 25
+	OIDOID     Oid = 26
+	XIDOID     Oid = 28
+	CIDOID     Oid = 29
+	FLOAT4OID  Oid = 700
+	FLOAT8OID  Oid = 701
+	BPCHAROID  Oid = 1042
+	CSTRINGOID Oid = 2275
+	UUIDOID    Oid = 2950
+	VARCHAROID Oid = 1043
+	XID8OID    Oid = 5069
+)
+
+const NameDataLen = 64 // NAMEDATALEN
+
+// TypeDecoder decodes one datum starting at buf[off] and returns the value
+// and the offset just past it. off is already aligned to the type's typalign
+// by the caller, and buf ends where the tuple ends, so a decoder must check
+// its own bounds (fixedSlice, ReadVarlenaLE) rather than assume them. opt
+// holds the settings the value is rendered with and may be nil. On error the
+// returned offset is ignored.
+type TypeDecoder func(buf []byte, off int, opt *Options) (any, int, error)
+
+type TypeInfo struct {
+	Name   string
+	Len    int  // typlen: >0 fixed width, -1 varlena, -2 cstring
+	Align  byte // typalign: 'c','s','i','d'
+	Decode TypeDecoder
+}
+
+// typeRegistry starts out with the core types of this file, registered
+// during package variable initialization so that package-level schemas built
+// with Column (see catalog.go) can use them. The other files register their
+// types from init.
+var typeRegistry = registerCoreTypes(map[Oid]TypeInfo{})
+
+// RegisterType makes a type known to DecodeRow by oid and to -schema by
+// name. The built-in types register themselves the same way; code adding an
+// extension type (hstore, ltree, PostGIS geometry, ...) calls it with the
+// oid CREATE EXTENSION assigned in that cluster's pg_type. Array types are
+// not registered: arrayTypes maps them to their element type. Like
+// database/sql.Register it panics on a duplicate oid or an invalid TypeInfo.
+func RegisterType(oid Oid, t TypeInfo) { registerType(typeRegistry, oid, t) }
+
+func registerType(reg map[Oid]TypeInfo, oid Oid, t TypeInfo) {
+	if _, dup := reg[oid]; dup {
+		panic(fmt.Sprintf("RegisterType: oid %d registered twice", oid))
+	}
+	if t.Name == "" || t.Decode == nil || (t.Len <= 0 && t.Len != -1 && t.Len != -2) || !strings.ContainsRune("csid", rune(t.Align)) {
+		panic(fmt.Sprintf("RegisterType: invalid TypeInfo for oid %d: %+v", oid, t))
+	}
+	reg[oid] = t
+}
+
+func registerCoreTypes(reg map[Oid]TypeInfo) map[Oid]TypeInfo {
+	registerType(reg, BOOLOID, TypeInfo{"bool", 1, 'c', decodeBool})
+	registerType(reg, BYTEAOID, TypeInfo{"bytea", -1, 'i', varlenaDecoder(decodeBytea)})
+	registerType(reg, CHAROID, TypeInfo{"char", 1, 'c', fixedStringDecoder(1, decodeInternalChar)})
+	registerType(reg, NAMEOID, TypeInfo{"name", NameDataLen, 'c', decodeName})
+	registerType(reg, INT8OID, TypeInfo{"int8", 8, 'd', decodeInt8})
+	registerType(reg, INT2OID, TypeInfo{"int2", 2, 's', decodeInt2})
+	registerType(reg, INT4OID, TypeInfo{"int4", 4, 'i', decodeInt4})
+	registerType(reg, TEXTOID, TypeInfo{"text", -1, 'i', varlenaDecoderWith(decodeText)})
+	registerType(reg, OIDOID, TypeInfo{"oid", 4, 'i', decodeOid})
+	registerType(reg, XIDOID, TypeInfo{"xid", 4, 'i', decodeXid})
+	registerType(reg, CIDOID, TypeInfo{"cid", 4, 'i', decodeXid})
+	registerType(reg, FLOAT4OID, TypeInfo{"float4", 4, 'i', decodeFloat4})
+	registerType(reg, FLOAT8OID, TypeInfo{"float8", 8, 'd', decodeFloat8})
+	registerType(reg, BPCHAROID, TypeInfo{"bpchar", -1, 'i', varlenaDecoderWith(decodeText)})
+	registerType(reg, VARCHAROID, TypeInfo{"varchar", -1, 'i', varlenaDecoderWith(decodeText)})
+	registerType(reg, CSTRINGOID, TypeInfo{"cstring", -2, 'c', decodeCString})
+	registerType(reg, XID8OID, TypeInfo{"xid8", 8, 'd', decodeXid8})
+	registerType(reg, UUIDOID, TypeInfo{"uuid", 16, 'c', fixedStringDecoder(16, decodeUUID)})
+	return reg
+}
+
+// LookupType finds a registered type, or an array type whose element type
+// is known. Array names and alignment are derived here rather than at init
+// so they see element types registered by any file, or later by
+// RegisterType.
+func LookupType(oid Oid) (TypeInfo, bool) {
+	if t, ok := typeRegistry[oid]; ok {
+		return t, true
+	}
+	elem, ok := arrayTypes[oid]
+	if !ok {
+		return TypeInfo{}, false
+	}
+	name, align := "_"+fmt.Sprint(elem), byte('i')
+	if t, ok := typeRegistry[elem]; ok {
+		name, align = "_"+t.Name, containerAlign(t.Align)
+	}
+	return TypeInfo{name, -1, align, varlenaDecoderWith(decodeArrayAny)}, true
+}
+
+// containerAlign is the typalign of an array or range over elements aligned
+// as elem: 'd' for an 8-byte aligned element, else 'i', the alignment of the
+// 4-byte varlena header itself (DefineType, DefineRange).
+func containerAlign(elem byte) byte {
+	if elem == 'd' {
+		return 'd'
+	}
+	return 'i'
+}
+
+// varlenaDecoder adapts a payload decoder to a TypeDecoder by reading the
+// varlena header first.
+func varlenaDecoder(dec func(payload []byte) (any, error)) TypeDecoder {
+	return varlenaDecoderWith(func(payload []byte, _ *Options) (any, error) { return dec(payload) })
+}
+
+// varlenaDecoderWith is varlenaDecoder for a payload decoder that depends on
+// the decode options.
+func varlenaDecoderWith(dec func(payload []byte, opt *Options) (any, error)) TypeDecoder {
+	return func(buf []byte, off int, opt *Options) (any, int, error) {
+		payload, next, err := ReadVarlenaLE(buf, off)
+		if err != nil {
+			return nil, off, err
+		}
+		v, err := dec(payload, opt)
+		if err != nil {
+			return nil, off, err
+		}
+		return v, next, nil
+	}
+}
+
+// fixedStringDecoder adapts a decoder of a fixed-width type that renders to
+// text to a TypeDecoder, doing the bounds check up front.
+func fixedStringDecoder(n int, dec func(buf []byte, off int) (string, int)) TypeDecoder {
+	return fixedStringDecoderWith(n, func(buf []byte, off int, _ *Options) (string, int) { return dec(buf, off) })
+}
+
+// fixedStringDecoderWith is fixedStringDecoder for a decoder that depends
+// on the decode options.
+func fixedStringDecoderWith(n int, dec func(buf []byte, off int, opt *Options) (string, int)) TypeDecoder {
+	return func(buf []byte, off int, opt *Options) (any, int, error) {
+		if _, err := fixedSlice(buf, off, n); err != nil {
+			return nil, off, err
+		}
+		s, next := dec(buf, off, opt)
+		return s, next, nil
+	}
+}
+
+// decodeCString reads a NUL-terminated string (typlen -2) and returns the
+// offset past the NUL. cstring is a pseudo-type and never stored in user
+// tables, but typlen -2 is a legal attlen and must not derail the walk.
+func decodeCString(buf []byte, off int, opt *Options) (any, int, error) {
+	end, err := cstringEnd(buf, off)
+	if err != nil {
+		return nil, off, err
+	}
+	return opt.serverString(buf[off : end-1]), end, nil
+}
+
+// cstringEnd returns the offset just past the NUL ending the string at off.
+func cstringEnd(buf []byte, off int) (int, error) {
+	if off > len(buf) {
+		return off, io.ErrUnexpectedEOF
+	}
+	n := bytes.IndexByte(buf[off:], 0)
+	if n < 0 {
+		return off, errors.New("cstring without NUL terminator")
+	}
+	return off + n + 1, nil
+}
+
+func fixedSlice(buf []byte, off, n int) ([]byte, error) {
+	if off < 0 || off+n > len(buf) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf[off : off+n], nil
+}
+
+func decodeBool(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 1)
+	if err != nil {
+		return nil, off, err
+	}
+	return b[0] != 0, off + 1, nil
+}
+
+func decodeInt2(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 2)
+	if err != nil {
+		return nil, off, err
+	}
+	return int16(binary.LittleEndian.Uint16(b)), off + 2, nil
+}
+
+func decodeInt4(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 4)
+	if err != nil {
+		return nil, off, err
+	}
+	return int32(binary.LittleEndian.Uint32(b)), off + 4, nil
+}
+
+func decodeInt8(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 8)
+	if err != nil {
+		return nil, off, err
+	}
+	return int64(binary.LittleEndian.Uint64(b)), off + 8, nil
+}
+
+func decodeOid(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 4)
+	if err != nil {
+		return nil, off, err
+	}
+	return Oid(binary.LittleEndian.Uint32(b)), off + 4, nil
+}
+
+// xid and cid are plain uint32 counters.
+func decodeXid(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 4)
+	if err != nil {
+		return nil, off, err
+	}
+	return binary.LittleEndian.Uint32(b), off + 4, nil
+}
+
+// xid8 is a FullTransactionId: epoch in the high 32 bits, xid in the low.
+func decodeXid8(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 8)
+	if err != nil {
+		return nil, off, err
+	}
+	return binary.LittleEndian.Uint64(b), off + 8, nil
+}
+
+func decodeFloat4(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 4)
+	if err != nil {
+		return nil, off, err
+	}
+	return math.Float32frombits(binary.LittleEndian.Uint32(b)), off + 4, nil
+}
+
+func decodeFloat8(buf []byte, off int, _ *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, 8)
+	if err != nil {
+		return nil, off, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), off + 8, nil
+}
+
+// name is a fixed NAMEDATALEN buffer, NUL-padded.
+func decodeName(buf []byte, off int, opt *Options) (any, int, error) {
+	b, err := fixedSlice(buf, off, NameDataLen)
+	if err != nil {
+		return nil, off, err
+	}
+	n := 0
+	for n < len(b) && b[n] != 0 {
+		n++
+	}
+	return opt.serverString(b[:n]), off + NameDataLen, nil
+}
+
+// decodeInternalChar decodes PostgreSQL's internal single-byte "char" type
+// (pg_class.relkind, relpersistence, ...). It is NOT char(n)/bpchar, which is
+// a blank-padded varlena. Printable ASCII is shown as the character, anything
+// else as its signed integer value.
+func decodeInternalChar(buf []byte, off int) (string, int) {
+	c := buf[off]
+	if c >= 0x20 && c < 0x7F {
+		return string(rune(c)), off + 1
+	}
+	return strconv.Itoa(int(int8(c))), off + 1
+}
+
+func decodeText(payload []byte, opt *Options) (any, error) {
+	return opt.serverString(payload), nil
+}
+
+// decodeUUID renders the 16 stored bytes (network order) like uuid_out.
+func decodeUUID(buf []byte, off int) (string, int) {
+	b := buf[off : off+16]
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), off + 16
+}
+
+func decodeBytea(payload []byte) (any, error) {
+	return append([]byte(nil), payload...), nil
+}
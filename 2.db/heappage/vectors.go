@@ -0,0 +1,69 @@
+package heappage
+
+// int2vector and oidvector (utils/adt/int.c, oid.c), used by catalogs such
+// as pg_index.indkey and pg_proc.proargtypes. On disk they are ordinary
+// one-dimensional arrays without a NULL bitmap:
+//
+//	int32 ndim, int32 dataoffset (0), Oid elemtype, int32 dim1, int32 lbound1 (0), values[]
+//
+// but their text form is the bare values separated by spaces, e.g. "1 2 4".
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	INT2VECTOROID Oid = 22
+	OIDVECTOROID  Oid = 30
+)
+
+func init() {
+	RegisterType(INT2VECTOROID, TypeInfo{"int2vector", -1, 'i', varlenaDecoder(decodeInt2Vector)})
+	RegisterType(OIDVECTOROID, TypeInfo{"oidvector", -1, 'i', varlenaDecoder(decodeOidVector)})
+}
+
+func decodeInt2Vector(payload []byte) (any, error) {
+	return decodeVector(payload, INT2OID, 2, func(b []byte) string {
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(b))))
+	})
+}
+
+func decodeOidVector(payload []byte) (any, error) {
+	return decodeVector(payload, OIDOID, 4, func(b []byte) string {
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b)), 10)
+	})
+}
+
+// decodeVector checks the array header that int2vectorin/oidvectorin always
+// write and renders the elements. payload starts after the varlena header.
+func decodeVector(payload []byte, elem Oid, width int, format func([]byte) string) (string, error) {
+	const hdrLen = 20 // ndim, dataoffset, elemtype, dim1, lbound1
+	if len(payload) < 12 {
+		return "", fmt.Errorf("vector header truncated (%d bytes)", len(payload))
+	}
+	ndim := int32(binary.LittleEndian.Uint32(payload[0:]))
+	dataOffset := int32(binary.LittleEndian.Uint32(payload[4:]))
+	elemType := Oid(binary.LittleEndian.Uint32(payload[8:]))
+	if ndim == 0 {
+		return "", nil
+	}
+	if ndim != 1 || dataOffset != 0 || elemType != elem {
+		return "", fmt.Errorf("not a vector: ndim=%d dataoffset=%d elemtype=%d", ndim, dataOffset, elemType)
+	}
+	if len(payload) < hdrLen {
+		return "", fmt.Errorf("vector header truncated (%d bytes)", len(payload))
+	}
+	n := int(int32(binary.LittleEndian.Uint32(payload[12:])))
+	if n < 0 || hdrLen+n*width != len(payload) {
+		return "", fmt.Errorf("vector of %d elements does not match %d payload bytes", n, len(payload))
+	}
+	parts := make([]string, n)
+	for i := range parts {
+		off := hdrLen + i*width
+		parts[i] = format(payload[off : off+width])
+	}
+	return strings.Join(parts, " "), nil
+}
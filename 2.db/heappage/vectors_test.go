@@ -0,0 +1,76 @@
+package heappage
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// vectorDatum is an int2vector or oidvector of the given element bytes:
+// a one-dimensional array header with lower bound lbound, as
+// buildint2vector writes with lbound 0.
+func vectorDatum(ndim int32, elem Oid, lbound int32, n int, values []byte) []byte {
+	return varlena4(int32s(ndim, 0, int32(elem), int32(n), lbound), values)
+}
+
+func int16s(vs ...int16) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint16(b, uint16(v))
+	}
+	return b
+}
+
+func TestDecodeVector(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   Oid
+		datum []byte
+		want  string
+	}{
+		{"indkey", INT2VECTOROID, vectorDatum(1, INT2OID, 0, 3, int16s(1, 2, 4)), "1 2 4"},
+		{"one column", INT2VECTOROID, vectorDatum(1, INT2OID, 0, 1, int16s(3)), "3"},
+		{"expression column", INT2VECTOROID, vectorDatum(1, INT2OID, 0, 2, int16s(0, -1)), "0 -1"},
+		{"no elements", INT2VECTOROID, vectorDatum(1, INT2OID, 0, 0, nil), ""},
+		{"no dimensions", INT2VECTOROID, varlena4(int32s(0, 0, int32(INT2OID))), ""},
+		// the lower bound is not part of the text form
+		{"lower bound 1", INT2VECTOROID, vectorDatum(1, INT2OID, 1, 2, int16s(5, 6)), "5 6"},
+		{"proargtypes", OIDVECTOROID, vectorDatum(1, OIDOID, 0, 3, int32s(23, 25, 1043)), "23 25 1043"},
+		{"large oid", OIDVECTOROID, vectorDatum(1, OIDOID, 0, 2, int32s(-1, 16384)), "4294967295 16384"},
+		{"oids, no dimensions", OIDVECTOROID, varlena4(int32s(0, 0, int32(OIDOID))), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, next, err := mustType(t, tt.typ).Decode(tt.datum, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.want || next != len(tt.datum) {
+				t.Errorf("got %q, next %d; want %q, next %d", v, next, tt.want, len(tt.datum))
+			}
+		})
+	}
+}
+
+func TestDecodeVectorErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   Oid
+		datum []byte
+	}{
+		{"header truncated", INT2VECTOROID, varlena4(int32s(1, 0))},
+		{"two dimensions", INT2VECTOROID, varlena4(int32s(2, 0, int32(INT2OID), 1, 0, 1, 0), int16s(1))},
+		{"null bitmap", INT2VECTOROID, varlena4(int32s(1, 28, int32(INT2OID), 1, 0, 0), int16s(1))},
+		{"element type", INT2VECTOROID, vectorDatum(1, OIDOID, 0, 1, int32s(23))},
+		{"dimension header truncated", OIDVECTOROID, varlena4(int32s(1, 0, int32(OIDOID), 1))},
+		{"elements missing", OIDVECTOROID, vectorDatum(1, OIDOID, 0, 3, int32s(23, 25))},
+		{"elements left over", INT2VECTOROID, vectorDatum(1, INT2OID, 0, 1, int16s(1, 2))},
+		{"negative count", INT2VECTOROID, vectorDatum(1, INT2OID, 0, -1, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, _, err := mustType(t, tt.typ).Decode(tt.datum, 0, nil); err == nil {
+				t.Errorf("got %q, want an error", v)
+			}
+		})
+	}
+}
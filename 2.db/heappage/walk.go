@@ -0,0 +1,96 @@
+package heappage
+
+// Walking the pages of a relation file.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Logger gets the warnings about damaged input that do not stop a walk.
+// The command line tool points it at its own logger.
+var Logger = slog.Default()
+
+// WarnPartialPage logs a warning about the partial page pageNo, whose
+// len(buf) bytes are all the file has of it, and whether its header, if
+// complete, passes validation.
+func WarnPartialPage(pageNo int, buf []byte) {
+	n := len(buf)
+	attrs := []any{"page", pageNo, "bytes", n}
+	if n >= PageHeaderByteLen {
+		verdict := "valid"
+		hdr, err := ReadPageHeader(bytes.NewReader(buf))
+		switch {
+		case err != nil:
+			verdict = err.Error()
+		case PageIsNew(hdr):
+			verdict = "all zero"
+		default:
+			if err := ValidatePageHeader(hdr); err != nil {
+				verdict = err.Error()
+			}
+		}
+		attrs = append(attrs, "header", verdict)
+	}
+	Logger.Warn("partial page not scanned", attrs...)
+}
+
+// WalkPages calls fn with every blocksize-byte page of r in order, starting
+// at block 0, until r is exhausted or fn returns an error, which is returned
+// as is. An empty r makes no calls. A trailing partial page ends the walk
+// with a warning (WarnPartialPage) and is not passed to fn. All-zero pages
+// are passed on like any other. page is reused between calls, so fn must
+// copy what it keeps.
+func WalkPages(r io.ReaderAt, blocksize int, fn func(blockNo int, page []byte) error) error {
+	if blocksize <= 0 {
+		return fmt.Errorf("block size %d", blocksize)
+	}
+	page := make([]byte, blocksize)
+	for blockNo := 0; ; blockNo++ {
+		n, err := r.ReadAt(page, int64(blockNo)*int64(blocksize))
+		switch {
+		case n == blocksize:
+		case n == 0 && (err == nil || errors.Is(err, io.EOF)):
+			return nil
+		case err != nil && !errors.Is(err, io.EOF):
+			return fmt.Errorf("block %d: %w", blockNo, err)
+		default:
+			WarnPartialPage(blockNo, page[:n])
+			return nil
+		}
+		if err := fn(blockNo, page); err != nil {
+			return err
+		}
+	}
+}
+
+// Page is one loaded relation page.
+type Page struct {
+	No     int
+	Raw    []byte
+	Header *PageHeader
+	Items  []ItemID
+}
+
+// PageFunc is called by ScanRange for each page, with the *PageError that
+// prevented loading it if any. Returning a non-nil error stops the scan.
+type PageFunc func(p *Page, err error) error
+
+// ScanRange loads pages [from, to) in order and hands each to fn. The context
+// is checked between pages, so a cancelled scan returns ctx.Err() promptly.
+func ScanRange(ctx context.Context, r io.ReaderAt, from, to int, fn PageFunc) error {
+	for pageNo := from; pageNo < to; pageNo++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		raw, hdr, items, err := LoadPage(r, pageNo)
+		if err := fn(&Page{No: pageNo, Raw: raw, Header: hdr, Items: items}, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+// Test helpers for the command's tests; the tuple and page builders are in
+// package heaptest.
+
+import (
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// mustType returns the registered type of oid, failing the test if there is
+// none.
+func mustType(t *testing.T, oid heappage.Oid) heappage.TypeInfo {
+	t.Helper()
+	ti, ok := heappage.LookupType(oid)
+	if !ok {
+		t.Fatalf("type %d not registered", oid)
+	}
+	return ti
+}
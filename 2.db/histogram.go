@@ -0,0 +1,168 @@
+package main
+
+// Tuple-size histogram (-histogram): lp_len of every LP_NORMAL line pointer
+// in the relation, in power-of-two buckets, with percentiles and the number
+// of tuples big enough for the toaster to look at. Only line pointers are
+// read, no tuple is decoded.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// ToastTupleThreshold is TOAST_TUPLE_THRESHOLD for 8 KiB pages: rows wider
+// than this are compressed or moved out of line on insert.
+const ToastTupleThreshold = 2032
+
+// SizeHistogram counts tuples by exact lp_len (lp_len is 15 bits).
+type SizeHistogram struct {
+	counts [1 << 15]int
+	Total  int
+	Bytes  int
+}
+
+func (h *SizeHistogram) Add(lpLen int) {
+	h.counts[lpLen]++
+	h.Total++
+	h.Bytes += lpLen
+}
+
+// Percentile returns the smallest lp_len such that at least p percent of
+// the tuples are no larger (nearest-rank).
+func (h *SizeHistogram) Percentile(p float64) int {
+	if h.Total == 0 {
+		return 0
+	}
+	rank := max(int(math.Ceil(p/100*float64(h.Total))), 1)
+	seen := 0
+	for n, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return n
+		}
+	}
+	return len(h.counts) - 1
+}
+
+// OverToastThreshold counts tuples wider than ToastTupleThreshold.
+func (h *SizeHistogram) OverToastThreshold() int {
+	n := 0
+	for _, c := range h.counts[ToastTupleThreshold+1:] {
+		n += c
+	}
+	return n
+}
+
+// SizeBucket is the [Lo, Hi] lp_len range of one histogram bar.
+type SizeBucket struct {
+	Lo    int `json:"lo"`
+	Hi    int `json:"hi"`
+	Count int `json:"count"`
+}
+
+// Buckets groups the counts in power-of-two ranges, dropping empty ones.
+func (h *SizeHistogram) Buckets() []SizeBucket {
+	var out []SizeBucket
+	for lo := 0; lo < len(h.counts); lo = max(2*lo, 1) {
+		hi := min(max(2*lo, 1), len(h.counts)) - 1
+		b := SizeBucket{Lo: lo, Hi: hi}
+		for _, c := range h.counts[lo : hi+1] {
+			b.Count += c
+		}
+		if b.Count > 0 {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func collectTupleSizes(ctx context.Context, rel Relation, opts DumpOptions) (*SizeHistogram, error) {
+	nPages, err := relationPages(rel)
+	if err != nil {
+		return nil, err
+	}
+	h := &SizeHistogram{}
+	prog := newScanProgress(nPages, opts)
+	err = heappage.ScanRange(ctx, rel, 0, nPages, withProgress(prog, func(p *heappage.Page, err error) error {
+		if err != nil {
+			var pe *heappage.PageError
+			if !opts.SkipErrors || !errors.As(err, &pe) {
+				return err
+			}
+			logSkippedPage(pe)
+			return nil
+		}
+		for _, it := range p.Items {
+			if it.Flags == heappage.LP_NORMAL {
+				h.Add(int(it.LpLen))
+			}
+		}
+		return nil
+	}))
+	if prog != nil {
+		prog.Done()
+	}
+	return h, err
+}
+
+func tupleSizeHistogram(ctx context.Context, filePath string, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h, err := collectTupleSizes(ctx, f, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Format == "json" {
+		return writeHistogramJSON(os.Stdout, h)
+	}
+	return writeHistogramText(os.Stdout, h)
+}
+
+const histogramBarWidth = 40
+
+func writeHistogramText(w io.Writer, h *SizeHistogram) error {
+	buckets := h.Buckets()
+	peak := 0
+	for _, b := range buckets {
+		peak = max(peak, b.Count)
+	}
+	fmt.Fprintf(w, "%13s  %8s\n", "lp_len", "tuples")
+	for _, b := range buckets {
+		bar := strings.Repeat("#", (b.Count*histogramBarWidth+peak-1)/peak)
+		fmt.Fprintf(w, "%5d..%-5d  %8d  %s\n", b.Lo, b.Hi, b.Count, bar)
+	}
+	avg := 0
+	if h.Total > 0 {
+		avg = h.Bytes / h.Total
+	}
+	fmt.Fprintf(w, "tuples=%d bytes=%d avg=%d p50=%d p90=%d p99=%d\n",
+		h.Total, h.Bytes, avg, h.Percentile(50), h.Percentile(90), h.Percentile(99))
+	_, err := fmt.Fprintf(w, "over TOAST threshold (%d bytes): %d\n", ToastTupleThreshold, h.OverToastThreshold())
+	return err
+}
+
+func writeHistogramJSON(w io.Writer, h *SizeHistogram) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Tuples    int          `json:"tuples"`
+		Bytes     int          `json:"bytes"`
+		P50       int          `json:"p50"`
+		P90       int          `json:"p90"`
+		P99       int          `json:"p99"`
+		OverToast int          `json:"over_toast_threshold"`
+		Buckets   []SizeBucket `json:"buckets"`
+	}{h.Total, h.Bytes, h.Percentile(50), h.Percentile(90), h.Percentile(99), h.OverToastThreshold(), h.Buckets()})
+}
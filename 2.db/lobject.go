@@ -0,0 +1,323 @@
+package main
+
+// Large object recovery (-lo-export): pg_largeobject stores each object as
+// rows (loid oid, pageno int4, data bytea) of at most LOBLKSIZE bytes. The
+// heap file is scanned for the live rows of one loid, which are put back
+// together in pageno order. -list-lobs is the inventory before that: every
+// large object with its owner and ACL from pg_largeobject_metadata, and its
+// chunks and size from pg_largeobject.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+const LoBlkSize = heappage.PageSize / 4 // LOBLKSIZE
+
+var largeObjectSchema = []heappage.ColumnDef{
+	heappage.Column("loid", heappage.OIDOID),
+	heappage.Column("pageno", heappage.INT4OID),
+	heappage.Column("data", heappage.BYTEAOID),
+}
+
+// pg_largeobject_metadata (9.0 and later) has a row for every large object,
+// an empty one too. Before PG12 the loid is the row's WITH OIDS oid and the
+// first column is lomowner.
+var largeObjectMetadataSchema = []heappage.ColumnDef{
+	heappage.Column("oid", heappage.OIDOID),
+	heappage.Column("lomowner", heappage.OIDOID),
+	heappage.Column("lomacl", 1034), // aclitem[]
+}
+
+// LargeObjectMetadataFilenode is pg_largeobject_metadata's relfilenode in a
+// fresh cluster; -list-lobs looks for it next to pg_largeobject.
+const LargeObjectMetadataFilenode = 2995
+
+// scanLiveTuples hands fn every live-looking NORMAL tuple of rel, honoring
+// opts.SkipErrors and showing progress.
+func scanLiveTuples(ctx context.Context, rel Relation, opts DumpOptions, fn func(p *heappage.Page, it heappage.ItemID, tuple []byte, rh *heappage.RowHeader) error) error {
+	nPages, err := relationPages(rel)
+	if err != nil {
+		return err
+	}
+	prog := newScanProgress(nPages, opts)
+	err = heappage.ScanRange(ctx, rel, 0, nPages, withProgress(prog, func(p *heappage.Page, err error) error {
+		if err != nil {
+			var pe *heappage.PageError
+			if !opts.SkipErrors || !errors.As(err, &pe) {
+				return err
+			}
+			logSkippedPage(pe)
+			return nil
+		}
+		for _, it := range p.Items {
+			if it.Flags != heappage.LP_NORMAL {
+				continue
+			}
+			start, end := int(it.LpOff), int(it.LpOff)+int(it.LpLen)
+			if end > len(p.Raw) {
+				continue
+			}
+			tuple := p.Raw[start:end]
+			rh, err := heappage.ParseRowHeader(tuple)
+			if err != nil || !rh.LooksLive() {
+				continue
+			}
+			if err := fn(p, it, tuple, rh); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	if prog != nil {
+		prog.Done()
+	}
+	return err
+}
+
+// collectLargeObject returns the data chunks of loid keyed by pageno. Only
+// tuples that look live are used, so old versions left by lo_write and
+// friends don't shadow the current data.
+func collectLargeObject(ctx context.Context, rel Relation, loid heappage.Oid, opts DumpOptions) (map[int32][]byte, error) {
+	chunks := map[int32][]byte{}
+	err := scanLiveTuples(ctx, rel, opts, func(p *heappage.Page, it heappage.ItemID, tuple []byte, rh *heappage.RowHeader) error {
+		// loid and pageno first, so other objects' data is not decoded
+		head, err := heappage.DecodeRowAttrs(tuple, rh, largeObjectSchema, []int{1, 2}, decodeOptions)
+		if err != nil || head[0] != loid {
+			return nil
+		}
+		pageno := head[1].(int32)
+		vals, err := heappage.DecodeRow(tuple, rh, largeObjectSchema, decodeOptions)
+		if err != nil {
+			return fmt.Errorf("page %d lp %d: loid %d pageno %d: %w", p.No, it.Index, loid, pageno, err)
+		}
+		if _, dup := chunks[pageno]; dup {
+			logger.Warn("large object chunk appears more than once", "loid", loid, "pageno", pageno,
+				"using_page", p.No, "using_lp", it.Index)
+		}
+		data, _ := vals[2].([]byte)
+		chunks[pageno] = data
+		return nil
+	})
+	return chunks, err
+}
+
+// writeLargeObject writes the chunks in pageno order. Like lo_read, a
+// missing pageno or a short chunk before the last one reads as zeros; each
+// such hole is reported on stderr.
+func writeLargeObject(w io.Writer, loid heappage.Oid, chunks map[int32][]byte) (int64, error) {
+	pagenos := make([]int32, 0, len(chunks))
+	for n := range chunks {
+		pagenos = append(pagenos, n)
+	}
+	sort.Slice(pagenos, func(i, j int) bool { return pagenos[i] < pagenos[j] })
+
+	var written int64
+	zeros := make([]byte, LoBlkSize)
+	for i, n := range pagenos {
+		want := int64(n) * LoBlkSize
+		if written < want {
+			logger.Warn("large object gap filled with zeros", "loid", loid, "pageno", n, "bytes", want-written)
+		}
+		for written < want {
+			k, err := w.Write(zeros[:min(int64(len(zeros)), want-written)])
+			written += int64(k)
+			if err != nil {
+				return written, err
+			}
+		}
+		data := chunks[n]
+		if len(data) > LoBlkSize {
+			return written, fmt.Errorf("loid %d pageno %d: %d-byte chunk exceeds LOBLKSIZE %d", loid, n, len(data), LoBlkSize)
+		}
+		if len(data) < LoBlkSize && i < len(pagenos)-1 {
+			logger.Warn("large object short chunk", "loid", loid, "pageno", n, "bytes", len(data))
+		}
+		k, err := w.Write(data)
+		written += int64(k)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// exportLargeObject reassembles loid from a pg_largeobject heap file into
+// outPath ("-" for stdout).
+func exportLargeObject(ctx context.Context, filePath string, loid heappage.Oid, outPath string, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chunks, err := collectLargeObject(ctx, f, loid, opts)
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("no live rows for large object %d in %s", loid, filePath)
+	}
+
+	var w io.Writer = os.Stdout
+	if outPath != "-" {
+		out, err := os.Create(outPath)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		w = out
+	}
+	n, err := writeLargeObject(w, loid, chunks)
+	if err != nil {
+		return err
+	}
+	logger.Info("large object exported", "loid", loid, "chunks", len(chunks), "bytes", n)
+	return nil
+}
+
+type LargeObjectInfo struct {
+	Loid       heappage.Oid `json:"loid"`
+	Owner      string       `json:"owner,omitempty"` // role name from -oid-names, else the oid
+	ACL        string       `json:"acl,omitempty"`
+	Chunks     int          `json:"chunks"`
+	Size       int64        `json:"size"`                  // what lo_read returns: up to the end of the last chunk
+	NoMetadata bool         `json:"no_metadata,omitempty"` // data rows without a metadata row
+}
+
+// collectLargeObjectSizes counts the live chunks of every loid in a
+// pg_largeobject file.
+func collectLargeObjectSizes(ctx context.Context, rel Relation, opts DumpOptions) (map[heappage.Oid]*LargeObjectInfo, error) {
+	los := map[heappage.Oid]*LargeObjectInfo{}
+	err := scanLiveTuples(ctx, rel, opts, func(p *heappage.Page, it heappage.ItemID, tuple []byte, rh *heappage.RowHeader) error {
+		vals, err := heappage.DecodeRow(tuple, rh, largeObjectSchema, decodeOptions)
+		if err != nil {
+			return fmt.Errorf("page %d lp %d: %w", p.No, it.Index, err)
+		}
+		loid, _ := vals[0].(heappage.Oid)
+		pageno, _ := vals[1].(int32)
+		data, _ := vals[2].([]byte)
+		lo := los[loid]
+		if lo == nil {
+			lo = &LargeObjectInfo{Loid: loid}
+			los[loid] = lo
+		}
+		lo.Chunks++
+		lo.Size = max(lo.Size, int64(pageno)*LoBlkSize+int64(len(data)))
+		return nil
+	})
+	return los, err
+}
+
+// collectLargeObjectMetadata reads owner and ACL of every large object from
+// a pg_largeobject_metadata file, in either layout.
+func collectLargeObjectMetadata(ctx context.Context, rel Relation, opts DumpOptions) (map[heappage.Oid]*LargeObjectInfo, error) {
+	los := map[heappage.Oid]*LargeObjectInfo{}
+	err := scanLiveTuples(ctx, rel, opts, func(p *heappage.Page, it heappage.ItemID, tuple []byte, rh *heappage.RowHeader) error {
+		var lo LargeObjectInfo
+		var owner, acl any
+		if oid, ok := rh.OldOid(tuple); ok {
+			vals, err := heappage.DecodeRow(tuple, rh, largeObjectMetadataSchema[1:], decodeOptions)
+			if err != nil {
+				return fmt.Errorf("page %d lp %d: %w", p.No, it.Index, err)
+			}
+			lo.Loid, owner, acl = heappage.Oid(oid), vals[0], vals[1]
+		} else {
+			vals, err := heappage.DecodeRow(tuple, rh, largeObjectMetadataSchema, decodeOptions)
+			if err != nil {
+				return fmt.Errorf("page %d lp %d: %w", p.No, it.Index, err)
+			}
+			lo.Loid, _ = vals[0].(heappage.Oid)
+			owner, acl = vals[1], vals[2]
+		}
+		if o, ok := owner.(heappage.Oid); ok {
+			lo.Owner = heappage.RoleName(o)
+		}
+		if a, ok := acl.(string); ok {
+			lo.ACL = a
+		}
+		los[lo.Loid] = &lo
+		return nil
+	})
+	return los, err
+}
+
+// listLargeObjects writes the large objects of a pg_largeobject file to w.
+// The metadata comes from metaPath, or from LargeObjectMetadataFilenode in
+// the same directory; without it (a pre-9.0 cluster, or the file is lost)
+// the list is the distinct loids that have data, with no owner or ACL.
+func listLargeObjects(ctx context.Context, w io.Writer, filePath, metaPath string, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sizes, err := collectLargeObjectSizes(ctx, f, opts)
+	if err != nil {
+		return err
+	}
+
+	if metaPath == "" && !strings.Contains(filePath, "://") {
+		guess := filepath.Join(filepath.Dir(filePath), fmt.Sprint(LargeObjectMetadataFilenode))
+		if _, err := os.Stat(guess); err == nil {
+			metaPath = guess
+		}
+	}
+	var meta map[heappage.Oid]*LargeObjectInfo
+	if metaPath != "" {
+		mf, err := openRelation(metaPath)
+		if err != nil {
+			return err
+		}
+		defer mf.Close()
+		if meta, err = collectLargeObjectMetadata(ctx, mf, opts); err != nil {
+			return fmt.Errorf("%s: %w", metaPath, err)
+		}
+	} else {
+		logger.Info("no pg_largeobject_metadata; listing the loids found in pg_largeobject", "file", filePath)
+	}
+
+	los := make([]LargeObjectInfo, 0, max(len(meta), len(sizes)))
+	for loid, m := range meta {
+		if s := sizes[loid]; s != nil {
+			m.Chunks, m.Size = s.Chunks, s.Size
+		}
+		los = append(los, *m)
+	}
+	for loid, s := range sizes {
+		if _, ok := meta[loid]; !ok {
+			s.NoMetadata = meta != nil
+			los = append(los, *s)
+		}
+	}
+	sort.Slice(los, func(i, j int) bool { return los[i].Loid < los[j].Loid })
+
+	if opts.Format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(los)
+	}
+	return writeLargeObjectList(w, los)
+}
+
+func writeLargeObjectList(w io.Writer, los []LargeObjectInfo) error {
+	fmt.Fprintf(w, "%10s  %-16s  %6s  %12s  %s\n", "loid", "owner", "chunks", "size", "acl")
+	for _, lo := range los {
+		owner := lo.Owner
+		if lo.NoMetadata {
+			owner = "(no metadata)"
+		}
+		fmt.Fprintf(w, "%10d  %-16s  %6d  %12d  %s\n", lo.Loid, owner, lo.Chunks, lo.Size, lo.ACL)
+	}
+	_, err := fmt.Fprintf(w, "%d large objects\n", len(los))
+	return err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+	"github.com/ptflp/techinterview/2.db/heappage/heaptest"
+)
+
+// loChunk is a pg_largeobject row.
+func loChunk(t *testing.T, loid heappage.Oid, pageno int32, data []byte) []byte {
+	return heaptest.Tuple(t, largeObjectSchema, []any{uint32(loid), pageno, heaptest.Varlena4(data)})
+}
+
+// deleted marks a tuple deleted by committed xid 200, as an old version
+// left behind by lo_write is.
+func deleted(tuple []byte) []byte {
+	binary.LittleEndian.PutUint32(tuple[4:], 200)
+	mask := binary.LittleEndian.Uint16(tuple[20:])
+	binary.LittleEndian.PutUint16(tuple[20:], mask&^heappage.HEAP_XMAX_INVALID|heappage.HEAP_XMAX_COMMITTED)
+	return tuple
+}
+
+// writeRelationFile writes pages to a file in a temporary directory.
+func writeRelationFile(t *testing.T, name string, pages ...[]byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, concat(pages...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// The chunks of a large object sit in pg_largeobject in whatever order
+// they were written, next to other objects and dead versions of
+// themselves. -lo-export puts the live ones back in pageno order and fills
+// a missing pageno with zeros, as lo_read does.
+func TestExportLargeObject(t *testing.T) {
+	chunk := func(b byte, n int) []byte { return bytes.Repeat([]byte{b}, n) }
+	const loid = 16401
+	path := writeRelationFile(t, "2613",
+		heaptest.Page(t, 0,
+			loChunk(t, loid, 3, chunk('d', 100)),
+			loChunk(t, 16500, 0, chunk('x', LoBlkSize)),
+			deleted(loChunk(t, loid, 1, chunk('o', LoBlkSize))),
+		),
+		heaptest.Page(t, 1,
+			loChunk(t, loid, 1, chunk('b', LoBlkSize)),
+			loChunk(t, loid, 0, chunk('a', LoBlkSize)),
+		),
+	)
+	logs := captureLogger(t)
+	out := filepath.Join(t.TempDir(), "blob.bin")
+	if err := exportLargeObject(context.Background(), path, loid, out, DumpOptions{Quiet: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := concat(chunk('a', LoBlkSize), chunk('b', LoBlkSize), make([]byte, LoBlkSize), chunk('d', 100))
+	if !bytes.Equal(got, want) {
+		t.Errorf("exported %d bytes, want %d", len(got), len(want))
+		for i := range min(len(got), len(want)) {
+			if got[i] != want[i] {
+				t.Errorf("first difference at byte %d: %q, want %q", i, got[i], want[i])
+				break
+			}
+		}
+	}
+	for _, want := range []string{
+		`msg="large object gap filled with zeros" loid=16401 pageno=3 bytes=2048`,
+		`msg="large object exported" loid=16401 chunks=3 bytes=6244`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, logs)
+		}
+	}
+	if strings.Contains(logs.String(), "more than once") {
+		t.Errorf("the deleted chunk was used:\n%s", logs)
+	}
+
+	err = exportLargeObject(context.Background(), path, 16402, out, DumpOptions{Quiet: true})
+	if err == nil || !strings.Contains(err.Error(), "no live rows for large object 16402") {
+		t.Errorf("missing loid: %v", err)
+	}
+}
+
+func TestWriteLargeObjectChunkTooLong(t *testing.T) {
+	captureLogger(t)
+	var out bytes.Buffer
+	_, err := writeLargeObject(&out, 1, map[int32][]byte{0: make([]byte, LoBlkSize+1)})
+	if err == nil || !strings.Contains(err.Error(), "exceeds LOBLKSIZE") {
+		t.Errorf("got %v", err)
+	}
+}
+
+// aclItems is an aclitem[] datum in the PG16 layout; each item is grantee,
+// grantor and privilege bits.
+func aclItems(items ...[3]uint32) []byte {
+	data := heaptest.Int32s(1, 0, int32(heappage.ACLITEMOID), int32(len(items)), 1)
+	for _, it := range items {
+		data = append(data, heaptest.Int32s(int32(it[0]), int32(it[1]))...)
+		data = binary.LittleEndian.AppendUint64(data, uint64(it[2]))
+	}
+	return heaptest.Varlena4(data)
+}
+
+// withOldOid moves a tuple's data 8 bytes on to make room for a WITH OIDS
+// oid before t_hoff, as pre-12 pg_largeobject_metadata rows have.
+func withOldOid(tuple []byte, oid uint32) []byte {
+	hoff := int(tuple[22]) + 8
+	out := append(append(append([]byte(nil), tuple[:hoff-8]...), make([]byte, 8)...), tuple[hoff-8:]...)
+	binary.LittleEndian.PutUint32(out[hoff-4:], oid)
+	mask := binary.LittleEndian.Uint16(out[20:])
+	binary.LittleEndian.PutUint16(out[20:], mask|heappage.HEAP_HASOID_OLD)
+	out[22] = byte(hoff)
+	return out
+}
+
+// -list-lobs joins pg_largeobject_metadata, found next to pg_largeobject
+// or given with -lo-metadata, with the chunks in pg_largeobject: an object
+// can have metadata and no data (it is empty), or, in a damaged cluster,
+// data and no metadata.
+func TestListLargeObjects(t *testing.T) {
+	heappage.RegisterOidName("pg_authid", 16390, "alice")
+	data := heaptest.Page(t, 0,
+		loChunk(t, 16401, 2, []byte("0123456789")),
+		loChunk(t, 16401, 0, make([]byte, LoBlkSize)),
+		loChunk(t, 16500, 0, []byte("hello")),
+		deleted(loChunk(t, 16401, 3, []byte("old"))),
+	)
+	meta := heaptest.Page(t, 0,
+		heaptest.Tuple(t, largeObjectMetadataSchema, []any{uint32(16401), uint32(10), aclItems([3]uint32{10, 10, 0x6}, [3]uint32{0, 10, 0x2})}),
+		heaptest.Tuple(t, largeObjectMetadataSchema, []any{uint32(16402), uint32(16390), nil}),
+	)
+	owner := largeObjectMetadataSchema[1:]
+	meta11 := heaptest.Page(t, 0,
+		withOldOid(heaptest.Tuple(t, owner, []any{uint32(10), nil}), 16401),
+		withOldOid(heaptest.Tuple(t, owner, []any{uint32(16390), nil}), 16402),
+	)
+
+	dir := t.TempDir()
+	for name, page := range map[string][]byte{"2613": data, "2995": meta, "meta11": meta11} {
+		if err := os.WriteFile(filepath.Join(dir, name), page, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nometa := writeRelationFile(t, "2613", data)
+
+	const header = "      loid  owner             chunks          size  acl\n"
+	tests := []struct {
+		name, file, meta, want string
+	}{
+		{"metadata next to the file", filepath.Join(dir, "2613"), "", header +
+			"     16401  10                     2          4106  {10=rw/10,=r/10}\n" +
+			"     16402  alice                  0             0  \n" +
+			"     16500  (no metadata)          1             5  \n" +
+			"3 large objects\n"},
+		{"pre-12 metadata", filepath.Join(dir, "2613"), filepath.Join(dir, "meta11"), header +
+			"     16401  10                     2          4106  \n" +
+			"     16402  alice                  0             0  \n" +
+			"     16500  (no metadata)          1             5  \n" +
+			"3 large objects\n"},
+		{"no metadata", nometa, "", header +
+			"     16401                         2          4106  \n" +
+			"     16500                         1             5  \n" +
+			"2 large objects\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captureLogger(t)
+			var out bytes.Buffer
+			if err := listLargeObjects(context.Background(), &out, tt.file, tt.meta, DumpOptions{Quiet: true}); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := listLargeObjects(context.Background(), &out, filepath.Join(dir, "2613"), "", DumpOptions{Quiet: true, Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+    "loid": 16402,
+    "owner": "alice",
+    "chunks": 0,
+    "size": 0
+  },`
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("json lacks %s:\n%s", want, out.String())
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+// Diagnostics go to stderr through log/slog, leveled by -log-level, so that
+// stdout carries only the dump itself.
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+var logLevel = new(slog.LevelVar) // info unless -log-level says otherwise
+
+var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+	Level: logLevel,
+	ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && a.Key == slog.TimeKey {
+			return slog.Attr{} // one-shot CLI runs; timestamps are noise
+		}
+		return a
+	},
+}))
+
+// heappage warns about partial pages through the same handler.
+func init() { heappage.Logger = logger }
+
+// SetLogLevel sets the level from "debug", "info", "warn" or "error".
+func SetLogLevel(s string) error {
+	return logLevel.UnmarshalText([]byte(s))
+}
+
+// logSkippedPage reports a page left out by -skip-errors.
+func logSkippedPage(pe *heappage.PageError) {
+	logger.Warn("page skipped", "page", pe.PageNo, "stage", pe.Stage, "err", pe.Err)
+}
@@ -7,371 +7,883 @@ package main
 //
 // NOTE: This is a learning tool; it does not handle TOAST pointers,
 // compressed varlena, or all visibility/infomask combinations.
+//
+// The page and tuple decoding is package heappage; this package is the
+// command line on top of it.
+//
+// The tool never writes to a cluster: relation files are opened read-only
+// through openRelation, and only -lo-export creates a file, the one it is
+// given. A mode that modifies relation files (fixing checksums, scrubbing
+// tuples) would need a guard against a running postmaster first.
 
 import (
-	"bytes"
-	"encoding/binary"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"os"
-)
+	"os/signal"
+	"runtime/debug"
+	"time"
 
-const (
-	PageSize          = 8192
-	PageHeaderByteLen = 24
-	ItemIDByteLen     = 4
+	"github.com/ptflp/techinterview/2.db/catalog"
+	"github.com/ptflp/techinterview/2.db/heappage"
 )
 
-// -------- Page header (bufpage.h) --------
-
-type PageHeader struct {
-	XLogID            uint32 // pd_lsn.xlogid
-	XRecOff           uint32 // pd_lsn.xrecoff
-	PdChecksum        uint16
-	PdFlags           uint16
-	PdLower           uint16 // start of line pointers area end
-	PdUpper           uint16 // start of tuples (from the end)
-	PdSpecial         uint16 // start of special space (heap: == BLCKSZ)
-	PdPagesizeVersion uint16
-	PdPruneXID        uint32
-}
-
-func readPageHeader(r io.Reader) (*PageHeader, error) {
-	h := &PageHeader{}
-	if err := binary.Read(r, binary.LittleEndian, h); err != nil {
-		return nil, err
-	}
-	return h, nil
+// Decode two attributes of the demo table:
+// 1) id BIGINT (attlen=8, attalign='d')
+// 2) name TEXT  (varlena, attalign='i')
+type DemoRow struct {
+	ID   int64
+	Name string
 }
 
-// -------- ItemIdData (itemid.h) --------
-//
-// On-disk: two uint16. 2 flag bits are split across them:
-//  - high bit of lp_off (bit15) is low flag bit
-//  - low bit of lp_len (bit0) is high flag bit
-//
-// Decoding to fields:
-//  off15  = lp_off & 0x7FFF
-//  len15  = lp_len >> 1
-//  flags2 = ((lp_off>>15)&0x01) | ((lp_len<<1)&0x02)
-
-type rawItemID struct {
-	LpOff uint16
-	LpLen uint16
-}
+// demoColumns is the demo table's schema.
+var demoColumns = []heappage.ColumnDef{heappage.Column("id", heappage.INT8OID), heappage.Column("name", heappage.TEXTOID)}
 
-type ItemID struct {
-	LpOff uint16 // 15-bit offset from page start
-	LpLen uint16 // 15-bit length
-	Flags byte   // 2-bit flags
-	Index int    // index within line pointer array
+// decodeDemoRow decodes the demo table through DecodeRow, so the NULL
+// bitmap (after the fixed header, a set bit meaning NOT NULL) and the bounds
+// checks are the ones every schema gets. A NULL decodes as the zero value.
+func decodeDemoRow(buf []byte, rh *heappage.RowHeader) (DemoRow, error) {
+	var out DemoRow
+	vals, err := heappage.DecodeRow(buf, rh, demoColumns, decodeOptions)
+	if err != nil {
+		return out, err
+	}
+	out.ID, _ = vals[0].(int64)
+	out.Name, _ = vals[1].(string) // assuming no compression/TOAST
+	return out, nil
 }
 
-const (
-	LP_UNUSED   = 0
-	LP_NORMAL   = 1
-	LP_REDIRECT = 2
-	LP_DEAD     = 3
-)
-
-func readItemIDs(r io.Reader, header *PageHeader) ([]ItemID, error) {
-	n := int(header.PdLower-PageHeaderByteLen) / ItemIDByteLen
-	if n < 0 || n > (PageSize-PageHeaderByteLen)/ItemIDByteLen {
-		return nil, fmt.Errorf("bad PdLower=%d; computed itemId count=%d", header.PdLower, n)
+// checkPageBounds recomputes pd_lower from the line pointer count and the
+// lowest pd_upper the tuples allow, and reports stored values that
+// disagree. Unlike ValidatePageHeader this needs the line pointers, and a
+// page that fails it can still be read.
+func checkPageBounds(hdr *heappage.PageHeader, items []heappage.ItemID) []string {
+	var probs []string
+	if want := heappage.PageHeaderByteLen + len(items)*heappage.ItemIDByteLen; int(hdr.PdLower) != want {
+		probs = append(probs, fmt.Sprintf("pd_lower=%d, but %d line pointers end at %d",
+			hdr.PdLower, len(items), want))
 	}
-	out := make([]ItemID, 0, n)
-	for i := 0; i < n; i++ {
-		var raw rawItemID
-		if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
-			return nil, fmt.Errorf("read ItemIdData[%d]: %w", i, err)
+	// pruning leaves pd_upper at or below the lowest tuple; above it, the
+	// tuple overlaps free space that the next insert will overwrite
+	lowest, lowestLP := heappage.PageSize, heappage.OffsetNumber(0)
+	for _, it := range items {
+		if it.Flags == heappage.LP_UNUSED || it.Flags == heappage.LP_REDIRECT || it.LpLen == 0 {
+			continue
 		}
-		flags := byte(((raw.LpOff >> 15) & 0x01) | ((raw.LpLen << 1) & 0x02))
-		item := ItemID{
-			LpOff: raw.LpOff & 0x7FFF,
-			LpLen: raw.LpLen >> 1,
-			Flags: flags,
-			Index: i + 1, // 1-based, like offset numbers
+		if int(it.LpOff) < lowest {
+			lowest, lowestLP = int(it.LpOff), it.Index
+		}
+		if end := int(it.LpOff) + int(it.LpLen); end > int(hdr.PdSpecial) {
+			probs = append(probs, fmt.Sprintf("lp %d ends at %d, past pd_special=%d", it.Index, end, hdr.PdSpecial))
 		}
-		out = append(out, item)
 	}
-	return out, nil
-}
-
-// -------- Heap tuple header (htup_details.h) --------
-//
-// Minimal subset; sizes match common PG builds (little-endian).
-// This maps to: t_xmin,t_xmax,t_cid/t_xvac, t_ctid(blockhi,blocklo,offset),
-// t_infomask2, t_infomask, t_hoff.
-
-type RowHeader struct {
-	Xmin uint32
-	Xmax uint32
-	CId  uint32
-	// ItemPointerData (ctid)
-	CTIDBlockHi uint16
-	CTIDBlockLo uint16
-	CTIDOffset  uint16
-	InfoMask2   uint16 // low 11 bits = natts
-	InfoMask    uint16
-	Hoff        byte
+	if lowestLP != 0 && lowest < int(hdr.PdUpper) {
+		probs = append(probs, fmt.Sprintf("pd_upper=%d, but lp %d starts at %d", hdr.PdUpper, lowestLP, lowest))
+	}
+	return probs
 }
 
-func (rh *RowHeader) Natts() int { return int(rh.InfoMask2 & 0x07FF) }
-
-// t_infomask flags we care about (subset)
-const (
-	HEAP_HASNULL        = 0x0001
-	HEAP_HASVARWIDTH    = 0x0002
-	HEAP_HASEXTERNAL    = 0x0008 // TOAST pointer
-	HEAP_MOVED_OFF      = 0x0010
-	HEAP_MOVED_IN       = 0x0020
-	HEAP_XMAX_INVALID   = 0x0100
-	HEAP_XMAX_COMMITTED = 0x0200
-)
-
-// Align helpers per attalign: 'c'=1, 's'=2, 'i'=4, 'd'=8
-func align(off int, align byte) int {
-	var a int
-	switch align {
-	case 'c':
-		a = 1
-	case 's':
-		a = 2
-	case 'i':
-		a = 4
-	case 'd':
-		a = 8
-	default:
-		a = 1
+// redirectTarget is the offset number a REDIRECT line pointer forwards to:
+// lp_off holds it instead of a byte offset.
+func redirectTarget(it heappage.ItemID) heappage.OffsetNumber { return heappage.OffsetNumber(it.LpOff) }
+
+// checkRedirects reports dangling REDIRECT line pointers. Pruning points a
+// REDIRECT at the first live member of a HOT chain, a NORMAL heap-only
+// tuple on the same page; an index entry leads to the REDIRECT, so one
+// that points anywhere else loses the row for index scans.
+func checkRedirects(page []byte, items []heappage.ItemID) []string {
+	var probs []string
+	for _, it := range items {
+		if it.Flags != heappage.LP_REDIRECT {
+			continue
+		}
+		to := redirectTarget(it)
+		if to < 1 || int(to) > len(items) {
+			probs = append(probs, fmt.Sprintf("lp %d redirects to lp %d, out of range 1..%d", it.Index, to, len(items)))
+			continue
+		}
+		target := items[to-1]
+		if target.Flags != heappage.LP_NORMAL {
+			probs = append(probs, fmt.Sprintf("lp %d redirects to lp %d, which is %s, not NORMAL",
+				it.Index, to, lpFlagNames[target.Flags&0x03]))
+			continue
+		}
+		start, end := int(target.LpOff), int(target.LpOff)+int(target.LpLen)
+		if start >= end || end > len(page) {
+			continue // the tuple's own bounds problem is reported with it
+		}
+		if rh, err := heappage.ParseRowHeader(page[start:end]); err == nil && rh.InfoMask2&heappage.HEAP_ONLY_TUPLE == 0 {
+			probs = append(probs, fmt.Sprintf("lp %d redirects to lp %d, which is not a heap-only tuple", it.Index, to))
+		}
 	}
-	m := (off + (a - 1)) & ^(a - 1)
-	return m
+	return probs
 }
 
-// Varlenas (postgres.h): detect 1-byte vs 4-byte header on little-endian.
-// Returns payload slice and new offset.
-// This simplified reader supports:
-// - 1-byte short varlena (xxxxxxx1) up to 126 bytes
-// - 4-byte uncompressed (.... ..00) (length includes the 4 bytes)
-// Does NOT support compressed or TOAST pointer (you'll get an error).
-func readVarlenaLE(buf []byte, off int) (payload []byte, next int, err error) {
-	if off >= len(buf) {
-		return nil, off, io.ErrUnexpectedEOF
-	}
-	first := buf[off]
-	if first&0x01 == 1 {
-		// short varlena: length in upper 7 bits + includes itself
-		l := int(first >> 1) // length including the 1-byte header
-		if l < 1 {
-			return nil, off, errors.New("short varlena length < 1")
-		}
-		total := l
-		if off+total > len(buf) {
-			return nil, off, io.ErrUnexpectedEOF
-		}
-		return buf[off+1 : off+total], off + total, nil
-	}
-	// Check 4-byte header (xxxxxx00 or xxxxxx10)
-	if off+4 > len(buf) {
-		return nil, off, io.ErrUnexpectedEOF
-	}
-	h := binary.LittleEndian.Uint32(buf[off : off+4])
-	// lowest two bits are flags; if ==00 -> uncompressed aligned
-	switch h & 0x03 {
-	case 0x00: // uncompressed 4-byte len
-		length := int(h >> 2) // length including the 4 bytes
-		if length < 4 {
-			return nil, off, errors.New("invalid long varlena length")
-		}
-		total := length
-		if off+total > len(buf) {
-			return nil, off, io.ErrUnexpectedEOF
-		}
-		return buf[off+4 : off+total], off + total, nil
-	case 0x10, 0x02: // compressed (xxxxxx10) -> not handled here
-		return nil, off, errors.New("compressed varlena not supported")
-	case 0x01: // TOAST pointer (00000001) -> not supported
-		return nil, off, errors.New("TOAST pointer varlena not supported")
-	default:
-		return nil, off, errors.New("unknown varlena header pattern")
+// recoverPage turns a panic while handling page pageNo into a "decode"
+// PageError in *err, so that input no bounds check anticipated costs one
+// page and not the whole run. Use as defer recoverPage(pageNo, &err).
+func recoverPage(pageNo int, err *error) {
+	r := recover()
+	if r == nil {
+		return
 	}
+	logger.Error("recovered from panic", "page", pageNo, "panic", r)
+	logger.Debug("panic stack", "page", pageNo, "stack", string(debug.Stack()))
+	*err = &heappage.PageError{PageNo: pageNo, Stage: "decode", Err: fmt.Errorf("panic: %v", r)}
 }
 
-// Decode two attributes of the demo table:
-// 1) id BIGINT (attlen=8, attalign='d')
-// 2) name TEXT  (varlena, attalign='i')
-type DemoRow struct {
-	ID   int64
-	Name string
+// decodeOptions are the decode settings of this run (-tz, -time-precision,
+// -float-datetimes, -legacy-aclitem, -pretty-json, -pretty-node-trees,
+// -encoding, -binary-encoding); everything the CLI decodes or formats uses
+// them.
+var decodeOptions = heappage.DefaultOptions()
+
+// DumpOptions controls what the page dumps show.
+type DumpOptions struct {
+	Demo         bool // decode demo columns (id BIGINT, name TEXT)
+	WithOids     bool // report the oid of pre-PG12 WITH OIDS tuples
+	SkipErrors   bool // in range scans, report bad pages and continue
+	Format       string
+	LiveOnly     bool                 // omit non-NORMAL line pointers
+	OnlyFlags    uint8                // if set, write only line pointers whose 1<<flags bit is in it
+	RawLSN       bool                 // text: print pd_lsn as raw decimals
+	Color        bool                 // text: ANSI colors
+	Anomalies    *Anomalies           // if set (-strict), collects structural problems
+	Schema       []heappage.ColumnDef // decode columns with this schema instead of the demo one
+	Attrs        []int                // with Schema: only these 1-based attributes
+	Quiet        bool                 // no progress output on stderr
+	Table        string               // target table name for -format sql
+	Explain      bool                 // text: annotate structures for learners
+	Expanded     bool                 // text: one "column | value" line per attribute, like psql's \x
+	SinglePage   bool                 // the input file is one raw page
+	TraceOffsets bool                 // with Schema: record each attribute's offset, padding and length
+	SinceLSN     uint64               // whole-relation scans: skip pages with pd_lsn <= this (0: off)
+	IncludeDead  bool                 // also decode LP_DEAD line pointers that still have storage
+	CheckPadding bool                 // with Schema: report nonzero alignment padding
+	MaxPages     int                  // whole-relation scans: stop after this many pages (0: no cap)
+	Head, Tail   int                  // whole-relation scans: only the first/last this many pages (0: all)
+	EpochBase    bool                 // text: show timestamps with their raw stored value
+	Locale       string               // text: show numeric and money with this locale's separators (heappage.LookupLocale)
+	BlockBase    uint32               // block number of the file's first page, for checksums (segmentBlockBase)
 }
 
-func decodeDemoRow(buf []byte, rh *RowHeader) (DemoRow, error) {
-	var out DemoRow
-
-	// Start of DATA area
-	if int(rh.Hoff) > len(buf) {
-		return out, io.ErrUnexpectedEOF
+// wantItem reports whether a line pointer with these flags is written
+// (-live-only, -only-flags).
+func (o DumpOptions) wantItem(flags byte) bool {
+	if o.LiveOnly && flags != heappage.LP_NORMAL {
+		return false
 	}
-	off := int(rh.Hoff)
+	return o.OnlyFlags == 0 || o.OnlyFlags&(1<<(flags&0x03)) != 0
+}
 
-	// NULL bitmap if present
-	hasNulls := (rh.InfoMask & HEAP_HASNULL) != 0
-	var nullmap []byte
-	if hasNulls {
-		// ceil(natts/8)
-		nb := (rh.Natts() + 7) / 8
-		if off+nb > len(buf) {
-			return out, io.ErrUnexpectedEOF
-		}
-		nullmap = buf[off : off+nb]
-		off += nb
+// checkSinglePage verifies that a -single-page input is exactly one page.
+func checkSinglePage(filePath string) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
 	}
-	isNull := func(attIdx int) bool {
-		if !hasNulls {
-			return false
-		}
-		byteIdx := attIdx / 8
-		bit := byte(1 << (attIdx % 8))
-		return (nullmap[byteIdx] & bit) != 0
+	defer f.Close()
+	size, err := f.Size()
+	if err != nil {
+		return err
 	}
-
-	// ---- attr 1: id BIGINT ----
-	off = align(off, 'd')
-	if !isNull(0) {
-		if off+8 > len(buf) {
-			return out, io.ErrUnexpectedEOF
-		}
-		out.ID = int64(binary.LittleEndian.Uint64(buf[off : off+8]))
-		off += 8
+	if size != heappage.PageSize {
+		return fmt.Errorf("%s: -single-page input is %d bytes, want exactly %d (give -page to accept it anyway)", filePath, size, heappage.PageSize)
 	}
-
-	// ---- attr 2: name TEXT (varlena) ----
-	off = align(off, 'i')
-	if !isNull(1) {
-		payload, next, err := readVarlenaLE(buf, off)
-		if err != nil {
-			return out, fmt.Errorf("read text varlena: %w", err)
-		}
-		out.Name = string(payload) // assuming UTF-8 and no compression/TOAST
-		off = next
-	}
-
-	return out, nil
+	return nil
 }
 
 // Utility to dump one page (8KiB) from a relation file at given page index.
-func dumpPage(filePath string, pageNo int, decodeDemo bool) error {
-	f, err := os.Open(filePath)
+func dumpPage(filePath string, pageNo int, opts DumpOptions) error {
+	f, err := openRelation(filePath)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	return dumpPageFrom(f, pageNo, opts)
+}
 
-	// Seek to page
-	off := int64(pageNo) * PageSize
-	if _, err := f.Seek(off, io.SeekStart); err != nil {
-		return err
+// dumpPageFrom dumps one page of an already open relation.
+func dumpPageFrom(f Relation, pageNo int, opts DumpOptions) (err error) {
+	defer recoverPage(pageNo, &err)
+	readNo := pageNo
+	if opts.SinglePage {
+		readNo = 0 // the input is one page; pageNo only labels it
 	}
-
-	page := make([]byte, PageSize)
-	n, err := io.ReadFull(f, page)
+	page, hdr, itemIDs, err := heappage.LoadPage(f, readNo)
 	if err != nil {
-		return fmt.Errorf("read page: %w", err)
-	}
-	if n != PageSize {
-		return fmt.Errorf("short read: got %d", n)
+		return err
 	}
-
-	r := bytes.NewReader(page)
-	hdr, err := readPageHeader(r)
+	w, err := newDumpWriter(os.Stdout, opts)
 	if err != nil {
 		return err
 	}
-
-	fmt.Printf("== Page %d ==\n", pageNo)
-	fmt.Printf("pd_lower=%d pd_upper=%d pd_special=%d  | free=%d bytes\n",
-		hdr.PdLower, hdr.PdUpper, hdr.PdSpecial, int(hdr.PdUpper)-int(hdr.PdLower))
-	fmt.Printf("lsn=(%d,%d) checksum=%d flags=0x%04x pagesize_ver=%d prune_xid=%d\n",
-		hdr.XLogID, hdr.XRecOff, hdr.PdChecksum, hdr.PdFlags, hdr.PdPagesizeVersion, hdr.PdPruneXID)
-
-	itemIDs, err := readItemIDs(r, hdr)
-	if err != nil {
+	if err := writePage(w, &heappage.Page{No: pageNo, Raw: page, Header: hdr, Items: itemIDs}, opts); err != nil {
 		return err
 	}
-	fmt.Printf("line pointers: %d\n", len(itemIDs))
+	return w.Finish()
+}
 
-	for _, it := range itemIDs {
-		fmt.Printf(" [%2d] lp_off=%4d lp_len=%3d flags=%d", it.Index, it.LpOff, it.LpLen, it.Flags)
-		switch it.Flags {
-		case LP_UNUSED:
-			fmt.Printf(" (UNUSED)\n")
-			continue
-		case LP_REDIRECT:
-			fmt.Printf(" (REDIRECT)\n")
-			continue
-		case LP_DEAD:
-			fmt.Printf(" (DEAD)\n")
-			// continue to show header anyway? Skip here:
-			fmt.Printf("\n")
-			continue
-		default:
-			fmt.Printf(" (NORMAL)\n")
-		}
+// cliMode is one of the flags that replace the plain page dump with another
+// report, and whether it was given.
+type cliMode struct {
+	flag string
+	on   bool
+}
 
-		// Bounds check
-		start := int(it.LpOff)
-		end := start + int(it.LpLen)
-		if start < 0 || end > len(page) || start >= end {
-			fmt.Printf("      ERROR: tuple span out of page bounds\n")
+// selectedMode returns the flag of the one mode that is on, or "" for the
+// plain page dump. Two modes at once are an error rather than one silently
+// winning.
+func selectedMode(modes []cliMode) (string, error) {
+	mode := ""
+	for _, m := range modes {
+		if !m.on {
 			continue
 		}
+		if mode != "" {
+			return "", fmt.Errorf("%s and %s cannot be combined; pick one mode", mode, m.flag)
+		}
+		mode = m.flag
+	}
+	return mode, nil
+}
 
-		tuple := page[start:end]
-		rr := bytes.NewReader(tuple)
-		var rh RowHeader
-		if err := binary.Read(rr, binary.LittleEndian, &rh); err != nil {
-			fmt.Printf("      ERROR: read row header: %v\n", err)
-			continue
+func main() {
+	var path, url string
+	var page int
+	var opts DumpOptions
+	var densMap bool
+	var all bool
+	var salvage bool
+	var force bool
+	var rawItemIDs bool
+	var freeSpaceMode bool
+	var estimate string
+	var varlenaHex string
+	var strict bool
+	var schemaSpec, attrsSpec string
+	var oidNamesFile string
+	var floatDatetimes bool
+	var histogram bool
+	var deadRatio bool
+	var vacuumThreshold float64
+	var relfrozenxid, nextXid uint
+	var forks bool
+	var legacyAclItem bool
+	var verify bool
+	var pageB64 string
+	var b64Rel Relation
+	var tupleHex string
+	var formatIn string
+	var onlyFlags string
+	var color string
+	var piItems []pageinspectItem
+	var compareSchemaMode bool
+	var explainChecksumMode bool
+	var attnameOff int
+	var tuple []byte
+	var prettyNodeTrees bool
+	var prettyJSON bool
+	var timePrecision int
+	var tz string
+	var binaryEnc string
+	var locale string
+	var encoding string
+	var xminStats bool
+	var kind string
+	var logLevelName string
+	var hstoreOid uint
+	var watch time.Duration
+	var attributeFile string
+	var catalogName string
+	var relid uint
+	var datadir, dbName, relName string
+	var tablespaces string
+	var pgVersion int
+	var sinceLSN string
+	var loExport uint
+	var outPath string
+	var listLobs bool
+	var loMetadata string
+	flag.StringVar(&path, "file", "", "Path to relation file (e.g. base/DBOID/RELOID)")
+	flag.StringVar(&url, "url", "", "HTTP(S) URL of a relation file (e.g. a pre-signed object URL); pages are fetched with Range requests")
+	flag.IntVar(&page, "page", 0, "Page number (0-based)")
+	flag.BoolVar(&opts.Demo, "demo", true, "Decode demo columns (id BIGINT, name TEXT)")
+	flag.BoolVar(&all, "all", false, "Dump every page of the relation")
+	flag.BoolVar(&opts.SkipErrors, "skip-errors", false, "With -all: report unreadable/corrupt pages to stderr and continue")
+	flag.BoolVar(&opts.WithOids, "with-oids", false, "Report the oid of pre-PG12 WITH OIDS tuples (infomask 0x0008)")
+	flag.BoolVar(&salvage, "salvage", false, "Ignore line pointers and scan the page body for tuple-shaped data")
+	flag.BoolVar(&force, "force", false, "Read -file even if block 0 does not look like a heap page")
+	flag.BoolVar(&rawItemIDs, "raw-itemids", false, "Print raw ItemIdData words next to the decoded off/len/flags")
+	flag.BoolVar(&freeSpaceMode, "dump-free-space", false, "Hex-dump the free space between pd_lower and pd_upper and report leftover nonzero bytes (text or json)")
+	flag.StringVar(&estimate, "estimate", "", "Estimate tuples per page: tuplesize=N (no -file needed)")
+	flag.StringVar(&varlenaHex, "varlena-hex", "", "Explain one varlena datum given as hex from its header on (\"-\" reads stdin): header kind, length, compression, TOAST pointer, payload (no -file needed)")
+	flag.StringVar(&opts.Format, "format", "text", "Output format: text, json, jsonl, csv, sql (INSERTs, needs -schema and -table), prom (relation metrics), dot (Graphviz page diagram), parquet (live rows, needs -schema or -demo)")
+	flag.BoolVar(&opts.LiveOnly, "live-only", false, "Omit dead/redirect/unused line pointers")
+	flag.StringVar(&onlyFlags, "only-flags", "", "Write only line pointers with these flags, e.g. dead,redirect (unused, normal, redirect, dead); page counts stay complete")
+	flag.StringVar(&color, "color", "auto", "With -format text: ANSI colors, always, never or auto (when stdout is a terminal and NO_COLOR is unset)")
+	flag.BoolVar(&opts.RawLSN, "raw-lsn", false, "Print the page LSN as raw (xlogid,xrecoff) decimals instead of X/X")
+	flag.BoolVar(&strict, "strict", false, "Collect anomalies (bad header, pd_lower/pd_upper mismatch, checksum mismatch, bad tuple span, undecodable datum) and exit 1 if any")
+	flag.StringVar(&attributeFile, "attribute-file", "", "Take the schema of table -relid from this pg_attribute heap file instead of -schema (layout per -pgversion)")
+	flag.StringVar(&catalogName, "catalog", "", "Decode the file as this system catalog with its built-in schema: pg_attribute, pg_class, pg_type or pg_proc (layout per -pgversion)")
+	flag.UintVar(&relid, "relid", 0, "With -attribute-file: the table's pg_class oid")
+	flag.IntVar(&pgVersion, "pgversion", 0, "PostgreSQL major of the files (12-16): selects the pg_attribute layout and, before 16, -legacy-aclitem (default: 14/15 catalogs, 16+ aclitem)")
+	flag.StringVar(&datadir, "datadir", "", "Find -relname in database -db of this data directory: its file (unless -file is given) and its schema from the catalogs")
+	flag.StringVar(&tablespaces, "tablespace", "", "With -datadir: tablespace locations as oid=dir,..., for tablespaces whose pg_tblspc link does not resolve here")
+	flag.StringVar(&dbName, "db", "", "With -datadir: database name")
+	flag.StringVar(&relName, "relname", "", "With -datadir: table name, or <namespace oid>.name if ambiguous")
+	flag.StringVar(&schemaSpec, "schema", "", "Decode columns with this schema: name:type,... (e.g. id:int8,name:text); a composite column as name:(field:type,...)")
+	flag.StringVar(&attrsSpec, "attrs", "", "With -schema: decode only these 1-based attributes, e.g. 1,3")
+	flag.StringVar(&oidNamesFile, "oid-names", "", "File of \"catalog oid name\" lines used to resolve reg* columns")
+	flag.BoolVar(&opts.Quiet, "quiet", false, "Suppress the progress indicator of whole-relation scans")
+	flag.StringVar(&opts.Table, "table", "", "With -format sql: table name for the INSERT statements")
+	flag.BoolVar(&opts.Expanded, "expanded", false, "With -format text: print decoded columns one \"name | value\" line each, like psql's \\x")
+	flag.BoolVar(&opts.Explain, "explain", false, "With -format text: add plain-English notes on the page header, line pointers and infomask bits")
+	flag.BoolVar(&floatDatetimes, "float-datetimes", false, "Decode time/timestamp/interval as legacy float8 seconds (clusters built with --disable-integer-datetimes)")
+	flag.BoolVar(&legacyAclItem, "legacy-aclitem", false, "Decode aclitem in the pre-PG16 12-byte layout (32-bit privilege mask)")
+	flag.BoolVar(&explainChecksumMode, "explain-checksum", false, "Show how the checksum of page -page is computed, step by step, and compare it with pd_checksum")
+	flag.BoolVar(&forks, "forks", false, "List the relation's forks (main, fsm, vm, init) and segment files with their sizes; -format json for JSON")
+	flag.BoolVar(&verify, "verify-all", false, "Verify the checksum of every page and list the blocks that fail (like pg_checksums --check)")
+	flag.BoolVar(&opts.CheckPadding, "check-padding", false, "With -schema: report tuples whose alignment padding is not zero, a sign of a misaligned schema or of corruption")
+	flag.BoolVar(&opts.IncludeDead, "include-dead", false, "Also decode LP_DEAD line pointers that still point at tuple storage (forensics; the data may be partly overwritten)")
+	flag.DurationVar(&watch, "watch", 0, "Re-read and redraw the page dump at this interval (e.g. 500ms) until Ctrl-C")
+	flag.UintVar(&hstoreOid, "hstore-oid", 0, "Decode hstore, whose oid in this cluster is N (SELECT 'hstore'::regtype::oid); enables it in -schema")
+	flag.StringVar(&logLevelName, "log-level", "info", "Diagnostics on stderr at or above this level: debug, info, warn or error")
+	flag.StringVar(&kind, "kind", "", "Relation fork to read: heap (main fork) or init; files named *_init default to init")
+	flag.BoolVar(&xminStats, "xmin-stats", false, "Count the page's tuples per distinct xmin and xmax; -format json for JSON")
+	flag.BoolVar(&deadRatio, "dead-ratio", false, "Report dead tuples per page and overall, with reclaimable space and a VACUUM hint; -format json for JSON")
+	flag.Float64Var(&vacuumThreshold, "vacuum-threshold", 20, "With -dead-ratio: dead percentage from which VACUUM is suggested")
+	flag.UintVar(&relfrozenxid, "relfrozenxid", 0, "Report the oldest unfrozen xmin per page and overall, flagging tuples older than this pg_class.relfrozenxid; -format json for JSON")
+	flag.UintVar(&nextXid, "next-xid", 0, "With -relfrozenxid: the current xid (txid_current(), pg_controldata NextXID), to show the distance to wraparound")
+	flag.BoolVar(&histogram, "histogram", false, "Print a histogram of live tuple sizes (lp_len) over the relation; -format json for JSON")
+	flag.BoolVar(&opts.SinglePage, "single-page", false, "The input is one raw page (e.g. saved get_raw_page output), dumped as block 0; must be exactly one page unless -page gives its block number")
+	flag.BoolVar(&opts.TraceOffsets, "trace-offsets", false, "With -schema: show each attribute's offset, alignment padding and length, to debug a schema that doesn't match")
+	flag.StringVar(&pageB64, "page-b64", "", "Dump one page given as base64 (\"-\" reads it from stdin) instead of reading -file; -page sets its block number")
+	flag.BoolVar(&compareSchemaMode, "compare-schema", false, "Check -schema against the page's live tuples: report those it does not decode to exactly their end, and the fraction it does")
+	flag.IntVar(&attnameOff, "attname", -1, "With -schema: name the header field, padding or attribute that byte N of each tuple on the page (or of -tuple-hex) falls in; N counts from t_xmin as in -trace-offsets")
+	flag.StringVar(&formatIn, "format-in", "heap", "Input format: heap (a relation file) or pageinspect (heap_page_items output as psql prints it, from -file or stdin; with -demo or -schema)")
+	flag.StringVar(&tupleHex, "tuple-hex", "", "Decode one tuple given as hex bytes from its header on (\"-\" reads stdin), with -demo or -schema; no page or -file")
+	flag.StringVar(&encoding, "encoding", "", "Server encoding of text columns, converted to UTF-8 for display, e.g. LATIN1, WIN1251 or KOI8R (default: UTF8 pass-through, or with -datadir the database's encoding)")
+	flag.StringVar(&locale, "locale", "", "With -format text: show numeric and money with this locale's separators, e.g. en_US or de_DE (default: plain C output)")
+	flag.IntVar(&timePrecision, "time-precision", -1, "Show time, timestamp and interval values with exactly this many fractional second digits, 0-6 (default: as PostgreSQL does, trailing zeros dropped)")
+	flag.StringVar(&binaryEnc, "binary-encoding", "", "Render bytea as hex (\\x..., the default), escape (bytea_output = escape) or base64; JSON output uses base64 unless this is given")
+	flag.StringVar(&tz, "tz", "", "Show timestamptz in this IANA time zone, e.g. America/New_York (default: UTC); the stored value is UTC either way")
+	flag.BoolVar(&opts.EpochBase, "epoch-base", false, "With -format text: show timestamp/timestamptz as the raw value since 2000-01-01 next to the decoded one")
+	flag.BoolVar(&prettyJSON, "pretty-json", false, "Indent json and jsonb columns")
+	flag.BoolVar(&prettyNodeTrees, "pretty-node-trees", false, "Indent pg_node_tree columns (pg_attrdef.adbin, ...) instead of printing them on one line")
+	flag.StringVar(&sinceLSN, "since-lsn", "", "With -all: only dump pages whose LSN is after this one (X/X, e.g. 16/B374D848)")
+	flag.UintVar(&loExport, "lo-export", 0, "Reassemble the large object with this loid from a pg_largeobject heap file")
+	flag.StringVar(&outPath, "o", "-", "With -lo-export: output file (\"-\" for stdout)")
+	flag.BoolVar(&listLobs, "list-lobs", false, "List the large objects in a pg_largeobject heap file with owner, ACL, chunks and size (text or json)")
+	flag.StringVar(&loMetadata, "lo-metadata", "", "With -list-lobs: the pg_largeobject_metadata heap file (default: 2995 next to -file, if present)")
+	flag.IntVar(&opts.Head, "head", 0, "Dump only the first N pages of the relation (implies -all)")
+	flag.IntVar(&opts.Tail, "tail", 0, "Dump only the last N pages of the relation (implies -all; with -head, both ends)")
+	flag.IntVar(&opts.MaxPages, "max-pages", 0, "With -all: stop after this many pages, as a guard against pointing at a huge non-relation file (0: no limit)")
+	flag.BoolVar(&densMap, "map", false, "Print a line-pointer density map, one row per page")
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := SetLogLevel(logLevelName); err != nil {
+		fmt.Fprintf(os.Stderr, "error: -log-level: %v\n", err)
+		os.Exit(2)
+	}
+
+	if opts.Head < 0 || opts.Tail < 0 {
+		fmt.Fprintf(os.Stderr, "error: -head and -tail take a page count\n")
+		os.Exit(2)
+	}
+	allFlag := "-all"
+	if opts.Head > 0 || opts.Tail > 0 {
+		all, allFlag = true, "-head/-tail"
+	}
+
+	if estimate != "" {
+		if err := runEstimate(estimate); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		return
+	}
+	if varlenaHex != "" {
+		datum, err := hexFromArg(varlenaHex, os.Stdin)
+		if err == nil && len(datum) == 0 {
+			err = errors.New("empty datum")
 		}
+		if err == nil {
+			err = explainVarlena(datum)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -varlena-hex: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch opts.Format {
+	case "text", "json", "jsonl", "csv", "sql", "prom", "dot", "parquet":
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown -format %q\n", opts.Format)
+		os.Exit(2)
+	}
 
-		fmt.Printf("      xmin=%d xmax=%d ctid=(%d,%d) natts=%d hoff=%d infomask=0x%04x infomask2=0x%04x\n",
-			rh.Xmin, rh.Xmax,
-			int(rh.CTIDBlockHi)<<16|int(rh.CTIDBlockLo), rh.CTIDOffset,
-			rh.Natts(), rh.Hoff, rh.InfoMask, rh.InfoMask2)
+	switch color {
+	case "always":
+		opts.Color = true
+	case "never":
+	case "auto":
+		opts.Color = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+	default:
+		fmt.Fprintf(os.Stderr, "error: -color must be always, never or auto, got %q\n", color)
+		os.Exit(2)
+	}
+	if opts.Explain && opts.Format != "text" {
+		fmt.Fprintf(os.Stderr, "error: -explain only applies to -format text\n")
+		os.Exit(2)
+	}
+	if opts.Expanded && opts.Format != "text" {
+		fmt.Fprintf(os.Stderr, "error: -expanded only applies to -format text\n")
+		os.Exit(2)
+	}
+	if opts.EpochBase && opts.Format != "text" {
+		fmt.Fprintf(os.Stderr, "error: -epoch-base only applies to -format text; exports keep the plain values\n")
+		os.Exit(2)
+	}
+
+	mode, err := selectedMode([]cliMode{
+		{allFlag, all}, {"-map", densMap}, {"-histogram", histogram}, {"-dead-ratio", deadRatio},
+		{"-relfrozenxid", relfrozenxid != 0}, {"-forks", forks}, {"-explain-checksum", explainChecksumMode},
+		{"-xmin-stats", xminStats}, {"-verify-all", verify}, {"-lo-export", loExport != 0},
+		{"-list-lobs", listLobs}, {"-salvage", salvage}, {"-raw-itemids", rawItemIDs},
+		{"-dump-free-space", freeSpaceMode}, {"-format prom", opts.Format == "prom"},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
 
-		if decodeDemo {
-			row, err := decodeDemoRow(tuple, &rh)
+	if pageB64 != "" {
+		if path != "" || url != "" || mode != "" {
+			fmt.Fprintf(os.Stderr, "error: -page-b64 only works with the plain page dump, without -file or -url\n")
+			os.Exit(2)
+		}
+		rel, err := pageFromBase64(pageB64, os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.SinglePage = true
+		b64Rel = rel
+	}
+	if tupleHex != "" {
+		if path != "" || url != "" || pageB64 != "" || mode != "" || opts.Format == "json" {
+			fmt.Fprintf(os.Stderr, "error: -tuple-hex decodes a tuple on its own: no -file, -url, -page-b64 or scan modes, and -format text, jsonl, csv or sql\n")
+			os.Exit(2)
+		}
+		var err error
+		if tuple, err = tupleFromHex(tupleHex, os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	switch formatIn {
+	case "heap":
+	case "pageinspect":
+		if url != "" || pageB64 != "" || tupleHex != "" || mode != "" || opts.Format == "json" {
+			fmt.Fprintf(os.Stderr, "error: -format-in pageinspect decodes pasted heap_page_items rows: no -url, -page-b64, -tuple-hex or scan modes, and -format text, jsonl, csv or sql\n")
+			os.Exit(2)
+		}
+		in := io.Reader(os.Stdin)
+		if path != "" && path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			in = f
+		}
+		var err error
+		if piItems, err = readPageinspect(in); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -format-in pageinspect: %v\n", err)
+			os.Exit(1)
+		}
+		path = ""
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown -format-in %q (want heap or pageinspect)\n", formatIn)
+		os.Exit(2)
+	}
+	if url != "" {
+		if path != "" {
+			fmt.Fprintf(os.Stderr, "error: -file and -url are mutually exclusive\n")
+			os.Exit(2)
+		}
+		path = url
+	}
+	if pgVersion != 0 {
+		if err := UseCatalogVersion(pgVersion); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -pgversion: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if encoding != "" {
+		enc, err := heappage.LookupEncoding(encoding)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -encoding: %v\n", err)
+			os.Exit(2)
+		}
+		decodeOptions.Encoding = enc
+	}
+	if tablespaces != "" && datadir == "" {
+		fmt.Fprintf(os.Stderr, "error: -tablespace requires -datadir\n")
+		os.Exit(2)
+	}
+	if datadir != "" {
+		if dbName == "" || relName == "" || schemaSpec != "" || attributeFile != "" || url != "" || b64Rel != nil {
+			fmt.Fprintf(os.Stderr, "error: -datadir needs -db and -relname, and replaces -schema, -attribute-file, -url and -page-b64\n")
+			os.Exit(2)
+		}
+		cluster := &catalog.Cluster{DataDir: datadir, Major: catalogMajor, Options: decodeOptions}
+		if tablespaces != "" {
+			dirs, err := catalog.ParseTablespaceDirs(tablespaces)
 			if err != nil {
-				fmt.Printf("      decode demo row: %v\n", err)
+				fmt.Fprintf(os.Stderr, "error: -tablespace: %v\n", err)
+				os.Exit(2)
+			}
+			cluster.Tablespaces = dirs
+		}
+		loc, err := cluster.LocateTable(context.Background(), dbName, relName)
+		if err == nil && encoding == "" {
+			// names in pg_attribute are in the database encoding too
+			if enc, err := heappage.EncodingByID(loc.Encoding); err != nil {
+				logger.Warn("database encoding not supported, text shown unconverted", "err", err)
 			} else {
-				fmt.Printf("      demo: id=%d, name=%q\n", row.ID, row.Name)
+				decodeOptions.Encoding = enc
 			}
 		}
+		var cols []heappage.ColumnDef
+		if err == nil {
+			cols, err = cluster.TableSchema(context.Background(), loc)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Schema = cols
+		if path == "" && piItems == nil {
+			path = loc.Path
+		}
+		logger.Info("schema from catalogs", "relation", relName, "file", path, "columns", len(cols))
+	}
+	if path == "" && b64Rel == nil && tuple == nil && piItems == nil {
+		usage()
+		os.Exit(2)
+	}
+	if kind == "" && b64Rel == nil && relationFork(path) == "init" {
+		kind = "init"
+	}
+	switch kind {
+	case "", "heap":
+	case "init":
+		if b64Rel != nil || mode != "" {
+			fmt.Fprintf(os.Stderr, "error: -kind init only works with the plain dump\n")
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "error: -kind must be heap or init, got %q\n", kind)
+		os.Exit(2)
+	}
+	if onlyFlags != "" {
+		mask, err := ParseLPFlags(onlyFlags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -only-flags: %v\n", err)
+			os.Exit(2)
+		}
+		opts.OnlyFlags = mask
+	}
+	if opts.IncludeDead && opts.LiveOnly {
+		fmt.Fprintf(os.Stderr, "error: -include-dead and -live-only are mutually exclusive\n")
+		os.Exit(2)
+	}
+	if watch != 0 {
+		if watch < 0 || b64Rel != nil || kind == "init" || mode != "" || strict {
+			fmt.Fprintf(os.Stderr, "error: -watch takes a positive interval and only works with the plain page dump\n")
+			os.Exit(2)
+		}
+	}
+	if strict {
+		opts.Anomalies = NewAnomalies()
+	}
+	decodeOptions.FloatDatetimes = floatDatetimes
+	if locale != "" {
+		var err error
+		opts.Locale, err = heappage.LookupLocale(locale)
+		if err == nil && opts.Format != "text" {
+			err = errors.New("-locale only applies to -format text; exports keep the plain values")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if binaryEnc != "" {
+		if err := heappage.CheckBinaryEncoding(binaryEnc); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -binary-encoding: %v\n", err)
+			os.Exit(2)
+		}
+		decodeOptions.BinaryEncoding = binaryEnc
+	}
+	if tz != "" {
+		loc, err := heappage.LoadTimeZone(tz)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -tz: %v\n", err)
+			os.Exit(2)
+		}
+		decodeOptions.TimeZone = loc
+	}
+	if timePrecision != -1 {
+		if err := heappage.CheckTimePrecision(timePrecision); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -time-precision: %v\n", err)
+			os.Exit(2)
+		}
+		decodeOptions.TimePrecision = timePrecision
+	}
+	if legacyAclItem {
+		decodeOptions.LegacyAclItem = true
+	}
+	decodeOptions.PrettyJSON = prettyJSON
+	decodeOptions.PrettyNodeTrees = prettyNodeTrees
+	if hstoreOid != 0 {
+		if _, taken := heappage.LookupType(heappage.Oid(hstoreOid)); taken {
+			fmt.Fprintf(os.Stderr, "error: -hstore-oid %d is a built-in type\n", hstoreOid)
+			os.Exit(2)
+		}
+		heappage.RegisterHstore(heappage.Oid(hstoreOid))
+	}
+	if oidNamesFile != "" {
+		if err := heappage.LoadOidNames(oidNamesFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if schemaSpec != "" {
+		var err error
+		if opts.Schema, err = heappage.ParseSchema(schemaSpec, decodeOptions); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if attributeFile != "" {
+		if schemaSpec != "" {
+			fmt.Fprintf(os.Stderr, "error: -attribute-file and -schema are mutually exclusive\n")
+			os.Exit(2)
+		}
+		cols, err := loadTableColumns(context.Background(), attributeFile, heappage.Oid(relid))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Schema = cols
+	}
+	if catalogName != "" {
+		if opts.Schema != nil {
+			fmt.Fprintf(os.Stderr, "error: -catalog replaces -schema, -attribute-file and -datadir\n")
+			os.Exit(2)
+		}
+		cols, err := catalogSchema(catalogName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -catalog: %v\n", err)
+			os.Exit(2)
+		}
+		opts.Schema = cols
 	}
 
-	return nil
-}
+	if opts.SinglePage && b64Rel == nil {
+		if mode != "" {
+			fmt.Fprintf(os.Stderr, "error: -single-page only works with the plain page dump\n")
+			os.Exit(2)
+		}
+		pageGiven := false
+		flag.Visit(func(f *flag.Flag) { pageGiven = pageGiven || f.Name == "page" })
+		if !pageGiven {
+			if err := checkSinglePage(path); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	if sinceLSN != "" {
+		lsn, err := heappage.ParseLSN(sinceLSN)
+		if err == nil && !all {
+			err = fmt.Errorf("-since-lsn requires -all")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		opts.SinceLSN = lsn
+	}
+	if relfrozenxid > math.MaxUint32 || nextXid > math.MaxUint32 || (nextXid != 0 && relfrozenxid == 0) {
+		fmt.Fprintf(os.Stderr, "error: -relfrozenxid and -next-xid take 32-bit xids, and -next-xid requires -relfrozenxid\n")
+		os.Exit(2)
+	}
+	if opts.MaxPages != 0 && (opts.MaxPages < 0 || !all) {
+		fmt.Fprintf(os.Stderr, "error: -max-pages requires -all and a positive count\n")
+		os.Exit(2)
+	}
+	if compareSchemaMode && (opts.Schema == nil || tuple != nil || b64Rel != nil || mode != "" || opts.Format != "text") {
+		fmt.Fprintf(os.Stderr, "error: -compare-schema needs -schema (or -datadir/-attribute-file) and works on one page of -file, text output\n")
+		os.Exit(2)
+	}
+	if attnameOff >= 0 && (opts.Schema == nil || compareSchemaMode || b64Rel != nil || mode != "" || opts.Format != "text") {
+		fmt.Fprintf(os.Stderr, "error: -attname needs -schema and works on one page of -file or on -tuple-hex, text output\n")
+		os.Exit(2)
+	}
+	if opts.CheckPadding && opts.Schema == nil {
+		fmt.Fprintf(os.Stderr, "error: -check-padding requires -schema\n")
+		os.Exit(2)
+	}
+	if opts.TraceOffsets && opts.Schema == nil {
+		fmt.Fprintf(os.Stderr, "error: -trace-offsets requires -schema\n")
+		os.Exit(2)
+	}
+	if opts.Format == "sql" && (opts.Schema == nil || opts.Table == "") {
+		fmt.Fprintf(os.Stderr, "error: -format sql needs -schema and -table\n")
+		os.Exit(2)
+	}
+	if opts.Format == "parquet" && opts.Schema == nil && !opts.Demo {
+		fmt.Fprintf(os.Stderr, "error: -format parquet needs -schema or -demo\n")
+		os.Exit(2)
+	}
+	if opts.Format == "parquet" && isTerminal(os.Stdout) {
+		fmt.Fprintf(os.Stderr, "error: -format parquet writes a binary file; redirect stdout\n")
+		os.Exit(2)
+	}
+	if attrsSpec != "" {
+		attrs, err := heappage.ParseAttrs(attrsSpec)
+		if err == nil && opts.Schema == nil {
+			err = fmt.Errorf("-attrs requires -schema")
+		}
+		for _, a := range attrs {
+			if err == nil && (a < 1 || a > len(opts.Schema)) {
+				err = fmt.Errorf("-attrs: attribute %d out of range 1..%d", a, len(opts.Schema))
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		opts.Attrs = attrs
+	}
 
-func main() {
-	var path string
-	var page int
-	var demo bool
-	flag.StringVar(&path, "file", "", "Path to relation file (e.g. base/DBOID/RELOID)")
-	flag.IntVar(&page, "page", 0, "Page number (0-based)")
-	flag.BoolVar(&demo, "demo", true, "Decode demo columns (id BIGINT, name TEXT)")
-	flag.Parse()
+	// -salvage is for pages whose header is gone; don't hold block 0 against it
+	if path != "" && !force && !salvage {
+		if err := checkLooksLikeRelation(path); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	path = "/run/media/deck/steamdrive/go/src/github.com/ptflp/techinterview/2.db/57344"
-	if path == "" {
-		fmt.Println("Usage:")
-		fmt.Println("  pgheapdump -file /path/to/16567 -page 0 [-demo=true]")
-		os.Exit(2)
+	if path != "" && !opts.SinglePage {
+		opts.BlockBase = segmentBlockBase(path)
 	}
 
-	if err := dumpPage(path, page, demo); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if attnameOff >= 0 && tuple != nil {
+		err = attnameInTuple(tuple, attnameOff, opts.Schema)
+	} else if attnameOff >= 0 {
+		err = attnameAtOffset(path, page, attnameOff, opts.Schema)
+	} else if tuple != nil {
+		err = dumpTuple(tuple, opts)
+	} else if piItems != nil {
+		err = dumpPageinspect(piItems, page, opts)
+	} else if b64Rel != nil {
+		err = dumpPageFrom(b64Rel, page, opts)
+	} else if opts.Format == "prom" {
+		err = writeRelationMetrics(ctx, path, opts)
+	} else if watch != 0 {
+		err = watchPage(ctx, path, page, watch, opts)
+	} else if kind == "init" {
+		err = dumpInitFork(ctx, path, opts)
+	} else if loExport != 0 {
+		err = exportLargeObject(ctx, path, heappage.Oid(loExport), outPath, opts)
+	} else if listLobs {
+		err = listLargeObjects(ctx, os.Stdout, path, loMetadata, opts)
+	} else if explainChecksumMode {
+		err = explainPageChecksum(path, page)
+	} else if forks {
+		err = forksSummary(path, opts)
+	} else if verify {
+		err = verifyAll(ctx, path, opts)
+	} else if compareSchemaMode {
+		err = compareSchema(path, page, opts.Schema)
+	} else if xminStats {
+		err = xidStats(path, page, opts)
+	} else if deadRatio {
+		err = deadRatioReport(ctx, path, vacuumThreshold, opts)
+	} else if relfrozenxid != 0 {
+		err = freezeAgeReport(ctx, path, uint32(relfrozenxid), uint32(nextXid), opts)
+	} else if histogram {
+		err = tupleSizeHistogram(ctx, path, opts)
+	} else if densMap {
+		err = densityMap(ctx, path)
+	} else if rawItemIDs {
+		err = dumpRawItemIDs(path, page)
+	} else if freeSpaceMode {
+		err = dumpFreeSpace(path, page, opts)
+	} else if salvage {
+		err = salvagePage(path, page, opts)
+	} else if all {
+		err = dumpRelation(ctx, path, opts)
+	} else {
+		err = dumpPage(path, page, opts)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	if opts.Anomalies != nil && opts.Anomalies.Count() > 0 {
+		opts.Anomalies.WriteSummary(os.Stderr)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -page 0 [-demo=true]")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -all [-skip-errors] [-strict]")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -schema id:int8,name:text [-attrs 1]")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -map")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -histogram [-format json]")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -dead-ratio [-vacuum-threshold 10]")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -relfrozenxid 23000 [-next-xid 2100000000]")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -page 0 -xmin-stats")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -page 0 -watch 500ms")
+	fmt.Fprintln(w, "  pgheapdump -datadir /var/lib/postgresql/15/main -db app -relname users -all")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -forks")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -verify-all")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/2613 -lo-export 16401 -o blob.bin")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/2613 -list-lobs")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -page 0 -salvage")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -page 0 -raw-itemids")
+	fmt.Fprintln(w, "  pgheapdump -file /path/to/16567 -page 0 -dump-free-space")
+	fmt.Fprintln(w, "  pgheapdump -url https://bucket.example/base/5/16567?sig=... -page 0")
+	fmt.Fprintln(w, "  pgheapdump -page-b64 - < page.b64")
+	fmt.Fprintln(w, "  pgheapdump -format-in pageinspect -schema id:int8,name:text < heap_page_items.txt")
+	fmt.Fprintln(w, "  pgheapdump -estimate tuplesize=64")
+	fmt.Fprintln(w, "  pgheapdump -varlena-hex 0b48656c6c6f")
+	fmt.Fprintln(w)
+	flag.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit status:")
+	fmt.Fprintln(w, "  0  success")
+	fmt.Fprintln(w, "  1  error, or with -strict any anomaly found in the scanned range, or")
+	fmt.Fprintln(w, "     with -verify-all any checksum failure or a truncated last block")
+	fmt.Fprintln(w, "  2  usage error")
 }
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+	"github.com/ptflp/techinterview/2.db/heappage/heaptest"
+)
+
+// pageSeeds adds the sample relation page and the catalog fixtures to a
+// fuzz corpus, with a truncated and an all-zero page.
+func pageSeeds(f *testing.F) {
+	paths, _ := filepath.Glob(filepath.Join("catalog", "testdata", "*.page"))
+	for _, p := range append(paths, "57344") {
+		page, err := os.ReadFile(p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(page[:heappage.PageSize])
+	}
+	f.Add(make([]byte, heappage.PageSize))
+	f.Add(make([]byte, heappage.PageHeaderByteLen-1))
+}
+
+// quietLogger silences the warnings corrupt pages log for the rest of a
+// test.
+func quietLogger(tb testing.TB) {
+	saved, savedLib := logger, heappage.Logger
+	logger = slog.New(slog.DiscardHandler)
+	heappage.Logger = logger
+	tb.Cleanup(func() { logger, heappage.Logger = saved, savedLib })
+}
+
+func FuzzReadPageHeader(f *testing.F) {
+	pageSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		hdr, err := heappage.ReadPageHeader(bytes.NewReader(data))
+		if err != nil {
+			if len(data) >= heappage.PageHeaderByteLen {
+				t.Fatalf("%d bytes: %v", len(data), err)
+			}
+			return
+		}
+		if heappage.ValidatePageHeader(hdr) != nil {
+			return
+		}
+		items, err := heappage.ReadItemIDs(bytes.NewReader(data[heappage.PageHeaderByteLen:]), hdr)
+		if err != nil {
+			return
+		}
+		if want := (int(hdr.PdLower) - heappage.PageHeaderByteLen) / heappage.ItemIDByteLen; len(items) != want {
+			t.Fatalf("pd_lower=%d gave %d line pointers, want %d", hdr.PdLower, len(items), want)
+		}
+		for i, it := range items {
+			if it.LpOff > 0x7FFF || it.LpLen > 0x7FFF || it.Flags > heappage.LP_DEAD || it.Index != heappage.OffsetNumber(i+1) {
+				t.Fatalf("line pointer %d out of range: %+v", i, it)
+			}
+		}
+		checkPageBounds(hdr, items)
+	})
+}
+
+// recordingWriter keeps what writePage hands a DumpWriter.
+type recordingWriter struct{ tuples []TupleDump }
+
+func (r *recordingWriter) WritePage(PageDump) error { return nil }
+func (r *recordingWriter) WriteTuple(td TupleDump) error {
+	r.tuples = append(r.tuples, td)
+	return nil
+}
+func (r *recordingWriter) Finish() error { return nil }
+
+// FuzzDumpPage runs a page through the plain dump with the demo columns, a
+// wider schema and every output format. writePage and buildTupleDump turn a
+// panic into an error, so a panic shows up as one here.
+//
+// The inputs are whole pages and minimizing each new one stalls the
+// fuzzer for up to a minute; run it with -fuzzminimizetime 0.
+func FuzzDumpPage(f *testing.F) {
+	pageSeeds(f)
+	schema, err := heappage.ParseSchema("id:int8,name:text,n:numeric,ts:timestamptz,tags:text[],r:int4range,j:jsonb", nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		quietLogger(t)
+		page := make([]byte, heappage.PageSize)
+		copy(page, data)
+		hdr, items, err := heappage.ParsePage(page)
+		if err != nil {
+			return
+		}
+		p := &heappage.Page{No: 0, Raw: page, Header: hdr, Items: items}
+		for _, opts := range []DumpOptions{
+			{Demo: true, Format: "text", IncludeDead: true, Anomalies: NewAnomalies()},
+			{Schema: schema, Format: "jsonl", TraceOffsets: true, CheckPadding: true},
+			{Schema: schema, Format: "text", EpochBase: true, Attrs: []int{4}},
+		} {
+			var rec recordingWriter
+			if err := writePage(&rec, p, opts); err != nil {
+				if strings.Contains(err.Error(), "panic") {
+					t.Fatal(err)
+				}
+				continue
+			}
+			for _, td := range rec.tuples {
+				if strings.HasPrefix(td.Error, "decoder panic") {
+					t.Fatalf("lp %d: %s", td.Offset, td.Error)
+				}
+			}
+		}
+		for _, format := range []string{"text", "json", "csv", "sql", "dot"} {
+			opts := DumpOptions{Demo: true, Format: format, Table: "t"}
+			w, err := newDumpWriter(io.Discard, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writePage(w, p, opts); err != nil {
+				var pe *heappage.PageError
+				if errors.As(err, &pe) && pe.Stage == "decode" {
+					t.Fatal(err)
+				}
+			}
+			w.Finish()
+		}
+	})
+}
+
+func TestLockedTupleOutput(t *testing.T) {
+	tup := heaptest.Tuple(t, demoColumns, []any{int64(1), "a"})
+	binary.LittleEndian.PutUint32(tup[4:], 742) // xmax
+	binary.LittleEndian.PutUint16(tup[18:], 2|heappage.HEAP_KEYS_UPDATED)
+	binary.LittleEndian.PutUint16(tup[20:], heappage.HEAP_HASVARWIDTH|heappage.HEAP_XMIN_COMMITTED|heappage.HEAP_XMAX_LOCK_ONLY|heappage.HEAP_XMAX_EXCL_LOCK)
+	page := heaptest.Page(t, 0, tup)
+	hdr, items, err := heappage.ParsePage(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &heappage.Page{Raw: page, Header: hdr, Items: items}
+
+	for format, want := range map[string]string{
+		"text":  "      locked FOR UPDATE by xmax 742\n",
+		"jsonl": `"live":true,"lock":"FOR UPDATE"`,
+	} {
+		var buf bytes.Buffer
+		opts := DumpOptions{Demo: true, Format: format}
+		w, err := newDumpWriter(&buf, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(w, p, opts); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%s output has no %q:\n%s", format, want, buf.String())
+		}
+	}
+}
+
+// runMainEnv holds the arguments when the test binary re-runs itself as
+// the command (runMain).
+const runMainEnv = "PGHEAPDUMP_TEST_ARGS"
+
+// runMain runs the command with args in a child process, since main exits,
+// and returns what it wrote to stderr and its exit code.
+func runMain(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), runMainEnv+"="+strings.Join(args, "\n"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(runMainEnv); ok {
+		os.Args = append([]string{"pgheapdump"}, strings.Split(args, "\n")...)
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Two modes at once are refused, naming both by the flags that were given.
+func TestModeConflict(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-file", "57344", "-map", "-dump-free-space"}, "error: -map and -dump-free-space cannot be combined; pick one mode\n"},
+		{[]string{"-file", "57344", "-dump-free-space", "-format", "prom"}, "error: -dump-free-space and -format prom cannot be combined; pick one mode\n"},
+	} {
+		stderr, code := runMain(t, tt.args...)
+		if stderr != tt.want || code != 2 {
+			t.Errorf("%q: exit %d, stderr %q; want exit 2, %q", tt.args, code, stderr, tt.want)
+		}
+	}
+}
+
+func TestBinaryEncodingFlag(t *testing.T) {
+	stderr, code := runMain(t, "-file", "57344", "-binary-encoding", "base32")
+	want := "error: -binary-encoding: unknown binary encoding \"base32\" (want hex, escape or base64)\n"
+	if stderr != want || code != 2 {
+		t.Errorf("exit %d, stderr %q; want exit 2, %q", code, stderr, want)
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+// Output layer: pages and tuples are first collected into plain dump structs
+// and then handed to a DumpWriter selected by -format.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+type PageDump struct {
+	Page            int    `json:"page"`
+	LSN             string `json:"lsn"`
+	XLogID          uint32 `json:"lsn_xlogid"`
+	XRecOff         uint32 `json:"lsn_xrecoff"`
+	Checksum        uint16 `json:"checksum"`
+	Flags           uint16 `json:"flags"`
+	Lower           uint16 `json:"pd_lower"`
+	Upper           uint16 `json:"pd_upper"`
+	Special         uint16 `json:"pd_special"`
+	PagesizeVersion uint16 `json:"pagesize_version"`
+	PruneXID        uint32 `json:"prune_xid"`
+	Free            int    `json:"free"`
+	New             bool   `json:"new,omitempty"`
+	LinePointers    int    `json:"line_pointers"`
+	FlagCounts      []int  `json:"flag_counts,omitempty"` // with -only-flags: line pointers per flag, UNUSED to DEAD
+}
+
+type TupleHeaderDump struct {
+	Xmin      uint32 `json:"xmin"`
+	Xmax      uint32 `json:"xmax"`
+	CId       uint32 `json:"cid"`
+	CTID      string `json:"ctid"`
+	Natts     int    `json:"natts"`
+	Hoff      byte   `json:"hoff"`
+	InfoMask  uint16 `json:"infomask"`
+	InfoMask2 uint16 `json:"infomask2"`
+	Oid       uint32 `json:"oid,omitempty"`        // pre-PG12 WITH OIDS only
+	Live      bool   `json:"live"`                 // by hint bits, see RowHeader.LooksLive
+	SpecToken uint32 `json:"spec_token,omitempty"` // speculative insertion token (never 0) when CTID is "(speculative)"
+	Lock      string `json:"lock,omitempty"`       // row lock held by xmax, see LockMode; empty for none
+}
+
+type TupleDump struct {
+	Page     int                   `json:"page"`
+	Offset   heappage.OffsetNumber `json:"offset"` // line pointer number, 1-based
+	State    string                `json:"state"`
+	Flags    byte                  `json:"flags"`
+	LpOff    uint16                `json:"lp_off"`
+	LpLen    uint16                `json:"lp_len"`
+	Redirect heappage.OffsetNumber `json:"redirect_to,omitempty"` // REDIRECT only: the line pointer it forwards to
+	Header   *TupleHeaderDump      `json:"header,omitempty"`
+	Columns  Columns               `json:"columns,omitempty"`
+	Trace    []heappage.AttrTrace  `json:"trace,omitempty"`   // -trace-offsets
+	Padding  []string              `json:"padding,omitempty"` // -check-padding: nonzero padding found
+	Error    string                `json:"error,omitempty"`
+}
+
+type ColumnValue struct {
+	Name    string
+	Value   any
+	Display string // text output only: the value as a display option shows it (-epoch-base, -locale), if it does
+}
+
+// Columns keeps decoded values in attribute order; it marshals to a JSON
+// object whose keys keep that order.
+type Columns []ColumnValue
+
+func (c Columns) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, cv := range c {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(cv.Name)
+		if err != nil {
+			return nil, err
+		}
+		val := cv.Value
+		if b, ok := val.([]byte); ok && decodeOptions.BinaryEncoding != "" {
+			val = heappage.FormatBytea(b, decodeOptions) // as asked, instead of encoding/json's base64
+		}
+		v, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func buildPageDump(p *heappage.Page) PageDump {
+	hdr := p.Header
+	return PageDump{
+		Page:            p.No,
+		LSN:             heappage.FormatLSN(hdr.XLogID, hdr.XRecOff),
+		XLogID:          hdr.XLogID,
+		XRecOff:         hdr.XRecOff,
+		Checksum:        hdr.PdChecksum,
+		Flags:           hdr.PdFlags,
+		Lower:           hdr.PdLower,
+		Upper:           hdr.PdUpper,
+		Special:         hdr.PdSpecial,
+		PagesizeVersion: hdr.PdPagesizeVersion,
+		PruneXID:        hdr.PdPruneXID,
+		Free:            int(hdr.PdUpper) - int(hdr.PdLower),
+		New:             heappage.PageIsNew(hdr),
+		LinePointers:    len(p.Items),
+	}
+}
+
+// buildTupleDump collects what is known about one line pointer. Only NORMAL
+// pointers get a header and decoded columns. A decoder panic is recorded as
+// the tuple's error, like any other decode failure.
+func buildTupleDump(pageNo int, page []byte, it heappage.ItemID, opts DumpOptions) (td TupleDump) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("recovered from panic", "page", pageNo, "lp", it.Index, "panic", r)
+			td.Error = fmt.Sprintf("decoder panic: %v", r)
+		}
+	}()
+	td = TupleDump{
+		Page:   pageNo,
+		Offset: it.Index,
+		State:  lpFlagNames[it.Flags&0x03],
+		Flags:  it.Flags,
+		LpOff:  it.LpOff,
+		LpLen:  it.LpLen,
+	}
+	if it.Flags == heappage.LP_REDIRECT {
+		td.Redirect = redirectTarget(it)
+	}
+	// LP_DEAD usually has no storage, but one set by pruning before the
+	// page is defragmented keeps lp_off/lp_len pointing at the old tuple
+	deadWithSpan := it.Flags == heappage.LP_DEAD && it.LpLen > 0
+	if it.Flags != heappage.LP_NORMAL && !(opts.IncludeDead && deadWithSpan) {
+		return td
+	}
+
+	start := int(it.LpOff)
+	end := start + int(it.LpLen)
+	if start >= end || end > len(page) {
+		td.Error = "tuple span out of page bounds"
+		return td
+	}
+	tuple := page[start:end]
+	rh, err := heappage.ParseRowHeader(tuple)
+	if err != nil {
+		td.Error = fmt.Sprintf("read row header: %v", err)
+		return td
+	}
+	td.Header = &TupleHeaderDump{
+		Xmin:      rh.Xmin,
+		Xmax:      rh.Xmax,
+		CId:       rh.CId,
+		CTID:      rh.CTIDLabel(),
+		Natts:     rh.Natts(),
+		Hoff:      rh.Hoff,
+		InfoMask:  rh.InfoMask,
+		InfoMask2: rh.InfoMask2,
+		Live:      rh.LooksLive(),
+	}
+	if m := heappage.LockMode(rh); m != "none" {
+		td.Header.Lock = m
+	}
+	if rh.IsSpeculative() {
+		td.Header.SpecToken = rh.SpeculativeToken()
+	}
+	if opts.WithOids {
+		td.Header.Oid, _ = rh.OldOid(tuple)
+	}
+	if opts.Schema != nil {
+		td.Columns, td.Trace, err = decodeColumns(tuple, rh, opts)
+		if err != nil {
+			td.Error = fmt.Sprintf("decode row: %v", err)
+		}
+		if opts.CheckPadding {
+			td.Padding = paddingProblems(tuple, rh, opts.Schema)
+		}
+	} else if opts.Demo {
+		row, err := decodeDemoRow(tuple, rh)
+		if err != nil {
+			td.Error = fmt.Sprintf("decode demo row: %v", err)
+		} else {
+			td.Columns = Columns{{Name: "id", Value: row.ID}, {Name: "name", Value: row.Name}}
+		}
+	}
+	return td
+}
+
+// DumpWriter is an output backend. WritePage is called once per page, then
+// WriteTuple for each of its line pointers; Finish flushes whatever the
+// writer buffered.
+type DumpWriter interface {
+	WritePage(PageDump) error
+	WriteTuple(TupleDump) error
+	Finish() error
+}
+
+// decodeColumns decodes a tuple with opts.Schema, restricted to opts.Attrs
+// when set. Values decoded before an error are still returned. The walk is
+// traced for -trace-offsets, and also for the display options, which work
+// from each datum's bytes; the trace is only returned for the former.
+func decodeColumns(tuple []byte, rh *heappage.RowHeader, opts DumpOptions) (Columns, []heappage.AttrTrace, error) {
+	var vals []any
+	var trace []heappage.AttrTrace
+	var err error
+	switch {
+	case opts.TraceOffsets || opts.rewritesDisplay():
+		// the trace needs the whole walk; -attrs only trims the columns
+		vals, trace, err = heappage.TraceRow(tuple, rh, opts.Schema, decodeOptions)
+		if opts.Attrs != nil {
+			all := vals
+			vals = make([]any, len(opts.Attrs))
+			for i, a := range opts.Attrs {
+				vals[i] = all[a-1]
+			}
+		}
+	case len(opts.Attrs) == 1:
+		// one key column: stop the walk right after it
+		var v any
+		v, err = heappage.DecodeAttr(tuple, rh, opts.Schema, opts.Attrs[0], decodeOptions)
+		vals = []any{v}
+	case opts.Attrs != nil:
+		vals, err = heappage.DecodeRowAttrs(tuple, rh, opts.Schema, opts.Attrs, decodeOptions)
+	default:
+		vals, err = heappage.DecodeRow(tuple, rh, opts.Schema, decodeOptions)
+	}
+	names := columnNames(opts)
+	cols := make(Columns, len(vals))
+	for i, v := range vals {
+		cols[i] = ColumnValue{Name: names[i], Value: v}
+		attno := i + 1
+		if opts.Attrs != nil {
+			attno = opts.Attrs[i]
+		}
+		if opts.rewritesDisplay() && attno <= len(trace) {
+			cols[i].Display = displayValue(tuple, &opts.Schema[attno-1], trace[attno-1], opts)
+		}
+	}
+	if !opts.TraceOffsets {
+		trace = nil
+	}
+	return cols, trace, err
+}
+
+// rewritesDisplay reports a display option that changes how text output
+// shows some values. Such options never touch the decoded values, so the
+// json, csv, sql and parquet exports stay loadable.
+func (o DumpOptions) rewritesDisplay() bool { return o.EpochBase || o.Locale != "" }
+
+// displayValue is how text output shows one attribute under the display
+// options, or "" to show the decoded value as is.
+func displayValue(tuple []byte, col *heappage.ColumnDef, a heappage.AttrTrace, opts DumpOptions) string {
+	if a.Null || a.Value == nil {
+		return ""
+	}
+	switch col.Type {
+	case heappage.TIMESTAMPOID, heappage.TIMESTAMPTZOID:
+		if opts.EpochBase && a.Len == 8 {
+			return heappage.EpochBaseDisplay(tuple, a.Off, a.Value, decodeOptions)
+		}
+	case heappage.NUMERICOID, heappage.CASHOID:
+		if opts.Locale != "" {
+			return heappage.LocaleDisplay(tuple, a.Off, col.Type, a.Value, opts.Locale)
+		}
+	}
+	return ""
+}
+
+// columnNames lists the decoded columns, for writers with a fixed layout.
+func columnNames(opts DumpOptions) []string {
+	if opts.Schema != nil {
+		if opts.Attrs == nil {
+			names := make([]string, len(opts.Schema))
+			for i, c := range opts.Schema {
+				names[i] = c.Name
+			}
+			return names
+		}
+		names := make([]string, len(opts.Attrs))
+		for i, a := range opts.Attrs {
+			names[i] = opts.Schema[a-1].Name
+		}
+		return names
+	}
+	if opts.Demo {
+		return []string{"id", "name"}
+	}
+	return nil
+}
+
+func newDumpWriter(w io.Writer, opts DumpOptions) (DumpWriter, error) {
+	switch opts.Format {
+	case "text":
+		tw := NewTextWriter(w)
+		tw.RawLSN = opts.RawLSN
+		tw.Explain = opts.Explain
+		tw.Expanded = opts.Expanded
+		tw.Color = opts.Color
+		if opts.Schema != nil {
+			tw.Label = "row"
+		}
+		return tw, nil
+	case "json":
+		return NewJSONWriter(w), nil
+	case "jsonl":
+		return NewJSONLWriter(w), nil
+	case "csv":
+		return NewCSVWriter(w, columnNames(opts)), nil
+	case "sql":
+		return NewSQLWriter(w, opts.Table, columnNames(opts)), nil
+	case "dot":
+		return NewDotWriter(w), nil
+	case "parquet":
+		return NewParquetWriter(w, parquetColumns(opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown -format %q", opts.Format)
+	}
+}
+
+// writePage feeds one loaded page to the writer. With opts.LiveOnly only
+// NORMAL line pointers are written, with opts.OnlyFlags only those flags.
+// Checksum and tuple problems are recorded in opts.Anomalies when it is set.
+func writePage(w DumpWriter, p *heappage.Page, opts DumpOptions) (err error) {
+	defer recoverPage(p.No, &err)
+	if !heappage.PageIsNew(p.Header) {
+		for _, prob := range checkPageBounds(p.Header, p.Items) {
+			if opts.Anomalies != nil {
+				opts.Anomalies.Add("bounds", "page %d: %s", p.No, prob)
+			} else {
+				logger.Warn("page bounds mismatch", "page", p.No, "problem", prob)
+			}
+		}
+		for _, prob := range checkRedirects(p.Raw, p.Items) {
+			if opts.Anomalies != nil {
+				opts.Anomalies.Add("redirect", "page %d: %s", p.No, prob)
+			} else {
+				logger.Warn("dangling redirect", "page", p.No, "problem", prob)
+			}
+		}
+	}
+	blkno := opts.BlockBase + uint32(p.No)
+	if opts.Anomalies != nil {
+		opts.Anomalies.checkPageChecksum(p, blkno)
+	} else if logger.Enabled(context.Background(), slog.LevelWarn) && !heappage.PageIsNew(p.Header) {
+		if ok, checked := heappage.VerifyChecksum(p.Raw, p.Header, blkno); checked && !ok {
+			logger.Warn("checksum mismatch", "page", p.No,
+				"stored", p.Header.PdChecksum, "computed", heappage.PageChecksum(p.Raw, blkno))
+		}
+	}
+	pd := buildPageDump(p)
+	if opts.OnlyFlags != 0 {
+		// the tuples shown are a subset; say what the page holds
+		pd.FlagCounts = make([]int, len(lpFlagNames))
+		for _, it := range p.Items {
+			pd.FlagCounts[it.Flags&0x03]++
+		}
+	}
+	if err := w.WritePage(pd); err != nil {
+		return err
+	}
+	for _, it := range p.Items {
+		if !opts.wantItem(it.Flags) {
+			continue
+		}
+		td := buildTupleDump(p.No, p.Raw, it, opts)
+		if td.Error != "" {
+			// already in the output; logged for those watching stderr only
+			logger.Debug("tuple not decoded", "page", p.No, "lp", it.Index, "err", td.Error)
+			// a dead tuple's storage may be partly reused; not an anomaly
+			if opts.Anomalies != nil && it.Flags == heappage.LP_NORMAL {
+				opts.Anomalies.Add("tuple", "page %d lp %d: %s", p.No, it.Index, td.Error)
+			}
+		}
+		if opts.Anomalies != nil {
+			for _, prob := range td.Padding {
+				opts.Anomalies.Add("padding", "page %d lp %d: %s", p.No, it.Index, prob)
+			}
+		}
+		if err := w.WriteTuple(td); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+	"github.com/ptflp/techinterview/2.db/heappage/heaptest"
+)
+
+// Each malformed tuple must cost only itself: an error on its line pointer,
+// never a panic or a failed page.
+func TestMalformedTuples(t *testing.T) {
+	quietLogger(t)
+	cols := []heappage.ColumnDef{heappage.Column("id", heappage.INT8OID), heappage.Column("tags", 1009), heappage.Column("name", heappage.TEXTOID)}
+	tuple := func(vals ...any) []byte { return heaptest.Tuple(t, cols, vals) }
+	withHeader := func(tup []byte, natts uint16, infomask uint16, hoff byte) []byte {
+		binary.LittleEndian.PutUint16(tup[18:], natts)
+		binary.LittleEndian.PutUint16(tup[20:], infomask)
+		tup[22] = hoff
+		return tup
+	}
+	tests := []struct {
+		name  string
+		tuple []byte
+		want  string // in the tuple's error; "" for none
+	}{
+		{"well-formed", tuple(int64(1), heaptest.TextArray("a"), "x"), ""},
+		{"bitmap past the tuple", withHeader(tuple(int64(1)), 2000, heappage.HEAP_HASNULL, 24), "unexpected EOF"},
+		{"hoff past lp_len", withHeader(tuple(int64(1)), 3, 0, 200), "hoff=200 outside tuple"},
+		{"varlena past the tuple", tuple(int64(1), nil, []byte{0x40, 0, 0, 0, 'x'}), `attr 3 "name"`},
+		{"array dataoffset negative", tuple(int64(1), heaptest.Varlena4(heaptest.Int32s(1, -8, int32(heappage.TEXTOID), 1, 1), heaptest.Varlena4([]byte("a")))), "dataoffset=-8"},
+		{"header truncated", make([]byte, 10), "read row header"},
+		{"span past the page", tuple(int64(1)), "tuple span out of page bounds"},
+	}
+	var tuples [][]byte
+	for _, tt := range tests {
+		tuples = append(tuples, tt.tuple)
+	}
+	page := heaptest.Page(t, 0, tuples...)
+	last := heappage.PageHeaderByteLen + (len(tests)-1)*heappage.ItemIDByteLen
+	binary.LittleEndian.PutUint32(page[last:], uint32(heappage.PageSize-8)|heappage.LP_NORMAL<<15|40<<17)
+	hdr, items, err := heappage.ParsePage(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []DumpOptions{
+		{Schema: cols, Format: "text"},
+		{Schema: cols, Format: "text", TraceOffsets: true},
+		{Schema: cols, Format: "text", Attrs: []int{3, 2}},
+		{Demo: true, Format: "text"},
+	} {
+		var rec recordingWriter
+		if err := writePage(&rec, &heappage.Page{Raw: page, Header: hdr, Items: items}, opts); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.tuples) != len(tests) {
+			t.Fatalf("%d tuples written, want %d", len(rec.tuples), len(tests))
+		}
+		for i, tt := range tests {
+			got := rec.tuples[i].Error
+			if strings.Contains(got, "panic") {
+				t.Errorf("%s: %s", tt.name, got)
+			}
+			if opts.Demo {
+				continue // the demo schema reads other columns
+			}
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("%s (%+v): error %q, want one containing %q", tt.name, opts.Attrs, got, tt.want)
+			}
+		}
+	}
+}
+
+// What the bounds checks miss is recovered: a panicking decoder becomes the
+// tuple's error and the rest of the page is still dumped.
+func TestDecoderPanicRecovered(t *testing.T) {
+	quietLogger(t)
+	const panicky heappage.Oid = 99999
+	if _, ok := heappage.LookupType(panicky); !ok { // RegisterType panics on a second -count
+		heappage.RegisterType(panicky, heappage.TypeInfo{Name: "panicky", Len: 4, Align: 'i', Decode: func(buf []byte, off int, _ *heappage.Options) (any, int, error) {
+			if buf[off] == 0xff {
+				panic("bad datum")
+			}
+			return int32(binary.LittleEndian.Uint32(buf[off:])), off + 4, nil
+		}})
+	}
+	cols := []heappage.ColumnDef{heappage.Column("id", heappage.INT8OID), heappage.Column("p", panicky)}
+	page := heaptest.Page(t, 0,
+		heaptest.Tuple(t, cols, []any{int64(1), int32(-1)}),
+		heaptest.Tuple(t, cols, []any{int64(2), int32(2)}),
+	)
+	hdr, items, err := heappage.ParsePage(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec recordingWriter
+	if err := writePage(&rec, &heappage.Page{Raw: page, Header: hdr, Items: items}, DumpOptions{Schema: cols, Format: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.tuples) != 2 || rec.tuples[0].Error != "decoder panic: bad datum" || rec.tuples[1].Error != "" {
+		t.Errorf("tuples %+v", rec.tuples)
+	}
+}
+
+func TestRecoverPage(t *testing.T) {
+	quietLogger(t)
+	err := func() (err error) {
+		defer recoverPage(3, &err)
+		var b []byte
+		_ = b[1]
+		return nil
+	}()
+	var pe *heappage.PageError
+	if !errors.As(err, &pe) || pe.PageNo != 3 || pe.Stage != "decode" || !strings.Contains(pe.Err.Error(), "index out of range") {
+		t.Errorf("err = %#v", err)
+	}
+}
+
+// -attrs with one attribute goes through DecodeAttr, with more through
+// DecodeRowAttrs; both must agree with the full row.
+func TestDecodeColumnsAttrs(t *testing.T) {
+	cols := []heappage.ColumnDef{
+		heappage.Column("id", heappage.INT8OID), heappage.Column("name", heappage.TEXTOID), heappage.Column("flag", heappage.BOOLOID), heappage.Column("n", heappage.INT4OID),
+		heappage.Column("note", heappage.TEXTOID), heappage.Column("small", heappage.INT2OID), heappage.Column("total", heappage.INT8OID),
+	}
+	tup := heaptest.Tuple(t, cols, []any{int64(5), "abc", nil, int32(8), "yz", int16(1), int64(6)})
+	rh := heaptest.RowHeader(t, tup)
+	tests := []struct {
+		attrs []int
+		want  []any
+	}{
+		{[]int{5}, []any{"yz"}},
+		{[]int{3}, []any{nil}},
+		{[]int{7, 2}, []any{int64(6), "abc"}},
+	}
+	for _, tt := range tests {
+		vals, _, err := decodeColumns(tup, rh, DumpOptions{Schema: cols, Attrs: tt.attrs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []any
+		for _, c := range vals {
+			got = append(got, c.Value)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("-attrs %v: got %#v, want %#v", tt.attrs, got, tt.want)
+		}
+	}
+}
+
+// A tuple whose t_hoff reaches lp_len has no data bytes at all: a
+// zero-column row, or a hand-built one with every column NULL and no bitmap.
+// Its attributes read as NULL; a t_hoff outside the tuple stays an error.
+func TestDecodeHeaderOnlyTuple(t *testing.T) {
+	header := func(natts uint16, hoff byte) []byte {
+		tup := make([]byte, heappage.RowHeaderByteLen+1) // padded to MAXALIGN
+		binary.LittleEndian.PutUint32(tup[0:], 100)
+		binary.LittleEndian.PutUint16(tup[16:], 1)
+		binary.LittleEndian.PutUint16(tup[18:], natts)
+		binary.LittleEndian.PutUint16(tup[20:], heappage.HEAP_XMIN_COMMITTED|heappage.HEAP_XMAX_INVALID)
+		tup[22] = hoff
+		return tup
+	}
+	tests := []struct {
+		name    string
+		tuple   []byte
+		wantErr bool
+	}{
+		{"zero columns", header(0, 24), false},
+		{"natts without data", header(2, 24), false},
+		{"hoff past lp_len", header(2, 32), true},
+		{"hoff inside the header", header(2, 16), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := heaptest.RowHeader(t, tt.tuple)
+			row, err := heappage.DecodeRow(tt.tuple, rh, demoColumns, nil)
+			_, derr := decodeDemoRow(tt.tuple, rh)
+			_, trace, terr := heappage.TraceRow(tt.tuple, rh, demoColumns, nil)
+			attr, aerr := heappage.DecodeAttr(tt.tuple, rh, demoColumns, 2, nil)
+			if tt.wantErr {
+				if err == nil || derr == nil || terr == nil || aerr == nil {
+					t.Errorf("errors: DecodeRow %v, decodeDemoRow %v, TraceRow %v, DecodeAttr %v", err, derr, terr, aerr)
+				}
+				return
+			}
+			for _, err := range []error{err, derr, terr, aerr} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(row, []any{nil, nil}) || attr != nil {
+				t.Errorf("DecodeRow = %#v, DecodeAttr = %#v, want all NULL", row, attr)
+			}
+			if len(trace) != 2 || !trace[0].Null || !trace[1].Null {
+				t.Errorf("trace %+v, want two NULL attributes", trace)
+			}
+		})
+	}
+
+	// on a page the tuple decodes without a tuple error
+	page := heaptest.Page(t, 0, header(0, 24))
+	hdr, items, err := heappage.ParsePage(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec recordingWriter
+	if err := writePage(&rec, &heappage.Page{Raw: page, Header: hdr, Items: items}, DumpOptions{Demo: true, Format: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.tuples) != 1 || rec.tuples[0].Error != "" {
+		t.Errorf("tuples %+v, want one without an error", rec.tuples)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+// Padding check (-check-padding). heap_fill_tuple zeroes the alignment
+// padding it skips (the tuple is palloc0'd), so a nonzero byte there is
+// either damage or, far more often, a schema that puts an attribute at the
+// wrong offset: an alignment gap where the real layout has data.
+
+import (
+	"fmt"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// paddingProblems walks tuple with cols and describes every padding region
+// holding a nonzero byte: the gap between the null bitmap (or oid) and
+// t_hoff, and the alignment padding before each attribute. The walk stops
+// at the first attribute that cannot be measured.
+func paddingProblems(tuple []byte, rh *heappage.RowHeader, cols []heappage.ColumnDef) []string {
+	var probs []string
+	check := func(from, to int, what string) {
+		for i := from; i < to && i < len(tuple); i++ {
+			if tuple[i] != 0 {
+				probs = append(probs, fmt.Sprintf("nonzero byte 0x%02x at %d in %s", tuple[i], i, what))
+				return
+			}
+		}
+	}
+
+	hdrEnd := heappage.RowHeaderByteLen
+	if rh.HasNull() {
+		hdrEnd += (rh.Natts() + 7) / 8
+	}
+	if rh.InfoMask&heappage.HEAP_HASOID_OLD != 0 {
+		hdrEnd += 4
+	}
+	check(hdrEnd, int(rh.Hoff), "header padding before t_hoff")
+
+	heappage.WalkRow(tuple, rh, cols, len(cols), func(i, off, pad int, col *heappage.ColumnDef) (int, error) {
+		if pad > 0 {
+			before := len(probs)
+			check(off-pad, off, fmt.Sprintf("padding before attr %d %q", i+1, col.Name))
+			if len(probs) > before {
+				probs[len(probs)-1] += "; the schema likely misplaces this or an earlier attribute"
+			}
+		}
+		return heappage.SkipAttr(tuple, off, col)
+	})
+	return probs
+}
@@ -0,0 +1,201 @@
+package main
+
+// -format-in pageinspect: decode the output of
+//
+//	SELECT * FROM heap_page_items(get_raw_page('t', 0));
+//
+// as psql prints it (aligned, or -A unaligned), for when the page itself
+// cannot be had but that output was pasted into an issue. Each row's header
+// columns and t_data are put back together into a tuple, which then goes
+// through the same decoder as a tuple on a page.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// pageinspectItem is one row of heap_page_items: the line pointer and, for
+// a NORMAL one, the tuple rebuilt from its columns.
+type pageinspectItem struct {
+	heappage.ItemID
+	tuple []byte
+}
+
+// heap_page_items columns a NORMAL row cannot be decoded without; lp_off,
+// lp_flags, lp_len, t_field3, t_bits and t_oid may be left out.
+var pageinspectRequired = []string{"lp", "t_xmin", "t_xmax", "t_ctid", "t_infomask2", "t_infomask", "t_hoff", "t_data"}
+
+// readPageinspect parses heap_page_items output. The header line names the
+// columns, so their order and a SELECT of only some of them do not matter;
+// the ---+--- rule, "(N rows)" footers and blank lines are skipped.
+func readPageinspect(r io.Reader) ([]pageinspectItem, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 4*heappage.PageSize) // t_data as \x hex, plus the other columns
+	var cols map[string]int
+	var items []pageinspectItem
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "(") && strings.HasSuffix(line, ")") ||
+			strings.Trim(line, "-+") == "" {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if cols == nil {
+			if fields[0] != "lp" {
+				return nil, fmt.Errorf("line %d: want the heap_page_items header (lp | lp_off | ...), got %q", n, line)
+			}
+			cols = map[string]int{}
+			for i, f := range fields {
+				cols[f] = i
+			}
+			for _, c := range pageinspectRequired {
+				if _, ok := cols[c]; !ok {
+					return nil, fmt.Errorf("line %d: no %s column", n, c)
+				}
+			}
+			continue
+		}
+		if len(fields) != len(cols) {
+			return nil, fmt.Errorf("line %d: %d columns, the header has %d", n, len(fields), len(cols))
+		}
+		it, err := parsePageinspectRow(func(name string) string {
+			if i, ok := cols[name]; ok {
+				return fields[i]
+			}
+			return ""
+		})
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		items = append(items, it)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if cols == nil {
+		return nil, fmt.Errorf("no heap_page_items header found")
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no heap_page_items rows after the header")
+	}
+	return items, nil
+}
+
+// parsePageinspectRow rebuilds one item. Empty columns are NULL, which is
+// what heap_page_items returns for the tuple columns of a non-NORMAL line
+// pointer.
+func parsePageinspectRow(col func(string) string) (pageinspectItem, error) {
+	var it pageinspectItem
+	var err error
+	num := func(name string, bits int) uint64 {
+		s := col(name)
+		if s == "" || err != nil {
+			return 0
+		}
+		v, perr := strconv.ParseUint(s, 10, bits)
+		if perr != nil {
+			err = fmt.Errorf("%s: %w", name, perr)
+		}
+		return v
+	}
+	it.Index = heappage.OffsetNumber(num("lp", 16))
+	it.LpOff = uint16(num("lp_off", 15))
+	it.LpLen = uint16(num("lp_len", 15))
+	it.Flags = byte(num("lp_flags", 2))
+	if col("lp_flags") == "" && col("t_xmin") != "" {
+		it.Flags = heappage.LP_NORMAL
+	}
+	if err != nil || it.Flags != heappage.LP_NORMAL {
+		return it, err
+	}
+
+	var ctid heappage.ItemPointer
+	if _, serr := fmt.Sscanf(col("t_ctid"), "(%d,%d)", &ctid.Block, &ctid.Offset); serr != nil {
+		return it, fmt.Errorf("t_ctid %q: %w", col("t_ctid"), serr)
+	}
+	rh := heappage.RowHeader{
+		Xmin:       uint32(num("t_xmin", 32)),
+		Xmax:       uint32(num("t_xmax", 32)),
+		CId:        uint32(num("t_field3", 32)),
+		CTIDOffset: ctid.Offset,
+		InfoMask2:  uint16(num("t_infomask2", 16)),
+		InfoMask:   uint16(num("t_infomask", 16)),
+		Hoff:       byte(num("t_hoff", 8)),
+	}
+	rh.CTIDBlockHi, rh.CTIDBlockLo = ctid.BlockID()
+	oid := uint32(num("t_oid", 32))
+	if err != nil {
+		return it, err
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(col("t_data"), `\x`))
+	if err != nil {
+		return it, fmt.Errorf("t_data: %w", err)
+	}
+	if int(rh.Hoff) < heappage.RowHeaderByteLen || int(rh.Hoff)+len(data) > heappage.PageSize {
+		return it, fmt.Errorf("t_hoff=%d with %d bytes of t_data does not make a tuple", rh.Hoff, len(data))
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &rh)
+	tuple := make([]byte, int(rh.Hoff)+len(data))
+	copy(tuple, buf.Bytes())
+	// t_bits is bits_to_text: one '0'/'1' per bit, LSB of each byte first
+	for i, c := range col("t_bits") {
+		if c != '0' && c != '1' {
+			return it, fmt.Errorf("t_bits: %q is not 0 or 1", c)
+		}
+		at := heappage.RowHeaderByteLen + i/8
+		if at >= int(rh.Hoff) {
+			return it, fmt.Errorf("t_bits: %d bits do not fit before t_hoff=%d", len(col("t_bits")), rh.Hoff)
+		}
+		if c == '1' {
+			tuple[at] |= 1 << (i % 8)
+		}
+	}
+	if col("t_oid") != "" && rh.InfoMask&heappage.HEAP_HASOID_OLD != 0 && int(rh.Hoff) >= heappage.RowHeaderByteLen+4 {
+		binary.LittleEndian.PutUint32(tuple[rh.Hoff-4:], oid)
+	}
+	copy(tuple[rh.Hoff:], data)
+	it.tuple = tuple
+	return it, nil
+}
+
+// dumpPageinspect decodes every item as if it sat on page pageNo, and writes
+// them without page output like -tuple-hex. lp_off and lp_len are reported
+// as pasted.
+func dumpPageinspect(items []pageinspectItem, pageNo int, opts DumpOptions) error {
+	w, err := newDumpWriter(os.Stdout, opts)
+	if err != nil {
+		return err
+	}
+	for _, pi := range items {
+		if !opts.wantItem(pi.Flags) {
+			continue
+		}
+		it := pi.ItemID
+		if pi.tuple != nil {
+			it.LpOff, it.LpLen = 0, uint16(len(pi.tuple))
+		}
+		td := buildTupleDump(pageNo, pi.tuple, it, opts)
+		td.LpOff, td.LpLen = pi.LpOff, pi.LpLen
+		if td.Error != "" && opts.Anomalies != nil {
+			opts.Anomalies.Add("tuple", "lp %d: %s", pi.Index, td.Error)
+		}
+		if err := w.WriteTuple(td); err != nil {
+			return err
+		}
+	}
+	return w.Finish()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// The fixtures are heap_page_items of the sample page as psql prints it,
+// aligned and with -A, followed by a redirect, a dead and an unused line
+// pointer like the ones pruning leaves, whose tuple columns are NULL.
+func TestReadPageinspect(t *testing.T) {
+	page, err := os.ReadFile("57344")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, lps, err := heappage.ParsePage(page[:heappage.PageSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"testdata/heap_page_items.txt", "testdata/heap_page_items_unaligned.txt"} {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			items, err := readPageinspect(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 7 {
+				t.Fatalf("%d items, want 7", len(items))
+			}
+			// the NORMAL rows rebuild the tuples on the page byte for byte
+			for i, lp := range lps {
+				want := page[lp.LpOff : lp.LpOff+lp.LpLen]
+				if it := items[i]; it.ItemID != lp || !bytes.Equal(it.tuple, want) {
+					t.Errorf("lp %d: %+v % x\nwant %+v % x", i+1, it.ItemID, it.tuple, lp, want)
+				}
+			}
+			for i, want := range []heappage.ItemID{
+				{Index: 5, LpOff: 4, Flags: heappage.LP_REDIRECT},
+				{Index: 6, Flags: heappage.LP_DEAD},
+				{Index: 7, Flags: heappage.LP_UNUSED},
+			} {
+				if it := items[4+i]; it.ItemID != want || it.tuple != nil {
+					t.Errorf("lp %d: %+v, tuple %x; want %+v and no tuple", want.Index, it.ItemID, it.tuple, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadPageinspectErrors(t *testing.T) {
+	const header = "lp|lp_off|lp_flags|lp_len|t_xmin|t_xmax|t_field3|t_ctid|t_infomask2|t_infomask|t_hoff|t_bits|t_oid|t_data\n"
+	tests := []struct {
+		name, in, want string
+	}{
+		{"no header", "", "no heap_page_items header"},
+		{"not the header", "id|name\n1|a\n", "want the heap_page_items header"},
+		{"no t_data", "lp|t_xmin|t_xmax|t_ctid|t_infomask2|t_infomask|t_hoff\n", "no t_data column"},
+		{"no rows", header + "(0 rows)\n", "no heap_page_items rows"},
+		{"column count", header + "1|8152|1\n", "3 columns, the header has 14"},
+		{"bad ctid", header + "1|8152|1|26|100|0|0|0,1|1|2048|24|||\\x01000000\n", "t_ctid"},
+		{"bad t_data", header + "1|8152|1|26|100|0|0|(0,1)|1|2048|24|||\\x0g\n", "t_data"},
+		{"t_hoff", header + "1|8152|1|26|100|0|0|(0,1)|1|2048|8|||\\x01000000\n", "t_hoff=8"},
+		{"t_bits", header + "1|8152|1|26|100|0|0|(0,1)|1|2049|24|12||\\x01000000\n", "not 0 or 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readPageinspect(strings.NewReader(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+}
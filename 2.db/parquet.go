@@ -0,0 +1,397 @@
+package main
+
+// -format parquet: live tuples as an Apache Parquet file, for loading
+// recovered data into DuckDB, pandas or Spark without going through SQL.
+// The writer is a small one of its own rather than the Arrow library: one
+// row group, one uncompressed PLAIN data page per column, every column
+// OPTIONAL so that NULLs go into the definition levels. That is the subset
+// every reader accepts, and what a page or a recovered table needs.
+//
+// Types map by oid: bool, int2/int4, int8, float4/float8 and bytea keep
+// their Parquet counterparts, oid/xid/cid become INT64 and everything else
+// is written as UTF8 text the way -format text prints it.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// Parquet physical types, repetition, encodings and converted types
+// (parquet.thrift)
+const (
+	pqBoolean   = 0
+	pqInt32     = 1
+	pqInt64     = 2
+	pqFloat     = 4
+	pqDouble    = 5
+	pqByteArray = 6
+
+	pqOptional = 1
+
+	pqPlain = 0
+	pqRLE   = 3
+
+	pqConvNone   = -1
+	pqConvUTF8   = 0
+	pqConvInt16  = 16
+	pqConvUint64 = 14
+)
+
+type parquetColumn struct {
+	name      string
+	phys      int32
+	conv      int32
+	defLevels []byte       // 1 present, 0 NULL; one per row
+	values    bytes.Buffer // PLAIN-encoded present values
+	bools     []bool       // BOOLEAN values, bit-packed on Finish
+}
+
+// ParquetWriter buffers the rows of the whole dump in memory, one column at
+// a time, and writes the file on Finish.
+type ParquetWriter struct {
+	w    io.Writer
+	cols []*parquetColumn
+	rows int
+}
+
+// NewParquetWriter writes one column per entry of cols.
+func NewParquetWriter(w io.Writer, cols []heappage.ColumnDef) *ParquetWriter {
+	p := &ParquetWriter{w: w}
+	for _, c := range cols {
+		pc := &parquetColumn{name: c.Name, conv: pqConvNone}
+		switch c.Type {
+		case heappage.BOOLOID:
+			pc.phys = pqBoolean
+		case heappage.INT2OID:
+			pc.phys, pc.conv = pqInt32, pqConvInt16
+		case heappage.INT4OID:
+			pc.phys = pqInt32
+		case heappage.INT8OID, heappage.OIDOID, heappage.XIDOID, heappage.CIDOID:
+			pc.phys = pqInt64
+		case heappage.XID8OID:
+			pc.phys, pc.conv = pqInt64, pqConvUint64
+		case heappage.FLOAT4OID:
+			pc.phys = pqFloat
+		case heappage.FLOAT8OID:
+			pc.phys = pqDouble
+		case heappage.BYTEAOID:
+			pc.phys = pqByteArray
+		default:
+			pc.phys, pc.conv = pqByteArray, pqConvUTF8
+		}
+		p.cols = append(p.cols, pc)
+	}
+	return p
+}
+
+// parquetColumns lists the columns -format parquet writes: the schema, cut
+// down to -attrs, or the demo columns.
+func parquetColumns(opts DumpOptions) []heappage.ColumnDef {
+	switch {
+	case opts.Schema != nil && opts.Attrs != nil:
+		cols := make([]heappage.ColumnDef, len(opts.Attrs))
+		for i, a := range opts.Attrs {
+			cols[i] = opts.Schema[a-1]
+		}
+		return cols
+	case opts.Schema != nil:
+		return opts.Schema
+	case opts.Demo:
+		return demoColumns
+	}
+	return nil
+}
+
+func (p *ParquetWriter) WritePage(PageDump) error { return nil }
+
+// WriteTuple adds a row for a live, cleanly decoded tuple and skips
+// everything else, like -format sql.
+func (p *ParquetWriter) WriteTuple(td TupleDump) error {
+	if td.Header == nil || !td.Header.Live || td.Error != "" {
+		return nil
+	}
+	for i, pc := range p.cols {
+		var v any
+		if i < len(td.Columns) {
+			v = td.Columns[i].Value
+		}
+		if err := pc.add(v); err != nil {
+			return fmt.Errorf("page %d lp %d: column %q: %w", td.Page, td.Offset, pc.name, err)
+		}
+	}
+	p.rows++
+	return nil
+}
+
+// add appends one value, PLAIN-encoded for the column's physical type.
+func (pc *parquetColumn) add(v any) error {
+	if v == nil {
+		pc.defLevels = append(pc.defLevels, 0)
+		return nil
+	}
+	var le [8]byte
+	switch pc.phys {
+	case pqBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("decoded %T, want bool", v)
+		}
+		pc.bools = append(pc.bools, b)
+	case pqInt32:
+		var n int32
+		switch x := v.(type) {
+		case int16:
+			n = int32(x)
+		case int32:
+			n = x
+		default:
+			return fmt.Errorf("decoded %T, want an integer", v)
+		}
+		binary.LittleEndian.PutUint32(le[:], uint32(n))
+		pc.values.Write(le[:4])
+	case pqInt64:
+		var n uint64
+		switch x := v.(type) {
+		case int64:
+			n = uint64(x)
+		case uint64:
+			n = x
+		case uint32:
+			n = uint64(x)
+		case heappage.Oid:
+			n = uint64(x)
+		default:
+			return fmt.Errorf("decoded %T, want an integer", v)
+		}
+		binary.LittleEndian.PutUint64(le[:], n)
+		pc.values.Write(le[:])
+	case pqFloat:
+		f, ok := v.(float32)
+		if !ok {
+			return fmt.Errorf("decoded %T, want float32", v)
+		}
+		binary.LittleEndian.PutUint32(le[:], math.Float32bits(f))
+		pc.values.Write(le[:4])
+	case pqDouble:
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("decoded %T, want float64", v)
+		}
+		binary.LittleEndian.PutUint64(le[:], math.Float64bits(f))
+		pc.values.Write(le[:])
+	case pqByteArray:
+		var b []byte
+		switch x := v.(type) {
+		case []byte:
+			b = x
+		case string:
+			b = []byte(x)
+		default:
+			b = []byte(heappage.FormatValue(x, decodeOptions))
+		}
+		binary.LittleEndian.PutUint32(le[:], uint32(len(b)))
+		pc.values.Write(le[:4])
+		pc.values.Write(b)
+	}
+	pc.defLevels = append(pc.defLevels, 1)
+	return nil
+}
+
+// pageData returns the column's data page body: the definition levels as
+// length-prefixed RLE runs (bit width 1), then the values.
+func (pc *parquetColumn) pageData() []byte {
+	var levels []byte
+	for i := 0; i < len(pc.defLevels); {
+		j := i
+		for j < len(pc.defLevels) && pc.defLevels[j] == pc.defLevels[i] {
+			j++
+		}
+		levels = binary.AppendUvarint(levels, uint64(j-i)<<1)
+		levels = append(levels, pc.defLevels[i])
+		i = j
+	}
+	out := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	out = append(out, levels...)
+	if pc.phys == pqBoolean {
+		packed := make([]byte, (len(pc.bools)+7)/8)
+		for i, b := range pc.bools {
+			if b {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append(out, packed...)
+	}
+	return append(out, pc.values.Bytes()...)
+}
+
+func (p *ParquetWriter) Finish() error {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	type chunk struct {
+		offset, size int64
+	}
+	chunks := make([]chunk, len(p.cols))
+	var total int64
+	if p.rows > 0 {
+		for i, pc := range p.cols {
+			data := pc.pageData()
+			var h thriftWriter
+			h.begin()
+			h.i32(1, 0) // DATA_PAGE
+			h.i32(2, int32(len(data)))
+			h.i32(3, int32(len(data)))
+			h.structField(5) // DataPageHeader
+			h.i32(1, int32(p.rows))
+			h.i32(2, pqPlain)
+			h.i32(3, pqRLE)
+			h.i32(4, pqRLE)
+			h.end()
+			h.end()
+			chunks[i] = chunk{int64(file.Len()), int64(len(h.buf) + len(data))}
+			total += chunks[i].size
+			file.Write(h.buf)
+			file.Write(data)
+		}
+	}
+
+	var m thriftWriter
+	m.begin()
+	m.i32(1, 1) // version
+	m.list(2, thriftStruct, len(p.cols)+1)
+	m.begin()
+	m.str(4, "schema")
+	m.i32(5, int32(len(p.cols)))
+	m.end()
+	for _, pc := range p.cols {
+		m.begin()
+		m.i32(1, pc.phys)
+		m.i32(3, pqOptional)
+		m.str(4, pc.name)
+		if pc.conv != pqConvNone {
+			m.i32(6, pc.conv)
+		}
+		m.end()
+	}
+	m.i64(3, int64(p.rows))
+	groups := 0
+	if p.rows > 0 {
+		groups = 1
+	}
+	m.list(4, thriftStruct, groups)
+	if groups > 0 {
+		m.begin()
+		m.list(1, thriftStruct, len(p.cols))
+		for i, pc := range p.cols {
+			m.begin()
+			m.i64(2, chunks[i].offset)
+			m.structField(3) // ColumnMetaData
+			m.i32(1, pc.phys)
+			m.list(2, thriftI32, 2)
+			m.listI32(pqPlain)
+			m.listI32(pqRLE)
+			m.list(3, thriftBinary, 1)
+			m.listStr(pc.name)
+			m.i32(4, 0) // UNCOMPRESSED
+			m.i64(5, int64(p.rows))
+			m.i64(6, chunks[i].size)
+			m.i64(7, chunks[i].size)
+			m.i64(9, chunks[i].offset)
+			m.end()
+			m.end()
+		}
+		m.i64(2, total)
+		m.i64(3, int64(p.rows))
+		m.end()
+	}
+	m.str(6, "pgheapdump")
+	m.end()
+
+	file.Write(m.buf)
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(m.buf))))
+	file.WriteString("PAR1")
+	_, err := p.w.Write(file.Bytes())
+	return err
+}
+
+// -------- Thrift compact protocol, as much as the Parquet footer needs --------
+
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol. begin opens
+// a struct (top level, or an element of a struct list) and end closes it;
+// field ids are written as deltas from the previous field of the same
+// struct.
+type thriftWriter struct {
+	buf  []byte
+	last []int // last field id of each open struct
+}
+
+func (t *thriftWriter) begin() { t.last = append(t.last, 0) }
+
+func (t *thriftWriter) end() {
+	t.buf = append(t.buf, 0) // STOP
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) field(id int, typ byte) {
+	top := &t.last[len(t.last)-1]
+	if d := id - *top; d > 0 && d <= 15 {
+		t.buf = append(t.buf, byte(d)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	*top = id
+}
+
+func (t *thriftWriter) i32(id int, v int32) {
+	t.field(id, thriftI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64(id int, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) str(id int, s string) {
+	t.field(id, thriftBinary)
+	t.listStr(s)
+}
+
+// structField starts a struct-valued field; close it with end.
+func (t *thriftWriter) structField(id int) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// list starts a list field of n elements, written next with listI32,
+// listStr or begin/end.
+func (t *thriftWriter) list(id int, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elem)
+	t.buf = binary.AppendUvarint(t.buf, uint64(n))
+}
+
+func (t *thriftWriter) listI32(v int32) { t.buf = binary.AppendVarint(t.buf, int64(v)) }
+
+func (t *thriftWriter) listStr(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
@@ -0,0 +1,78 @@
+package main
+
+// Progress reporting for whole-relation scans: percentage and ETA written
+// to stderr at most every progressInterval, only when stderr is a terminal.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+const progressInterval = 500 * time.Millisecond
+
+type Progress struct {
+	w     io.Writer
+	total int
+	start time.Time
+	last  time.Time
+}
+
+func NewProgress(w io.Writer, total int) *Progress {
+	now := time.Now()
+	return &Progress{w: w, total: total, start: now, last: now}
+}
+
+// isTerminal reports whether f is a character device (a TTY).
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// newScanProgress returns a reporter for a scan of total pages, or nil when
+// progress output is suppressed (-quiet, or stderr is not a TTY).
+func newScanProgress(total int, opts DumpOptions) *Progress {
+	if opts.Quiet || !isTerminal(os.Stderr) {
+		return nil
+	}
+	return NewProgress(os.Stderr, total)
+}
+
+// Tick records that done pages are processed and redraws the progress
+// line if the interval has passed.
+func (p *Progress) Tick(done int) {
+	now := time.Now()
+	if now.Sub(p.last) < progressInterval || p.total == 0 {
+		return
+	}
+	p.last = now
+	pct := float64(done) * 100 / float64(p.total)
+	eta := "?"
+	if done > 0 {
+		remaining := time.Duration(float64(now.Sub(p.start)) / float64(done) * float64(p.total-done))
+		eta = remaining.Round(time.Second).String()
+	}
+	fmt.Fprintf(p.w, "\r%5.1f%% (%d/%d pages) ETA %s   ", pct, done, p.total, eta)
+}
+
+// Done clears the progress line.
+func (p *Progress) Done() {
+	fmt.Fprintf(p.w, "\r%60s\r", "")
+}
+
+// withProgress wraps a PageFunc so that p is ticked after each page; a nil p
+// returns fn unchanged.
+func withProgress(p *Progress, fn heappage.PageFunc) heappage.PageFunc {
+	if p == nil {
+		return fn
+	}
+	done := 0 // pages seen; not pg.No+1, the scan may not start at 0
+	return func(pg *heappage.Page, err error) error {
+		done++
+		defer p.Tick(done)
+		return fn(pg, err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+// -raw-itemids: show the on-disk ItemIdData words next to the decoded
+// 15/2/15-bit fields, to make the flag bit-splitting visible.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+var lpFlagNames = [4]string{
+	heappage.LP_UNUSED:   "UNUSED",
+	heappage.LP_NORMAL:   "NORMAL",
+	heappage.LP_REDIRECT: "REDIRECT",
+	heappage.LP_DEAD:     "DEAD",
+}
+
+// ParseLPFlags parses a comma list of line pointer flag names, in any case,
+// into a mask with bit 1<<flag set for each.
+func ParseLPFlags(spec string) (uint8, error) {
+	var mask uint8
+	for _, part := range strings.Split(spec, ",") {
+		name := strings.ToUpper(strings.TrimSpace(part))
+		i := slices.Index(lpFlagNames[:], name)
+		if i < 0 {
+			return 0, fmt.Errorf("unknown line pointer flag %q (want unused, normal, redirect or dead)", part)
+		}
+		mask |= 1 << i
+	}
+	return mask, nil
+}
+
+func dumpRawItemIDs(filePath string, pageNo int) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	page, hdr, itemIDs, err := heappage.LoadPage(f, pageNo)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("== Page %d raw line pointers (pd_lower=%d) ==\n", pageNo, hdr.PdLower)
+	fmt.Printf("       raw lp_off  raw lp_len  | off15 = w0&0x7FFF  len15 = w1>>1  flags = (w0>>15) | (w1&1)<<1\n")
+	for i, it := range itemIDs {
+		at := heappage.PageHeaderByteLen + i*heappage.ItemIDByteLen
+		w0 := binary.LittleEndian.Uint16(page[at : at+2])
+		w1 := binary.LittleEndian.Uint16(page[at+2 : at+4])
+		fmt.Printf(" [%2d]  0x%04x      0x%04x      | off=%4d  len=%4d  flags=%d (%d|%d<<1) %s\n",
+			it.Index, w0, w1, it.LpOff, it.LpLen, it.Flags, w0>>15, w1&1, lpFlagNames[it.Flags&0x03])
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ptflp/techinterview/2.db/heappage/heaptest"
+)
+
+// Relation files are only ever opened for reading: a write through the
+// handle fails and leaves the file as it was.
+func TestOpenRelationReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "16384")
+	page := make([]byte, 8192)
+	if err := os.WriteFile(path, page, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rel, err := openRelation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rel.Close()
+	if w, ok := rel.(io.Writer); ok {
+		if _, err := w.Write([]byte{0xff}); err == nil {
+			t.Error("write through openRelation succeeded")
+		}
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, page) {
+		t.Errorf("file changed: %v", err)
+	}
+}
+
+// rangeServer serves file with Range support, recording the Range header of
+// each request.
+func rangeServer(t *testing.T, file []byte) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(file))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ranges...)
+	}
+}
+
+// A relation behind a URL is read with one Range request per read: the
+// probe for its size, then only the bytes asked for.
+func TestHTTPRelation(t *testing.T) {
+	file := concat(heaptest.Page(t, 0), heaptest.Page(t, 1), heaptest.Page(t, 2))
+	file[8192+100] = 0xAB
+	srv, ranges := rangeServer(t, file)
+
+	rel, err := openRelation(srv.URL + "/16384")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rel.Close()
+	if size, err := rel.Size(); size != int64(len(file)) || err != nil {
+		t.Errorf("Size() = %d, %v; want %d", size, err, len(file))
+	}
+	if n, err := relationPages(rel); n != 3 || err != nil {
+		t.Errorf("relationPages = %d, %v; want 3", n, err)
+	}
+
+	page := make([]byte, 8192)
+	if n, err := rel.ReadAt(page, 8192); n != 8192 || err != nil || !bytes.Equal(page, file[8192:16384]) {
+		t.Errorf("page 1: %d bytes, %v", n, err)
+	}
+	// a read running past the end gets what there is and io.EOF
+	if n, err := rel.ReadAt(page, int64(len(file))-100); n != 100 || err != io.EOF {
+		t.Errorf("read past the end: %d bytes, %v; want 100, EOF", n, err)
+	}
+	if n, err := rel.ReadAt(page, int64(len(file))); n != 0 || err != io.EOF {
+		t.Errorf("read at the end: %d bytes, %v; want 0, EOF", n, err)
+	}
+
+	want := []string{"bytes=0-0", "bytes=8192-16383", "bytes=24476-32667"}
+	if got := ranges(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("requests %q, want %q", got, want)
+	}
+}
+
+func TestHTTPRelationServerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{"range ignored", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(make([]byte, 8192))
+		}, "does not support HTTP range requests"},
+		{"no size", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes 0-0/*")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte{0})
+		}, "no object size"},
+		{"bad size", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes 0-0/8k")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte{0})
+		}, "bad Content-Range"},
+		{"not found", func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}, "GET bytes=0-0: 404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			_, err := openHTTPRelation(srv.URL, srv.Client())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error with %q", err, tt.want)
+			}
+			if tt.name == "range ignored" && !errors.Is(err, ErrNoRangeSupport) {
+				t.Errorf("%v is not ErrNoRangeSupport", err)
+			}
+		})
+	}
+}
+
+// The size is what Content-Range says, not the length of the probe's
+// body; a server that sends fewer bytes than a range asks for gives a
+// short read.
+func TestHTTPRelationShortRead(t *testing.T) {
+	const size = 3 * 8192
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var from, to int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &from, &to)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, to, size))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(bytes.Repeat([]byte{0x5A}, min(to-from+1, 1000)))
+	}))
+	defer srv.Close()
+
+	rel, err := openHTTPRelation(srv.URL, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := rel.Size(); got != size {
+		t.Errorf("Size() = %d, want %d", got, size)
+	}
+	page := make([]byte, 8192)
+	n, err := rel.ReadAt(page, 8192)
+	if n != 1000 || err != io.EOF {
+		t.Errorf("got %d bytes, %v; want 1000, EOF", n, err)
+	}
+	if _, err := io.ReadFull(io.NewSectionReader(rel, 0, size), page); err == nil {
+		t.Error("a short page read as a whole one")
+	}
+}
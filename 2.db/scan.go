@@ -0,0 +1,187 @@
+package main
+
+// Whole-relation scanning (-all).
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// relationPages returns the number of whole pages in the relation file. A
+// trailing partial page, as the last segment of a relation being extended
+// can have, is not counted; it is reported instead (see reportPartialPage).
+func relationPages(rel Relation) (int, error) {
+	size, err := rel.Size()
+	if err != nil {
+		return 0, err
+	}
+	n := int(size / heappage.PageSize)
+	if tail := int(size % heappage.PageSize); tail > 0 {
+		logger.Warn("file size is not a multiple of the block size: not a relation file, or one being extended",
+			"size", size, "blocksize", heappage.PageSize)
+		reportPartialPage(rel, n, tail)
+	}
+	return n, nil
+}
+
+// reportPartialPage warns about the n-byte page pageNo at the end of the
+// file and, if the header is all there, whether it passes validation.
+func reportPartialPage(r io.ReaderAt, pageNo, n int) {
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, int64(pageNo)*heappage.PageSize); err != nil && !errors.Is(err, io.EOF) {
+		logger.Warn("partial page unreadable", "page", pageNo, "bytes", n, "err", err)
+		return
+	}
+	heappage.WarnPartialPage(pageNo, buf)
+}
+
+// scanRanges returns the [from, to) page ranges a whole-relation scan of
+// nPages covers: all of it, or the first opts.Head and last opts.Tail pages
+// (clamped, never overlapping), cut to opts.MaxPages pages in total.
+func scanRanges(nPages int, opts DumpOptions) [][2]int {
+	ranges := [][2]int{{0, nPages}}
+	if opts.Head > 0 || opts.Tail > 0 {
+		head := min(opts.Head, nPages)
+		ranges = [][2]int{{0, head}}
+		if opts.Tail > 0 {
+			ranges = append(ranges, [2]int{max(nPages-opts.Tail, head), nPages})
+		}
+	}
+	if opts.MaxPages <= 0 {
+		return ranges
+	}
+	left := opts.MaxPages
+	for i := range ranges {
+		n := ranges[i][1] - ranges[i][0]
+		if n > left {
+			logger.Warn("scan capped by -max-pages", "pages", nPages, "max_pages", opts.MaxPages)
+			ranges[i][1] = ranges[i][0] + left
+			return ranges[:i+1]
+		}
+		left -= n
+	}
+	return ranges
+}
+
+// errEndOfRelation stops a scan that ran into the end of the file early.
+var errEndOfRelation = errors.New("end of relation")
+
+// dumpRelation dumps every page of the relation file, or with SinceLSN only
+// those changed after that LSN, up to opts.MaxPages pages. With SkipErrors a page
+// that cannot be read or parsed is reported to stderr and the scan goes on;
+// a summary of skipped pages by stage is printed at the end. With
+// opts.Anomalies set (-strict) bad pages are recorded there and skipped too.
+func dumpRelation(ctx context.Context, filePath string, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	nPages, err := relationPages(f)
+	if err != nil {
+		return err
+	}
+	ranges := scanRanges(nPages, opts)
+
+	w, err := newDumpWriter(os.Stdout, opts)
+	if err != nil {
+		return err
+	}
+
+	skipped := map[string]int{}
+	unchanged := 0
+	total := 0
+	for _, r := range ranges {
+		total += r[1] - r[0]
+	}
+	prog := newScanProgress(total, opts)
+	scan := withProgress(prog, func(p *heappage.Page, err error) error {
+		if err != nil {
+			var pe *heappage.PageError
+			if errors.As(err, &pe) && pe.Stage == "read" && errors.Is(err, io.ErrUnexpectedEOF) {
+				// the file shrank since it was sized (truncated by VACUUM, or
+				// not a relation at all); what was read so far stands
+				logger.Warn("relation ended early", "page", pe.PageNo, "pages", nPages)
+				return errEndOfRelation
+			}
+			if !errors.As(err, &pe) || (!opts.SkipErrors && opts.Anomalies == nil) {
+				return err
+			}
+			if opts.Anomalies != nil {
+				opts.Anomalies.Add("page", "%v", err)
+			}
+			if opts.SkipErrors {
+				logSkippedPage(pe)
+			}
+			skipped[pe.Stage]++
+			return nil
+		}
+		if opts.SinceLSN != 0 && p.Header.PageLSN() <= opts.SinceLSN {
+			unchanged++
+			return nil
+		}
+		if err := writePage(w, p, opts); err != nil {
+			var pe *heappage.PageError
+			if !errors.As(err, &pe) || !opts.SkipErrors {
+				return err
+			}
+			logSkippedPage(pe)
+			skipped[pe.Stage]++
+		}
+		return nil
+	})
+	for _, r := range ranges {
+		if err = heappage.ScanRange(ctx, f, r[0], r[1], scan); err != nil {
+			break
+		}
+	}
+	if prog != nil {
+		prog.Done()
+	}
+	if errors.Is(err, errEndOfRelation) {
+		err = nil
+	}
+	if err == nil {
+		err = w.Finish()
+	}
+
+	if opts.SinceLSN != 0 {
+		logger.Info("pages not modified after LSN", "unchanged", unchanged, "pages", nPages,
+			"lsn", heappage.FormatLSN(uint32(opts.SinceLSN>>32), uint32(opts.SinceLSN)))
+	}
+	if len(skipped) > 0 {
+		logger.Warn("pages skipped", "skipped", sumCounts(skipped), "pages", nPages,
+			"by_stage", formatCounts(skipped))
+	}
+	return err
+}
+
+func sumCounts(m map[string]int) int {
+	n := 0
+	for _, v := range m {
+		n += v
+	}
+	return n
+}
+
+// formatCounts renders a map as "k1=v1 k2=v2" with sorted keys.
+func formatCounts(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%d", k, m[k])
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+	"github.com/ptflp/techinterview/2.db/heappage/heaptest"
+)
+
+// captureLogger collects what is logged for the rest of a test.
+func captureLogger(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	saved, savedLib := logger, heappage.Logger
+	logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	heappage.Logger = logger
+	t.Cleanup(func() { logger, heappage.Logger = saved, savedLib })
+	return &buf
+}
+
+// A segment file ends wherever the relation's extension got to, so its
+// last page can be cut short: the whole pages are read, the tail reported.
+func TestPartialLastPage(t *testing.T) {
+	page0 := heaptest.Page(t, 0, heaptest.Tuple(t, demoColumns, []any{int64(1), "a"}))
+	page1 := heaptest.Page(t, 1, heaptest.Tuple(t, demoColumns, []any{int64(2), "b"}))
+	tests := []struct {
+		name   string
+		file   []byte
+		blocks []int
+		warn   string // logged for the tail
+	}{
+		{"empty", nil, nil, ""},
+		{"whole pages", concat(page0, page1), []int{0, 1}, ""},
+		{"header only", concat(page0, page1[:heappage.PageHeaderByteLen]), []int{0}, "bytes=24 header=valid"},
+		{"mid header", concat(page0, page1[:10]), []int{0}, "bytes=10\n"},
+		{"zeroed tail", concat(page0, make([]byte, 100)), []int{0}, `bytes=100 header="all zero"`},
+		{"mid tuple", concat(page0, page1[:heappage.PageSize-1]), []int{0}, "bytes=8191 header=valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogger(t)
+			var blocks []int
+			err := heappage.WalkPages(bytes.NewReader(tt.file), heappage.PageSize, func(blockNo int, page []byte) error {
+				if !bytes.Equal(page, tt.file[blockNo*heappage.PageSize:(blockNo+1)*heappage.PageSize]) {
+					t.Errorf("block %d: wrong bytes", blockNo)
+				}
+				blocks = append(blocks, blockNo)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(blocks, tt.blocks) {
+				t.Errorf("WalkPages blocks %v, want %v", blocks, tt.blocks)
+			}
+			checkPartialWarning(t, logs, len(tt.blocks), tt.warn)
+
+			logs.Reset()
+			n, err := relationPages(memRelation{bytes.NewReader(tt.file)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(tt.blocks) {
+				t.Errorf("relationPages = %d, want %d", n, len(tt.blocks))
+			}
+			checkPartialWarning(t, logs, len(tt.blocks), tt.warn)
+		})
+	}
+}
+
+func checkPartialWarning(t *testing.T, logs *bytes.Buffer, pageNo int, warn string) {
+	t.Helper()
+	got := logs.String()
+	if warn == "" {
+		if strings.Contains(got, "partial page") {
+			t.Errorf("unexpected warning:\n%s", got)
+		}
+		return
+	}
+	want := "partial page not scanned\" page=" + strconv.Itoa(pageNo) + " " + warn
+	if !strings.Contains(got, want) {
+		t.Errorf("log has no %q:\n%s", want, got)
+	}
+}
+
+func TestVerifyPartialLastPage(t *testing.T) {
+	captureLogger(t)
+	file := concat(heaptest.Page(t, 0), heaptest.Page(t, 1)[:1000])
+	var out bytes.Buffer
+	res, err := verifyRelation(context.Background(), &out, memRelation{bytes.NewReader(file)}, 0, DumpOptions{Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (VerifyResult{Pages: 1, Checked: 1, Partial: 1000}); res != want {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+	if want := "block 1: truncated: 1000 of 8192 bytes, not verified\n"; out.String() != want {
+		t.Errorf("output %q, want %q", out.String(), want)
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestSegmentBlockBase(t *testing.T) {
+	for path, want := range map[string]uint32{
+		"16384":                    0,
+		"16384.1":                  131072,
+		"16384.2":                  262144,
+		"base/5/16384.2":           262144,
+		"/data/base/5/16384_fsm.1": 131072,
+		"/data/v1.2/16384":         0,
+		"16384.x":                  0,
+		"57344":                    0,
+	} {
+		if got := segmentBlockBase(path); got != want {
+			t.Errorf("segmentBlockBase(%q) = %d, want %d", path, got, want)
+		}
+	}
+}
+
+// Pages of segment 2 are checksummed with their block number in the
+// relation, which only the file name gives.
+func TestVerifySegment(t *testing.T) {
+	base := segmentBlockBase("16384.2")
+	file := concat(heaptest.Page(t, base), heaptest.Page(t, base+1))
+	for _, tt := range []struct {
+		base     uint32
+		failures int
+	}{{base, 0}, {0, 2}} {
+		var out bytes.Buffer
+		res, err := verifyRelation(context.Background(), &out, memRelation{bytes.NewReader(file)}, tt.base, DumpOptions{Quiet: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Checked != 2 || res.Failures != tt.failures {
+			t.Errorf("base %d: %+v, want 2 checked, %d failures", tt.base, res, tt.failures)
+		}
+	}
+}
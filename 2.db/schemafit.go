@@ -0,0 +1,110 @@
+package main
+
+// Schema fit check (-compare-schema): decode a page's live tuples with a
+// candidate schema and count how many it consumes exactly, to the last
+// byte. A schema that is off by a column or a type width shows up as
+// leftover bytes or as an overrun on most tuples, long before the decoded
+// values look obviously wrong.
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// tupleFit decodes tuple with cols and returns nil if the attributes end
+// exactly where the tuple does (lp_len is not padded, so there is no slack).
+func tupleFit(tuple []byte, rh *heappage.RowHeader, cols []heappage.ColumnDef) error {
+	if natts := rh.Natts(); natts > len(cols) {
+		return fmt.Errorf("tuple has %d attributes, schema %d", natts, len(cols))
+	}
+	end, _, err := rh.DataRange(len(tuple))
+	if err != nil {
+		return err
+	}
+	err = heappage.WalkRow(tuple, rh, cols, len(cols), func(i, off, _ int, col *heappage.ColumnDef) (int, error) {
+		_, next, err := heappage.DecodeAttrAt(tuple, off, col, decodeOptions)
+		if err == nil {
+			end = next
+		}
+		return next, err
+	})
+	if err != nil {
+		return err
+	}
+	if left := len(tuple) - end; left != 0 {
+		return fmt.Errorf("%d bytes left over after the last attribute", left)
+	}
+	return nil
+}
+
+// SchemaFit is the result of checking a schema against one page.
+type SchemaFit struct {
+	PageNo  int
+	Tuples  int // live tuples checked
+	Clean   int // of those, decoded to exactly their end
+	Misfits []Misfit
+}
+
+// Misfit is a tuple the schema does not decode cleanly.
+type Misfit struct {
+	Offset heappage.OffsetNumber // line pointer number
+	Err    string
+}
+
+// pageSchemaFit checks cols against the page's LP_NORMAL tuples that look
+// live; dead versions may predate an ALTER TABLE and are left out.
+func pageSchemaFit(pageNo int, page []byte, items []heappage.ItemID, cols []heappage.ColumnDef) *SchemaFit {
+	fit := &SchemaFit{PageNo: pageNo}
+	for _, it := range items {
+		if it.Flags != heappage.LP_NORMAL {
+			continue
+		}
+		start, end := int(it.LpOff), int(it.LpOff)+int(it.LpLen)
+		if start >= end || end > len(page) {
+			continue
+		}
+		tuple := page[start:end]
+		rh, err := heappage.ParseRowHeader(tuple)
+		if err != nil || !rh.LooksLive() {
+			continue
+		}
+		fit.Tuples++
+		if err := tupleFit(tuple, rh, cols); err != nil {
+			fit.Misfits = append(fit.Misfits, Misfit{it.Index, err.Error()})
+			continue
+		}
+		fit.Clean++
+	}
+	return fit
+}
+
+func compareSchema(filePath string, pageNo int, cols []heappage.ColumnDef) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	page, _, items, err := heappage.LoadPage(f, pageNo)
+	if err != nil {
+		return err
+	}
+	return writeSchemaFit(os.Stdout, pageSchemaFit(pageNo, page, items, cols))
+}
+
+func writeSchemaFit(w io.Writer, fit *SchemaFit) error {
+	fmt.Fprintf(w, "== Page %d ==\n", fit.PageNo)
+	for _, m := range fit.Misfits {
+		fmt.Fprintf(w, " [%2d] %s\n", m.Offset, m.Err)
+	}
+	if fit.Tuples == 0 {
+		_, err := fmt.Fprintf(w, "no live tuples to check\n")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "clean: %d/%d live tuples (%.1f%%)\n",
+		fit.Clean, fit.Tuples, 100*float64(fit.Clean)/float64(fit.Tuples))
+	return err
+}
@@ -0,0 +1,162 @@
+package main
+
+// -format sql: regenerate live tuples as INSERT statements, for recovering
+// data when only the heap files survive. Literals assume
+// standard_conforming_strings = on (the default since 9.1).
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+type SQLWriter struct {
+	w       io.Writer
+	table   string
+	columns []string
+}
+
+func NewSQLWriter(w io.Writer, table string, columns []string) *SQLWriter {
+	return &SQLWriter{w: w, table: table, columns: columns}
+}
+
+func (s *SQLWriter) WritePage(PageDump) error { return nil }
+
+// WriteTuple writes an INSERT for a live, cleanly decoded tuple and skips
+// everything else (dead/redirect pointers, deleted or aborted tuples).
+func (s *SQLWriter) WriteTuple(td TupleDump) error {
+	if td.Header == nil || !td.Header.Live || td.Error != "" {
+		return nil
+	}
+	cols := make([]string, len(s.columns))
+	for i, c := range s.columns {
+		cols[i] = quoteIdent(c)
+	}
+	vals := make([]string, len(td.Columns))
+	for i, cv := range td.Columns {
+		vals[i] = sqlLiteral(cv.Value)
+	}
+	_, err := fmt.Fprintf(s.w, "INSERT INTO %s (%s) VALUES (%s);\n",
+		quoteQualified(s.table), strings.Join(cols, ", "), strings.Join(vals, ", "))
+	return err
+}
+
+func (s *SQLWriter) Finish() error { return nil }
+
+var plainIdent = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// sqlKeywords are the keywords quote_ident quotes: the reserved ones and
+// those that may be a column name or a type or function name but not both
+// (kwlist.h, all but UNRESERVED_KEYWORD). Quoting one that a given server
+// would have accepted bare does no harm.
+var sqlKeywords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, kw := range strings.Fields(`
+		all analyse analyze and any array as asc asymmetric both case cast
+		check collate column constraint create current_catalog current_date
+		current_role current_time current_timestamp current_user default
+		deferrable desc distinct do else end except false fetch for foreign
+		from grant group having in initially intersect into lateral leading
+		limit localtime localtimestamp not null offset on only or order
+		placing primary references returning select session_user some
+		symmetric system_user table then to trailing true union unique user
+		using variadic when where window with
+
+		authorization binary collation concurrently cross current_schema
+		freeze full ilike inner is isnull join left like natural notnull
+		outer overlaps right similar tablesample verbose
+
+		between bigint bit boolean char character coalesce dec decimal exists
+		extract float greatest grouping inout int integer interval json
+		json_array json_arrayagg json_object json_objectagg least national
+		nchar none normalize nullif numeric out overlay position precision
+		real row setof smallint substring time timestamp treat trim values
+		varchar xmlattributes xmlconcat xmlelement xmlexists xmlforest
+		xmlnamespaces xmlparse xmlpi xmlroot xmlserialize xmltable`) {
+		m[kw] = true
+	}
+	return m
+}()
+
+// quoteIdent double-quotes an identifier unless it is plain lower case and
+// not a keyword.
+func quoteIdent(id string) string {
+	if plainIdent.MatchString(id) && !sqlKeywords[id] {
+		return id
+	}
+	return `"` + strings.ReplaceAll(id, `"`, `""`) + `"`
+}
+
+// quoteQualified quotes each part of a schema-qualified name.
+func quoteQualified(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = quoteIdent(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteString makes a standard-conforming string literal: only single quotes
+// need doubling, backslashes are literal. Text with a NUL or bytes that are
+// not UTF-8 (a datum the tool could not convert, or a damaged one) cannot be
+// written as is: it becomes an escape string with those bytes as \xHH, which
+// the server rejects for that one INSERT instead of the raw bytes breaking
+// the script around it.
+func quoteString(s string) string {
+	if utf8.ValidString(s) && !strings.ContainsRune(s, 0) {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	var sb strings.Builder
+	sb.WriteString("E'")
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		switch {
+		case r == 0 || (r == utf8.RuneError && n == 1):
+			fmt.Fprintf(&sb, `\x%02x`, s[0])
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\'':
+			sb.WriteString(`''`)
+		default:
+			sb.WriteString(s[:n])
+		}
+		s = s[n:]
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+// sqlLiteral renders a decoded value as an SQL literal.
+func sqlLiteral(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	case string:
+		return quoteString(x)
+	case []byte:
+		return quoteString(heappage.FormatByteaHex(x)) // valid bytea input whatever -binary-encoding says
+	case float32, float64:
+		s := heappage.FormatValue(x, decodeOptions)
+		if s == "NaN" || strings.HasSuffix(s, "Infinity") {
+			return quoteString(s)
+		}
+		return s
+	case []any: // composite
+		parts := make([]string, len(x))
+		for i, f := range x {
+			parts[i] = sqlLiteral(f)
+		}
+		return "ROW(" + strings.Join(parts, ", ") + ")"
+	default:
+		return heappage.FormatValue(x, decodeOptions)
+	}
+}
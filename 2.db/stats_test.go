@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The metrics count live and dead tuples like -dead-ratio: of the sample
+// page's four LP_NORMAL tuples, the deleted "Red Queen" has a committed
+// xmax and is dead.
+func TestStatsMatchDeadRatio(t *testing.T) {
+	f, err := os.Open("57344")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rel := localRelation{f}
+	opts := DumpOptions{Quiet: true}
+
+	rep, err := collectDeadCounts(context.Background(), rel, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Total.Tuples != 4 || rep.Total.Dead != 1 || rep.Total.Ratio() != 25 {
+		t.Fatalf("dead ratio: %+v, %.1f%%", rep.Total, rep.Total.Ratio())
+	}
+	st, err := collectStats(context.Background(), rel, 0, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.LiveTuples != rep.Total.Tuples-rep.Total.Dead || st.DeadTuples != rep.Total.Dead {
+		t.Errorf("stats: live %d, dead %d; -dead-ratio: %d of %d dead",
+			st.LiveTuples, st.DeadTuples, rep.Total.Dead, rep.Total.Tuples)
+	}
+
+	var out bytes.Buffer
+	if err := writeProm(&out, "57344", st); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\nheap_live_tuples_total{file=\"57344\"} 3\n",
+		"\nheap_dead_tuples_total{file=\"57344\"} 1\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics lack %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+// -strict: collect structural anomalies over the scanned range and turn them
+// into a non-zero exit status.
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+const maxAnomalyMessages = 20
+
+// Anomalies collects problems found while dumping, by kind
+// ("page", "bounds", "redirect", "checksum", "tuple").
+type Anomalies struct {
+	counts   map[string]int
+	messages []string
+}
+
+func NewAnomalies() *Anomalies { return &Anomalies{counts: map[string]int{}} }
+
+func (a *Anomalies) Add(kind, format string, args ...any) {
+	a.counts[kind]++
+	if len(a.messages) < maxAnomalyMessages {
+		a.messages = append(a.messages, fmt.Sprintf(kind+": "+format, args...))
+	}
+}
+
+func (a *Anomalies) Count() int { return sumCounts(a.counts) }
+
+func (a *Anomalies) WriteSummary(w io.Writer) {
+	fmt.Fprintf(w, "strict: %d anomalies (%s)\n", a.Count(), formatCounts(a.counts))
+	for _, m := range a.messages {
+		fmt.Fprintf(w, "  %s\n", m)
+	}
+	if n := a.Count() - len(a.messages); n > 0 {
+		fmt.Fprintf(w, "  ... and %d more\n", n)
+	}
+}
+
+// checkPageChecksum records a checksum mismatch for a page, whose block
+// number in the relation is blkno.
+func (a *Anomalies) checkPageChecksum(p *heappage.Page, blkno uint32) {
+	if heappage.PageIsNew(p.Header) {
+		return
+	}
+	if ok, checked := heappage.VerifyChecksum(p.Raw, p.Header, blkno); checked && !ok {
+		a.Add("checksum", "page %d: stored=%d computed=%d",
+			p.No, p.Header.PdChecksum, heappage.PageChecksum(p.Raw, blkno))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+// Decoding a lone tuple (-tuple-hex): the bytes of one heap tuple, from its
+// HeapTupleHeaderData on, given as hex without any page around them, e.g.
+// a tuple pasted from a bug report or pageinspect's heap_page_items
+// t_data with the header prepended.
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// hexFromArg decodes hex text, or reads it from stdin when arg is "-".
+// Whitespace and a leading \x (bytea output) are ignored.
+func hexFromArg(arg string, stdin io.Reader) ([]byte, error) {
+	text := arg
+	if arg == "-" {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	text = strings.Join(strings.Fields(text), "")
+	text = strings.TrimPrefix(text, `\x`)
+	return hex.DecodeString(text)
+}
+
+// tupleFromHex reads the -tuple-hex argument, see hexFromArg.
+func tupleFromHex(arg string, stdin io.Reader) ([]byte, error) {
+	tuple, err := hexFromArg(arg, stdin)
+	if err != nil {
+		return nil, fmt.Errorf("-tuple-hex: %w", err)
+	}
+	if len(tuple) < heappage.RowHeaderByteLen {
+		return nil, fmt.Errorf("-tuple-hex: %d bytes, a tuple header alone is %d", len(tuple), heappage.RowHeaderByteLen)
+	}
+	if len(tuple) > heappage.PageSize {
+		return nil, fmt.Errorf("-tuple-hex: %d bytes, more than a page", len(tuple))
+	}
+	return tuple, nil
+}
+
+// dumpTuple decodes tuple as if a NORMAL line pointer 1 on page 0 pointed
+// at it and writes it without page output.
+func dumpTuple(tuple []byte, opts DumpOptions) error {
+	w, err := newDumpWriter(os.Stdout, opts)
+	if err != nil {
+		return err
+	}
+	it := heappage.ItemID{Index: 1, LpOff: 0, Flags: heappage.LP_NORMAL, LpLen: uint16(len(tuple))}
+	td := buildTupleDump(0, tuple, it, opts)
+	if td.Error != "" && opts.Anomalies != nil {
+		opts.Anomalies.Add("tuple", "%s", td.Error)
+	}
+	if err := w.WriteTuple(td); err != nil {
+		return err
+	}
+	return w.Finish()
+}
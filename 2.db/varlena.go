@@ -0,0 +1,256 @@
+package main
+
+// -varlena-hex: take one varlena datum apart, header bit by header bit, for
+// learning the format and for checking a value pulled out of a damaged
+// tuple. On little-endian the low bits of the first byte decide:
+//
+//	xxxxxxx1  1-byte header, length (with the header) in the upper 7 bits
+//	00000001  1-byte header of an external datum (TOAST pointer); a tag
+//	          byte and the pointer follow
+//	xxxxxx00  4-byte header, uncompressed, length in the upper 30 bits
+//	xxxxxx10  4-byte header, compressed inline: va_tcinfo (raw size in 30
+//	          bits, method in the top 2) and the compressed data follow
+//
+// Compressed data is expanded here (pglz or lz4). A TOAST pointer is only
+// described: its chunks live in the TOAST table, not in the datum.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// vartag_external values (varatt.h)
+const (
+	vartagIndirect   = 1
+	vartagExpandedRO = 2
+	vartagExpandedRW = 3
+	vartagOnDisk     = 18
+)
+
+// TOAST compression methods, the top 2 bits of va_tcinfo and va_extinfo
+var toastCompressionNames = [4]string{"pglz", "lz4", "invalid (2)", "invalid (3)"}
+
+func explainVarlena(datum []byte) error { return writeVarlenaExplain(os.Stdout, datum) }
+
+func writeVarlenaExplain(w io.Writer, datum []byte) error {
+	first := datum[0]
+	fmt.Fprintf(w, "first byte 0x%02x = %08b\n", first, first)
+
+	switch {
+	case first == 0x01:
+		fmt.Fprintf(w, "  == 00000001: 1-byte header of an external datum (VARATT_IS_1B_E)\n")
+		return explainExternal(w, datum)
+	case first&0x01 == 1:
+		fmt.Fprintf(w, "  low bit 1: 1-byte header (VARATT_IS_1B)\n")
+		fmt.Fprintf(w, "  length = byte >> 1 = %d, with the header\n", first>>1)
+	case len(datum) < 4:
+		return fmt.Errorf("low bit 0 means a 4-byte header, but the datum has %d bytes", len(datum))
+	default:
+		h := binary.LittleEndian.Uint32(datum)
+		fmt.Fprintf(w, "  low bit 0: 4-byte header 0x%08x (VARATT_IS_4B)\n", h)
+		fmt.Fprintf(w, "  length = header >> 2 = %d, with the header\n", h>>2)
+		if h&0x03 == 0x02 {
+			fmt.Fprintf(w, "  bits 1-0 = 10: compressed inline (VARATT_IS_4B_C)\n")
+			return explainCompressed(w, datum, int(h>>2))
+		}
+		fmt.Fprintf(w, "  bits 1-0 = 00: not compressed (VARATT_IS_4B_U)\n")
+	}
+
+	payload, next, err := heappage.ReadVarlenaLE(datum, 0)
+	if err != nil {
+		return err
+	}
+	if next < len(datum) {
+		fmt.Fprintf(w, "%d bytes after the datum ignored\n", len(datum)-next)
+	}
+	writeVarlenaPayload(w, payload)
+	return nil
+}
+
+// explainCompressed decodes va_tcinfo and expands the data after it.
+func explainCompressed(w io.Writer, datum []byte, total int) error {
+	if total < 8 || total > len(datum) {
+		return fmt.Errorf("compressed datum of %d bytes, but %d given (at least 8 needed)", total, len(datum))
+	}
+	tcinfo := binary.LittleEndian.Uint32(datum[4:])
+	rawSize, method := int(tcinfo&0x3FFFFFFF), tcinfo>>30
+	fmt.Fprintf(w, "va_tcinfo 0x%08x: raw size %d, method %d (%s)\n", tcinfo, rawSize, method, toastCompressionNames[method])
+	fmt.Fprintf(w, "compressed: %d bytes, %.1f%% of raw\n", total-8, float64(total-8)*100/float64(max(rawSize, 1)))
+
+	var raw []byte
+	var err error
+	switch method {
+	case 0:
+		raw, err = pglzDecompress(datum[8:total], rawSize)
+	case 1:
+		raw, err = lz4Decompress(datum[8:total], rawSize)
+	default:
+		err = fmt.Errorf("unknown compression method %d", method)
+	}
+	if err != nil {
+		return fmt.Errorf("decompress: %w", err)
+	}
+	writeVarlenaPayload(w, raw)
+	return nil
+}
+
+// explainExternal describes a TOAST pointer (varatt_external for on-disk
+// ones). The value itself is in the TOAST relation and is not read.
+func explainExternal(w io.Writer, datum []byte) error {
+	if len(datum) < 2 {
+		return errors.New("external datum truncated before its tag")
+	}
+	tag := datum[1]
+	switch tag {
+	case vartagIndirect:
+		fmt.Fprintf(w, "tag %d: indirect pointer to an in-memory datum; never stored on disk\n", tag)
+		return nil
+	case vartagExpandedRO, vartagExpandedRW:
+		fmt.Fprintf(w, "tag %d: expanded object pointer; never stored on disk\n", tag)
+		return nil
+	case vartagOnDisk:
+	default:
+		return fmt.Errorf("unknown vartag %d", tag)
+	}
+	if len(datum) < 2+16 {
+		return fmt.Errorf("on-disk TOAST pointer needs 18 bytes, have %d", len(datum))
+	}
+	p := datum[2:]
+	rawSize := binary.LittleEndian.Uint32(p)
+	extinfo := binary.LittleEndian.Uint32(p[4:])
+	valueID := binary.LittleEndian.Uint32(p[8:])
+	toastRel := binary.LittleEndian.Uint32(p[12:])
+	extSize := extinfo & 0x3FFFFFFF
+	fmt.Fprintf(w, "tag %d: on-disk TOAST pointer (varatt_external)\n", tag)
+	fmt.Fprintf(w, "  va_rawsize    %d (the value's size with a 4-byte header)\n", rawSize)
+	fmt.Fprintf(w, "  va_extinfo    0x%08x: %d bytes stored in TOAST\n", extinfo, extSize)
+	if int64(extSize) < int64(rawSize)-4 {
+		fmt.Fprintf(w, "                compressed with method %d (%s)\n", extinfo>>30, toastCompressionNames[extinfo>>30])
+	}
+	fmt.Fprintf(w, "  va_valueid    %d (chunk_id in the TOAST table)\n", valueID)
+	fmt.Fprintf(w, "  va_toastrelid %d (pg_class oid of the TOAST table)\n", toastRel)
+	fmt.Fprintf(w, "the value is not part of the datum; read the chunks of chunk_id %d from the TOAST table\n", valueID)
+	return nil
+}
+
+func writeVarlenaPayload(w io.Writer, payload []byte) {
+	fmt.Fprintf(w, "payload: %d bytes\n", len(payload))
+	if utf8.Valid(payload) {
+		fmt.Fprintf(w, "as text: %q\n", payload)
+	}
+	hexDumpRange(w, payload, 0, len(payload))
+}
+
+// decompressCap is the room to reserve for rawSize bytes expanded from src.
+// rawSize comes from va_tcinfo and a corrupt one claims up to 1GB, but
+// neither pglz nor lz4 expands one input byte into more than 255.
+func decompressCap(src []byte, rawSize int) int {
+	return min(rawSize, 255*len(src))
+}
+
+// pglzDecompress expands PostgreSQL's LZ (common/pg_lzcompress.c): each
+// control byte says, low bit first, whether the next 8 items are a literal
+// byte or a back reference of 2 or 3 bytes (length-3 in the low nibble,
+// 18 and up continued in a third byte; a 12-bit offset).
+func pglzDecompress(src []byte, rawSize int) ([]byte, error) {
+	dst := make([]byte, 0, decompressCap(src, rawSize))
+	for sp := 0; sp < len(src) && len(dst) < rawSize; {
+		ctrl := src[sp]
+		sp++
+		for bit := 0; bit < 8 && sp < len(src) && len(dst) < rawSize; bit++ {
+			if ctrl&(1<<bit) == 0 {
+				dst = append(dst, src[sp])
+				sp++
+				continue
+			}
+			if sp+2 > len(src) {
+				return nil, errors.New("pglz: back reference truncated")
+			}
+			n := int(src[sp]&0x0F) + 3
+			off := int(src[sp]&0xF0)<<4 | int(src[sp+1])
+			sp += 2
+			if n == 18 {
+				if sp >= len(src) {
+					return nil, errors.New("pglz: length byte truncated")
+				}
+				n += int(src[sp])
+				sp++
+			}
+			if off == 0 || off > len(dst) {
+				return nil, fmt.Errorf("pglz: back reference offset %d with %d bytes out", off, len(dst))
+			}
+			for range min(n, rawSize-len(dst)) {
+				dst = append(dst, dst[len(dst)-off])
+			}
+		}
+	}
+	if len(dst) != rawSize {
+		return nil, fmt.Errorf("pglz: expanded to %d bytes, raw size is %d", len(dst), rawSize)
+	}
+	return dst, nil
+}
+
+// lz4Decompress expands one LZ4 block, the format PostgreSQL stores: a
+// token (literal length, match length-4, 15 continued in 255-bytes), the
+// literals, then a 2-byte offset; the last sequence has no match.
+func lz4Decompress(src []byte, rawSize int) ([]byte, error) {
+	dst := make([]byte, 0, decompressCap(src, rawSize))
+	length := func(n int, sp *int) (int, error) {
+		if n != 15 {
+			return n, nil
+		}
+		for {
+			if *sp >= len(src) {
+				return 0, errors.New("lz4: length truncated")
+			}
+			b := src[*sp]
+			*sp++
+			n += int(b)
+			if b != 255 {
+				return n, nil
+			}
+		}
+	}
+	for sp := 0; sp < len(src); {
+		token := src[sp]
+		sp++
+		lit, err := length(int(token>>4), &sp)
+		if err != nil {
+			return nil, err
+		}
+		if sp+lit > len(src) || len(dst)+lit > rawSize {
+			return nil, errors.New("lz4: literals overrun")
+		}
+		dst = append(dst, src[sp:sp+lit]...)
+		sp += lit
+		if sp == len(src) {
+			break
+		}
+		if sp+2 > len(src) {
+			return nil, errors.New("lz4: offset truncated")
+		}
+		off := int(binary.LittleEndian.Uint16(src[sp:]))
+		sp += 2
+		n, err := length(int(token&0x0F), &sp)
+		if err != nil {
+			return nil, err
+		}
+		n += 4
+		if off == 0 || off > len(dst) || len(dst)+n > rawSize {
+			return nil, fmt.Errorf("lz4: match of %d at offset %d with %d bytes out", n, off, len(dst))
+		}
+		for range n {
+			dst = append(dst, dst[len(dst)-off])
+		}
+	}
+	if len(dst) != rawSize {
+		return nil, fmt.Errorf("lz4: expanded to %d bytes, raw size is %d", len(dst), rawSize)
+	}
+	return dst, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+func FuzzReadVarlena(f *testing.F) {
+	toast := []byte{0x01, vartagOnDisk}
+	toast = binary.LittleEndian.AppendUint32(toast, 1004) // va_rawsize
+	toast = binary.LittleEndian.AppendUint32(toast, 1000) // va_extinfo
+	toast = binary.LittleEndian.AppendUint32(toast, 16401)
+	toast = binary.LittleEndian.AppendUint32(toast, 16390)
+	for _, seed := range [][]byte{
+		{0x0d, 'H', 'e', 'l', 'l', 'o'},                    // 1-byte header
+		{0x03},                                             // empty
+		{0x18, 0, 0, 0, 'a', 'b'},                          // 4-byte header, 6 bytes
+		{0x20, 0, 0, 0, 'a'},                               // 4-byte header past the end
+		{0x2a, 0, 0, 0, 5, 0, 0, 0, 0x00, 'a'},             // pglz, truncated
+		{0x2a, 0, 0, 0, 2, 0, 0, 0x40, 0x20, 'z'},          // lz4
+		{0x2a, 0, 0, 0, 0xff, 0xff, 0xff, 0x3f, 0x00, 'a'}, // pglz claiming 1GB raw
+		toast,
+		{0x01, vartagIndirect},
+		{},
+	} {
+		f.Add(seed, 0)
+	}
+	f.Add([]byte{0, 0, 0x0d, 'H', 'e', 'l', 'l', 'o'}, 2)
+
+	f.Fuzz(func(t *testing.T, data []byte, off int) {
+		if off < 0 || off > len(data) {
+			off = 0
+		}
+		payload, next, err := heappage.ReadVarlenaLE(data, off)
+		if err == nil {
+			if next <= off || next > len(data) {
+				t.Fatalf("next=%d for off=%d in %d bytes", next, off, len(data))
+			}
+			if len(payload) >= next-off {
+				t.Fatalf("payload of %d bytes for a %d-byte datum with its header", len(payload), next-off)
+			}
+		}
+		if len(data) > 0 {
+			writeVarlenaExplain(io.Discard, data) // errors are fine, panics are not
+		}
+	})
+}
+
+func TestReadVarlena(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		off     int
+		payload []byte
+		next    int
+		wantErr bool
+	}{
+		{"short", []byte{0x0d, 'H', 'e', 'l', 'l', 'o', 0xff}, 0, []byte("Hello"), 6, false},
+		{"short empty", []byte{0x03}, 0, []byte{}, 1, false},
+		{"long", []byte{0, 0x18, 0, 0, 0, 'a', 'b'}, 1, []byte("ab"), 7, false},
+		{"short overrun", []byte{0x0d, 'a'}, 0, nil, 0, true},
+		{"long overrun", []byte{0x20, 0, 0, 0, 'a'}, 0, nil, 0, true},
+		{"long header truncated", []byte{0x20, 0}, 0, nil, 0, true},
+		{"long length below header", []byte{0x0c, 0, 0, 0}, 0, nil, 0, true},
+		{"compressed", []byte{0x2a, 0, 0, 0, 5, 0, 0, 0, 0, 'a'}, 0, nil, 0, true},
+		{"toast pointer", []byte{0x01, vartagOnDisk}, 0, nil, 0, true},
+		{"off at end", []byte{0x03}, 1, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, next, err := heappage.ReadVarlenaLE(tt.buf, tt.off)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("no error, payload %q", payload)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(payload, tt.payload) || (payload == nil) != (tt.payload == nil) || next != tt.next {
+				t.Errorf("got %q next=%d, want %q next=%d", payload, next, tt.payload, tt.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+// -watch: re-read one page at an interval and redraw its dump, like
+// watch(1), to see a concurrent UPDATE or VACUUM land.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+const clearScreen = "\033[H\033[2J"
+
+// watchPage dumps the page every interval until ctx is cancelled (Ctrl-C),
+// which ends the loop without an error. The file is reopened each time so a
+// replaced or truncated file is picked up; a failed read is shown in place
+// of the dump and the loop goes on.
+func watchPage(ctx context.Context, filePath string, pageNo int, interval time.Duration, opts DumpOptions) error {
+	tty := isTerminal(os.Stdout)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if tty {
+			fmt.Print(clearScreen)
+		}
+		fmt.Printf("Every %v: %s page %d    %s\n\n", interval, filePath, pageNo, time.Now().Format(time.TimeOnly))
+		if err := dumpPage(filePath, pageNo, opts); err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+// DumpWriter implementations.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// -------- text --------
+
+type TextWriter struct {
+	w        io.Writer
+	RawLSN   bool   // print pd_lsn as (xlogid,xrecoff) decimals
+	Label    string // prefix of the decoded columns line
+	Explain  bool   // annotate structures for learners (-explain)
+	Color    bool   // ANSI colors (-color)
+	Expanded bool   // one FormatTuple line per column (-expanded)
+}
+
+func NewTextWriter(w io.Writer) *TextWriter { return &TextWriter{w: w, Label: "demo"} }
+
+// SGR codes for -color
+const (
+	ansiPage     = "36"   // page header: cyan
+	ansiDead     = "31"   // LP_DEAD: red
+	ansiRedirect = "33"   // LP_REDIRECT: yellow
+	ansiProblem  = "1;31" // ERROR and PADDING lines: bold red
+	ansiNull     = "2"    // NULL: dim
+)
+
+// paint wraps s in the SGR code when colors are on.
+func (t *TextWriter) paint(code, s string) string {
+	if !t.Color {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+func (t *TextWriter) WritePage(pd PageDump) error {
+	fmt.Fprintln(t.w, t.paint(ansiPage, fmt.Sprintf("== Page %d ==", pd.Page)))
+	fmt.Fprintln(t.w, t.paint(ansiPage, fmt.Sprintf("pd_lower=%d pd_upper=%d pd_special=%d  | free=%d bytes",
+		pd.Lower, pd.Upper, pd.Special, pd.Free)))
+	lsn := pd.LSN
+	if t.RawLSN {
+		lsn = fmt.Sprintf("(%d,%d)", pd.XLogID, pd.XRecOff)
+	}
+	fmt.Fprintln(t.w, t.paint(ansiPage, fmt.Sprintf("lsn=%s checksum=%d flags=0x%04x pagesize_ver=%d prune_xid=%d",
+		lsn, pd.Checksum, pd.Flags, pd.PagesizeVersion, pd.PruneXID)))
+	if pd.New {
+		fmt.Fprintf(t.w, "new page (all zero)\n")
+	} else {
+		fmt.Fprintf(t.w, "line pointers: %d", pd.LinePointers)
+		for f, n := range pd.FlagCounts {
+			if n > 0 {
+				fmt.Fprintf(t.w, " %s=%d", lpFlagNames[f], n)
+			}
+		}
+		fmt.Fprintln(t.w)
+	}
+	if t.Explain {
+		explainPage(t.w, pd)
+	}
+	return nil
+}
+
+func (t *TextWriter) WriteTuple(td TupleDump) error {
+	lp := fmt.Sprintf(" [%2d] lp_off=%4d lp_len=%3d flags=%d (%s)",
+		td.Offset, td.LpOff, td.LpLen, td.Flags, td.State)
+	switch td.Flags {
+	case heappage.LP_DEAD:
+		lp = t.paint(ansiDead, lp)
+	case heappage.LP_REDIRECT:
+		lp = t.paint(ansiRedirect, lp)
+	}
+	fmt.Fprintln(t.w, lp)
+	if td.Flags == heappage.LP_REDIRECT {
+		fmt.Fprintf(t.w, "      redirect to lp %d\n", td.Redirect)
+	}
+	if h := td.Header; h != nil {
+		fmt.Fprintf(t.w, "      xmin=%d xmax=%d ctid=%s natts=%d hoff=%d infomask=0x%04x infomask2=0x%04x\n",
+			h.Xmin, h.Xmax, h.CTID, h.Natts, h.Hoff, h.InfoMask, h.InfoMask2)
+		if h.Oid != 0 {
+			fmt.Fprintf(t.w, "      oid=%d\n", h.Oid)
+		}
+		if h.Lock != "" {
+			fmt.Fprintf(t.w, "      locked %s by xmax %d\n", h.Lock, h.Xmax)
+		}
+		if h.SpecToken != 0 {
+			fmt.Fprintf(t.w, "      spec_token=%d\n", h.SpecToken)
+		}
+	}
+	if len(td.Columns) > 0 && t.Expanded {
+		t.writeExpanded(td.Columns)
+	} else if len(td.Columns) > 0 {
+		parts := make([]string, len(td.Columns))
+		for i, cv := range td.Columns {
+			if cv.Display != "" {
+				parts[i] = cv.Name + "=" + formatTextValue(cv.Display)
+			} else {
+				parts[i] = cv.Name + "=" + t.value(cv.Value)
+			}
+		}
+		fmt.Fprintf(t.w, "      %s: %s\n", t.Label, strings.Join(parts, ", "))
+	}
+	for _, a := range td.Trace {
+		if a.Null {
+			fmt.Fprintf(t.w, "      attr%d %q %s\n", a.Attr, a.Name, t.value(nil))
+			continue
+		}
+		fmt.Fprintf(t.w, "      attr%d %q @ off=%d (pad %d) len=%d = %s\n",
+			a.Attr, a.Name, a.Off, a.Pad, a.Len, formatTextValue(a.Value))
+	}
+	for _, p := range td.Padding {
+		fmt.Fprintf(t.w, "      %s\n", t.paint(ansiProblem, "PADDING: "+p))
+	}
+	if td.Error != "" {
+		fmt.Fprintf(t.w, "      %s\n", t.paint(ansiProblem, "ERROR: "+td.Error))
+	}
+	if t.Explain {
+		explainTuple(t.w, td)
+	}
+	return nil
+}
+
+func (t *TextWriter) Finish() error { return nil }
+
+// writeExpanded prints the columns through FormatTuple, under the tuple's
+// header lines; NULL is empty as in psql.
+func (t *TextWriter) writeExpanded(columns []ColumnValue) {
+	cols := make([]heappage.ColumnDef, len(columns))
+	values := make([]any, len(columns))
+	for i, cv := range columns {
+		cols[i].Name, values[i] = cv.Name, cv.Value
+		if cv.Display != "" {
+			values[i] = cv.Display
+		}
+	}
+	for _, line := range strings.SplitAfter(heappage.FormatTuple(cols, values, decodeOptions), "\n") {
+		if line != "" {
+			fmt.Fprintf(t.w, "      %s", line)
+		}
+	}
+}
+
+// value is formatTextValue with NULL dimmed.
+func (t *TextWriter) value(v any) string {
+	if v == nil {
+		return t.paint(ansiNull, "NULL")
+	}
+	return formatTextValue(v)
+}
+
+func formatTextValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(x)
+	default:
+		return heappage.FormatValue(x, decodeOptions)
+	}
+}
+
+// -------- json (one document) --------
+
+type jsonPage struct {
+	PageDump
+	Tuples []TupleDump `json:"tuples"`
+}
+
+// JSONWriter buffers all pages and writes a single indented document on
+// Finish; use JSONLWriter for large relations.
+type JSONWriter struct {
+	w     io.Writer
+	pages []jsonPage
+}
+
+func NewJSONWriter(w io.Writer) *JSONWriter { return &JSONWriter{w: w} }
+
+func (j *JSONWriter) WritePage(pd PageDump) error {
+	j.pages = append(j.pages, jsonPage{PageDump: pd, Tuples: []TupleDump{}})
+	return nil
+}
+
+func (j *JSONWriter) WriteTuple(td TupleDump) error {
+	if len(j.pages) == 0 {
+		return fmt.Errorf("tuple before page")
+	}
+	last := &j.pages[len(j.pages)-1]
+	last.Tuples = append(last.Tuples, td)
+	return nil
+}
+
+func (j *JSONWriter) Finish() error {
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Pages []jsonPage `json:"pages"`
+	}{j.pages})
+}
+
+// -------- jsonl (one tuple per line, streamed) --------
+
+type JSONLWriter struct {
+	enc *json.Encoder
+}
+
+func NewJSONLWriter(w io.Writer) *JSONLWriter { return &JSONLWriter{enc: json.NewEncoder(w)} }
+
+func (j *JSONLWriter) WritePage(PageDump) error { return nil }
+
+func (j *JSONLWriter) WriteTuple(td TupleDump) error { return j.enc.Encode(td) }
+
+func (j *JSONLWriter) Finish() error { return nil }
+
+// -------- csv (one row per line pointer) --------
+
+var csvBaseHeader = []string{
+	"page", "offset", "state", "lp_off", "lp_len",
+	"xmin", "xmax", "cid", "ctid", "natts", "hoff", "infomask", "infomask2",
+}
+
+// CSVWriter quotes like COPY ... CSV rather than encoding/csv: a NULL is
+// an empty field and an empty string a quoted one, "", which encoding/csv
+// has no way to write.
+type CSVWriter struct {
+	w       *bufio.Writer
+	columns []string
+	started bool
+}
+
+// NewCSVWriter writes one row per line pointer; columns names the decoded
+// attributes that follow the fixed header fields.
+func NewCSVWriter(w io.Writer, columns []string) *CSVWriter {
+	return &CSVWriter{w: bufio.NewWriter(w), columns: columns}
+}
+
+func (c *CSVWriter) WritePage(PageDump) error { return nil }
+
+func (c *CSVWriter) WriteTuple(td TupleDump) error {
+	if !c.started {
+		c.started = true
+		var header []string
+		for _, name := range append(append(csvBaseHeader[:len(csvBaseHeader):len(csvBaseHeader)], c.columns...), "error") {
+			header = append(header, csvQuote(name, false))
+		}
+		if err := c.writeRecord(header); err != nil {
+			return err
+		}
+	}
+
+	rec := []string{
+		strconv.Itoa(td.Page), strconv.Itoa(int(td.Offset)), td.State,
+		strconv.Itoa(int(td.LpOff)), strconv.Itoa(int(td.LpLen)),
+	}
+	if h := td.Header; h != nil {
+		rec = append(rec,
+			strconv.FormatUint(uint64(h.Xmin), 10), strconv.FormatUint(uint64(h.Xmax), 10),
+			strconv.FormatUint(uint64(h.CId), 10), h.CTID, strconv.Itoa(h.Natts),
+			strconv.Itoa(int(h.Hoff)), fmt.Sprintf("0x%04x", h.InfoMask), fmt.Sprintf("0x%04x", h.InfoMask2))
+	} else {
+		rec = append(rec, make([]string, len(csvBaseHeader)-len(rec))...)
+	}
+	for i := range rec {
+		rec[i] = csvQuote(rec[i], false)
+	}
+	for i := range c.columns {
+		var s string
+		if i < len(td.Columns) && td.Columns[i].Value != nil {
+			s = csvQuote(formatCSVValue(td.Columns[i].Value), true)
+		}
+		rec = append(rec, s)
+	}
+	return c.writeRecord(append(rec, csvQuote(td.Error, false)))
+}
+
+// writeRecord writes fields that are already quoted as one line.
+func (c *CSVWriter) writeRecord(fields []string) error {
+	c.w.WriteString(strings.Join(fields, ","))
+	return c.w.WriteByte('\n')
+}
+
+func (c *CSVWriter) Finish() error {
+	return c.w.Flush()
+}
+
+// formatCSVValue is FormatValue; csvQuote does the quoting.
+func formatCSVValue(v any) string { return heappage.FormatValue(v, decodeOptions) }
+
+// csvQuote quotes s when it holds a delimiter, quote or line break, starts
+// with a space, or is the \. end-of-data marker, doubling its quotes as
+// encoding/csv does. With present, an empty s is quoted too, to tell an
+// empty value from a NULL.
+func csvQuote(s string, present bool) string {
+	if !(present && s == "") && s != `\.` && !strings.ContainsAny(s, ",\"\r\n") &&
+		(s == "" || s[0] != ' ' && s[0] != '\t') {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+	"github.com/ptflp/techinterview/2.db/heappage/heaptest"
+)
+
+// An empty text value is a 1-byte varlena header, 0x03, with no payload; a
+// NULL has no bytes at all, only a clear bit in the NULL bitmap. Every
+// format must keep the two apart.
+func TestEmptyTextIsNotNull(t *testing.T) {
+	cols := []heappage.ColumnDef{heappage.Column("id", heappage.INT8OID), heappage.Column("a", heappage.TEXTOID), heappage.Column("b", heappage.TEXTOID)}
+	tup := heaptest.Tuple(t, cols, []any{int64(1), "", nil})
+	if tup[24+8] != 0x03 {
+		t.Fatalf("empty text stored as %#x, want 0x03", tup[24+8])
+	}
+	page := heaptest.Page(t, 0, tup)
+	hdr, items, err := heappage.ParsePage(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &heappage.Page{Raw: page, Header: hdr, Items: items}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"text", `row: id=1, a="", b=NULL`},
+		{"jsonl", `"columns":{"id":1,"a":"","b":null}`},
+		{"csv", `,1,"",,` + "\n"},
+		{"sql", `VALUES (1, '', NULL);`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := DumpOptions{Schema: cols, Format: tt.format, Table: "t"}
+			w, err := newDumpWriter(&buf, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writePage(w, p, opts); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("output has no %q:\n%s", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestCSVQuote(t *testing.T) {
+	tests := []struct {
+		s       string
+		present bool
+		want    string
+	}{
+		{"", false, ""},
+		{"", true, `""`},
+		{"abc", true, "abc"},
+		{"(0,1)", false, `"(0,1)"`},
+		{`say "hi"`, true, `"say ""hi"""`},
+		{"two\nlines", true, "\"two\nlines\""},
+		{" lead", true, `" lead"`},
+		{`\.`, true, `"\."`},
+	}
+	for _, tt := range tests {
+		if got := csvQuote(tt.s, tt.present); got != tt.want {
+			t.Errorf("csvQuote(%q, %v) = %s, want %s", tt.s, tt.present, got, tt.want)
+		}
+	}
+}
+
+// -format sql assumes standard_conforming_strings = on: a backslash is an
+// ordinary character and only a single quote is doubled.
+func TestSQLLiteral(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"null", nil, "NULL"},
+		{"bool", true, "true"},
+		{"int", int64(-7), "-7"},
+		{"embedded quote", "it's", `'it''s'`},
+		{"backslash", `C:\tmp\n`, `'C:\tmp\n'`},
+		{"utf-8", "Grüße", "'Grüße'"},
+		{"nul", "a\x00b", `E'a\x00b'`},
+		{"not utf-8", "caf\xe9 'x' \\", `E'caf\xe9 ''x'' \\'`},
+		{"bytea", []byte{0xde, 0xad, '\''}, `'\xdead27'`},
+		{"float", 1.5, "1.5"},
+		{"nan", math.NaN(), "'NaN'"},
+		{"infinity", math.Inf(1), "'Infinity'"},
+		{"-infinity", float32(math.Inf(-1)), "'-Infinity'"},
+		{"composite", []any{int32(1), nil, "a'b", []any{true}}, `ROW(1, NULL, 'a''b', ROW(true))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlLiteral(tt.v); got != tt.want {
+				t.Errorf("sqlLiteral(%#v) = %s, want %s", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct{ id, want string }{
+		{"id", "id"},
+		{"_tmp$1", "_tmp$1"},
+		{"Name", `"Name"`},
+		{"first name", `"first name"`},
+		{`say "hi"`, `"say ""hi"""`},
+		{"1st", `"1st"`},
+		{"grüße", `"grüße"`},
+		{"user", `"user"`},
+		{"order", `"order"`},
+		{"timestamp", `"timestamp"`},
+		{"left", `"left"`},
+		{"name", "name"}, // unreserved
+	}
+	for _, tt := range tests {
+		if got := quoteIdent(tt.id); got != tt.want {
+			t.Errorf("quoteIdent(%q) = %s, want %s", tt.id, got, tt.want)
+		}
+	}
+	if got := quoteQualified("Public.order"); got != `"Public"."order"` {
+		t.Errorf("quoteQualified = %s", got)
+	}
+}
+
+func TestTextWriterExpanded(t *testing.T) {
+	var buf bytes.Buffer
+	tw := NewTextWriter(&buf)
+	tw.Expanded = true
+	err := tw.WriteTuple(TupleDump{Offset: 1, State: "NORMAL", Flags: heappage.LP_NORMAL, Columns: []ColumnValue{
+		{Name: "id", Value: int64(1)},
+		{Name: "ts", Value: "2000-01-01 00:00:00", Display: "2000-01-01 00:00:00 (0)"},
+		{Name: "n", Value: nil},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := " [ 1] lp_off=   0 lp_len=  0 flags=1 (NORMAL)\n" +
+		"      id | 1\n" +
+		"      ts | 2000-01-01 00:00:00 (0)\n" +
+		"      n  | \n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+// Freeze age report (-relfrozenxid): the oldest xmin VACUUM has not frozen
+// yet, per page and over the relation, for age-of-xid emergencies. Every
+// unfrozen xmin should follow pg_class.relfrozenxid; one that precedes it
+// means the table was marked frozen further than it is (a bug, or a
+// corrupted relfrozenxid), and clog for that xid may already be gone.
+// Given the current xid (-next-xid, from txid_current() or pg_controldata's
+// NextXID), the report also tells how far the table is from wraparound.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// Special xids (transam.h)
+const (
+	BootstrapTransactionId   = 1
+	FrozenTransactionId      = 2 // xmin of tuples frozen before 9.4
+	FirstNormalTransactionId = 3
+)
+
+// Wraparound limits (varsup.c SetTransactionIdLimit): the server warns when
+// fewer than xidWarnMargin xids are left and stops assigning new ones at
+// xidStopMargin (1M before PG14).
+const (
+	xidWrapDistance = 1 << 31
+	xidWarnMargin   = 40_000_000
+	xidStopMargin   = 3_000_000
+)
+
+// xidPrecedes compares xids modulo 2^31 like TransactionIdPrecedes; the
+// special xids sort before every normal one.
+func xidPrecedes(a, b uint32) bool {
+	if a < FirstNormalTransactionId || b < FirstNormalTransactionId {
+		return a < b
+	}
+	return int32(a-b) < 0
+}
+
+// xidAge is next - xid in the 2^32 circle, as age() computes it.
+func xidAge(next, xid uint32) int64 { return int64(next - xid) }
+
+// PageFreezeAge is one page's unfrozen tuples. OldestXmin is 0 when every
+// tuple is frozen (or aborted).
+type PageFreezeAge struct {
+	Page       int    `json:"page"`
+	Unfrozen   int    `json:"unfrozen"`
+	OldestXmin uint32 `json:"oldest_xmin,omitempty"`
+}
+
+// FreezeSuspect is a tuple whose xmin precedes relfrozenxid.
+type FreezeSuspect struct {
+	Page int                   `json:"page"`
+	LP   heappage.OffsetNumber `json:"lp"`
+	Xmin uint32                `json:"xmin"`
+}
+
+type FreezeReport struct {
+	RelFrozenXid uint32          `json:"relfrozenxid"`
+	Pages        []PageFreezeAge `json:"pages"`
+	OldestXmin   uint32          `json:"oldest_xmin,omitempty"`
+	Suspects     []FreezeSuspect `json:"suspects"`
+	NextXid      uint32          `json:"next_xid,omitempty"`
+	Age          int64           `json:"oldest_xmin_age,omitempty"`
+	Remaining    int64           `json:"xids_before_wraparound,omitempty"`
+}
+
+// unfrozenXmin returns the xmin a future VACUUM still has to freeze, or
+// false for a frozen or aborted inserter.
+func unfrozenXmin(rh *heappage.RowHeader) (uint32, bool) {
+	if rh.XminFrozen() || rh.XminInvalid() || rh.Xmin < FirstNormalTransactionId {
+		return 0, false
+	}
+	return rh.Xmin, true
+}
+
+func pageFreezeAge(pageNo int, page []byte, items []heappage.ItemID, relfrozenxid uint32, rep *FreezeReport) PageFreezeAge {
+	pf := PageFreezeAge{Page: pageNo}
+	for _, it := range items {
+		start, end := int(it.LpOff), int(it.LpOff)+int(it.LpLen)
+		if it.Flags != heappage.LP_NORMAL || start >= end || end > len(page) {
+			continue
+		}
+		rh, err := heappage.ParseRowHeader(page[start:end])
+		if err != nil {
+			continue
+		}
+		xmin, ok := unfrozenXmin(rh)
+		if !ok {
+			continue
+		}
+		pf.Unfrozen++
+		if pf.OldestXmin == 0 || xidPrecedes(xmin, pf.OldestXmin) {
+			pf.OldestXmin = xmin
+		}
+		if xidPrecedes(xmin, relfrozenxid) {
+			rep.Suspects = append(rep.Suspects, FreezeSuspect{pageNo, it.Index, xmin})
+		}
+	}
+	return pf
+}
+
+func collectFreezeAge(ctx context.Context, rel Relation, relfrozenxid uint32, opts DumpOptions) (*FreezeReport, error) {
+	nPages, err := relationPages(rel)
+	if err != nil {
+		return nil, err
+	}
+	rep := &FreezeReport{RelFrozenXid: relfrozenxid, Pages: []PageFreezeAge{}, Suspects: []FreezeSuspect{}}
+	prog := newScanProgress(nPages, opts)
+	err = heappage.ScanRange(ctx, rel, 0, nPages, withProgress(prog, func(p *heappage.Page, err error) error {
+		if err != nil {
+			var pe *heappage.PageError
+			if !opts.SkipErrors || !errors.As(err, &pe) {
+				return err
+			}
+			logSkippedPage(pe)
+			return nil
+		}
+		pf := pageFreezeAge(p.No, p.Raw, p.Items, relfrozenxid, rep)
+		rep.Pages = append(rep.Pages, pf)
+		if pf.OldestXmin != 0 && (rep.OldestXmin == 0 || xidPrecedes(pf.OldestXmin, rep.OldestXmin)) {
+			rep.OldestXmin = pf.OldestXmin
+		}
+		return nil
+	}))
+	if prog != nil {
+		prog.Done()
+	}
+	return rep, err
+}
+
+// freezeAgeReport prints the report; nextXid 0 leaves out the wraparound
+// distance.
+func freezeAgeReport(ctx context.Context, filePath string, relfrozenxid, nextXid uint32, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rep, err := collectFreezeAge(ctx, f, relfrozenxid, opts)
+	if err != nil {
+		return err
+	}
+	if nextXid != 0 && rep.OldestXmin != 0 {
+		rep.NextXid = nextXid
+		rep.Age = xidAge(nextXid, rep.OldestXmin)
+		rep.Remaining = xidWrapDistance - rep.Age
+	}
+	if opts.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	return writeFreezeReportText(os.Stdout, rep, nextXid)
+}
+
+func writeFreezeReportText(w io.Writer, rep *FreezeReport, nextXid uint32) error {
+	fmt.Fprintf(w, "%6s  %8s  %11s\n", "page", "unfrozen", "oldest_xmin")
+	for _, p := range rep.Pages {
+		oldest := "-"
+		if p.OldestXmin != 0 {
+			oldest = fmt.Sprint(p.OldestXmin)
+		}
+		fmt.Fprintf(w, "%6d  %8d  %11s\n", p.Page, p.Unfrozen, oldest)
+	}
+	for _, s := range rep.Suspects {
+		fmt.Fprintf(w, "SUSPECT page %d lp %d: xmin %d precedes relfrozenxid %d\n", s.Page, s.LP, s.Xmin, rep.RelFrozenXid)
+	}
+	if rep.OldestXmin == 0 {
+		_, err := fmt.Fprintf(w, "no unfrozen tuples (relfrozenxid %d)\n", rep.RelFrozenXid)
+		return err
+	}
+	fmt.Fprintf(w, "oldest unfrozen xmin: %d (relfrozenxid %d, %d suspect tuples)\n",
+		rep.OldestXmin, rep.RelFrozenXid, len(rep.Suspects))
+	if nextXid == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "age(relfrozenxid) = %d, age(oldest xmin) = %d at next xid %d\n",
+		xidAge(nextXid, rep.RelFrozenXid), rep.Age, nextXid)
+	var err error
+	switch {
+	case rep.Remaining <= 0:
+		_, err = fmt.Fprintf(w, "oldest xmin is past the wraparound horizon: it now reads as in the future\n")
+	case rep.Remaining <= xidStopMargin:
+		_, err = fmt.Fprintf(w, "%d xids before wraparound: the server has stopped assigning xids, VACUUM in single-user mode\n", rep.Remaining)
+	case rep.Remaining <= xidWarnMargin:
+		_, err = fmt.Fprintf(w, "%d xids before wraparound: the server is warning, VACUUM (FREEZE) now\n", rep.Remaining)
+	default:
+		_, err = fmt.Fprintf(w, "%d xids before wraparound\n", rep.Remaining)
+	}
+	return err
+}
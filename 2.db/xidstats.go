@@ -0,0 +1,104 @@
+package main
+
+// Per-page transaction counts (-xmin-stats): which xids inserted and which
+// deleted or locked the page's tuples, and how many each.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ptflp/techinterview/2.db/heappage"
+)
+
+// XidCount is one distinct xmin or xmax. Multi is set for an xmax that is a
+// MultiXactId (HEAP_XMAX_IS_MULTI), a separate number space from xids.
+type XidCount struct {
+	Xid    uint32 `json:"xid"`
+	Multi  bool   `json:"multi,omitempty"`
+	Tuples int    `json:"tuples"`
+}
+
+type XidStats struct {
+	PageNo int        `json:"page"`
+	Xmin   []XidCount `json:"xmin"`
+	Xmax   []XidCount `json:"xmax"`
+}
+
+// pageXidStats groups the page's LP_NORMAL tuples by xmin and by xmax,
+// each sorted by xid. xmax 0 (never deleted or locked) is counted too.
+func pageXidStats(pageNo int, page []byte, items []heappage.ItemID) *XidStats {
+	type key struct {
+		xid   uint32
+		multi bool
+	}
+	xmin, xmax := map[key]int{}, map[key]int{}
+	for _, it := range items {
+		if it.Flags != heappage.LP_NORMAL || int(it.LpOff)+int(it.LpLen) > len(page) {
+			continue
+		}
+		rh, err := heappage.ParseRowHeader(page[it.LpOff : int(it.LpOff)+int(it.LpLen)])
+		if err != nil {
+			continue
+		}
+		xmin[key{rh.Xmin, false}]++
+		xmax[key{rh.Xmax, rh.XmaxIsMulti()}]++
+	}
+	sorted := func(m map[key]int) []XidCount {
+		out := make([]XidCount, 0, len(m))
+		for k, n := range m {
+			out = append(out, XidCount{k.xid, k.multi, n})
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Multi != out[j].Multi {
+				return !out[i].Multi
+			}
+			return out[i].Xid < out[j].Xid
+		})
+		return out
+	}
+	return &XidStats{PageNo: pageNo, Xmin: sorted(xmin), Xmax: sorted(xmax)}
+}
+
+func xidStats(filePath string, pageNo int, opts DumpOptions) error {
+	f, err := openRelation(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	page, _, items, err := heappage.LoadPage(f, pageNo)
+	if err != nil {
+		return err
+	}
+	st := pageXidStats(pageNo, page, items)
+	if opts.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+	return writeXidStatsText(os.Stdout, st)
+}
+
+func writeXidStatsText(w io.Writer, st *XidStats) error {
+	fmt.Fprintf(w, "== Page %d ==\n", st.PageNo)
+	for _, sec := range []struct {
+		name   string
+		counts []XidCount
+	}{{"xmin", st.Xmin}, {"xmax", st.Xmax}} {
+		fmt.Fprintf(w, "%s: %d distinct\n", sec.name, len(sec.counts))
+		for _, c := range sec.counts {
+			note := ""
+			switch {
+			case c.Multi:
+				note = "  (multixact)"
+			case c.Xid == 0:
+				note = "  (invalid)"
+			}
+			fmt.Fprintf(w, "  %10d  %4d%s\n", c.Xid, c.Tuples, note)
+		}
+	}
+	return nil
+}